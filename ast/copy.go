@@ -0,0 +1,208 @@
+package ast
+
+// Copy returns a deep copy of a node, so the copy can be modified without
+// changing the original tree
+func Copy(node Node) Node {
+	switch node := node.(type) {
+	case *Program:
+		c := *node
+		c.Statements = copyStatements(node.Statements)
+		return &c
+
+	case *LetStatement:
+		c := *node
+		c.Name = copyIdentifier(node.Name)
+		c.Value = copyExpression(node.Value)
+		return &c
+
+	case *ReturnStatement:
+		c := *node
+		c.ReturnValue = copyExpression(node.ReturnValue)
+		return &c
+
+	case *ExpressionStatement:
+		c := *node
+		c.Expression = copyExpression(node.Expression)
+		return &c
+
+	case *WhileStatement:
+		c := *node
+		c.Condition = copyExpression(node.Condition)
+		c.Body = copyBlock(node.Body)
+		return &c
+
+	case *ForStatement:
+		c := *node
+		c.Key = copyIdentifier(node.Key)
+		c.Value = copyIdentifier(node.Value)
+		c.Iterable = copyExpression(node.Iterable)
+		c.Body = copyBlock(node.Body)
+		return &c
+
+	case *BreakStatement:
+		c := *node
+		return &c
+
+	case *ContinueStatement:
+		c := *node
+		return &c
+
+	case *BlockStatement:
+		c := *node
+		c.Statements = copyStatements(node.Statements)
+		return &c
+
+	case *Identifier:
+		c := *node
+		return &c
+
+	case *IntegerLiteral:
+		c := *node
+		return &c
+
+	case *FloatLiteral:
+		c := *node
+		return &c
+
+	case *StringLiteral:
+		c := *node
+		return &c
+
+	case *Boolean:
+		c := *node
+		return &c
+
+	case *PrefixExpression:
+		c := *node
+		c.Right = copyExpression(node.Right)
+		return &c
+
+	case *InfixExpression:
+		c := *node
+		c.Left = copyExpression(node.Left)
+		c.Right = copyExpression(node.Right)
+		return &c
+
+	case *AssignExpression:
+		c := *node
+		c.Target = copyExpression(node.Target)
+		c.Value = copyExpression(node.Value)
+		return &c
+
+	case *IfExpression:
+		c := *node
+		c.Condition = copyExpression(node.Condition)
+		c.Consequence = copyBlock(node.Consequence)
+		c.Alternative = copyBlock(node.Alternative)
+		return &c
+
+	case *TryExpression:
+		c := *node
+		c.Block = copyBlock(node.Block)
+		c.Param = copyIdentifier(node.Param)
+		c.Catch = copyBlock(node.Catch)
+		return &c
+
+	case *FunctionLiteral:
+		c := *node
+		c.Parameters = copyIdentifiers(node.Parameters)
+		c.Defaults = copyExpressions(node.Defaults)
+		c.Rest = copyIdentifier(node.Rest)
+		c.Body = copyBlock(node.Body)
+		return &c
+
+	case *CallExpression:
+		c := *node
+		c.Function = copyExpression(node.Function)
+		c.Arguments = copyExpressions(node.Arguments)
+		return &c
+
+	case *ArrayLiteral:
+		c := *node
+		c.Elements = copyExpressions(node.Elements)
+		return &c
+
+	case *IndexExpression:
+		c := *node
+		c.Left = copyExpression(node.Left)
+		c.Index = copyExpression(node.Index)
+		return &c
+
+	case *HashLiteral:
+		c := *node
+		if node.Pairs != nil {
+			c.Pairs = make(map[Expression]Expression, len(node.Pairs))
+			for key, value := range node.Pairs {
+				c.Pairs[copyExpression(key)] = copyExpression(value)
+			}
+		}
+		return &c
+
+	case *MacroLiteral:
+		c := *node
+		c.Parameters = copyIdentifiers(node.Parameters)
+		c.Body = copyBlock(node.Body)
+		return &c
+	}
+
+	return node
+}
+
+func copyExpression(exp Expression) Expression {
+	if exp == nil {
+		return nil
+	}
+	c, _ := Copy(exp).(Expression)
+	return c
+}
+
+func copyIdentifier(ident *Identifier) *Identifier {
+	if ident == nil {
+		return nil
+	}
+	c := *ident
+	return &c
+}
+
+func copyBlock(block *BlockStatement) *BlockStatement {
+	if block == nil {
+		return nil
+	}
+	c, _ := Copy(block).(*BlockStatement)
+	return c
+}
+
+func copyStatements(statements []Statement) []Statement {
+	if statements == nil {
+		return nil
+	}
+	c := make([]Statement, len(statements))
+	for i, statement := range statements {
+		if statement != nil {
+			c[i], _ = Copy(statement).(Statement)
+		}
+	}
+	return c
+}
+
+func copyExpressions(expressions []Expression) []Expression {
+	if expressions == nil {
+		return nil
+	}
+	c := make([]Expression, len(expressions))
+	for i, exp := range expressions {
+		c[i] = copyExpression(exp)
+	}
+	return c
+}
+
+func copyIdentifiers(idents []*Identifier) []*Identifier {
+	if idents == nil {
+		return nil
+	}
+	c := make([]*Identifier, len(idents))
+	for i, ident := range idents {
+		c[i] = copyIdentifier(ident)
+	}
+	return c
+}
@@ -0,0 +1,95 @@
+package ast
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCopy(t *testing.T) {
+	one := func() Expression { return &IntegerLiteral{Value: 1} }
+	block := func() *BlockStatement {
+		return &BlockStatement{
+			Statements: []Statement{&ExpressionStatement{Expression: one()}},
+		}
+	}
+
+	tests := []Node{
+		one(),
+		&Program{
+			Statements: []Statement{
+				&LetStatement{Name: &Identifier{Value: "x"}, Value: one()},
+				&ReturnStatement{ReturnValue: one()},
+				&BreakStatement{},
+				&ContinueStatement{},
+			},
+		},
+		&InfixExpression{Left: one(), Operator: "+", Right: one()},
+		&PrefixExpression{Operator: "-", Right: one()},
+		&AssignExpression{Target: &Identifier{Value: "x"}, Operator: "=", Value: one()},
+		&IndexExpression{Left: one(), Index: one()},
+		&IfExpression{Condition: one(), Consequence: block()},
+		&IfExpression{Condition: one(), Consequence: block(), Alternative: block()},
+		&WhileStatement{Condition: one(), Body: block()},
+		&ForStatement{
+			Key:      &Identifier{Value: "i"},
+			Value:    &Identifier{Value: "x"},
+			Iterable: one(),
+			Body:     block(),
+		},
+		&TryExpression{Block: block(), Param: &Identifier{Value: "e"}, Catch: block()},
+		&FunctionLiteral{
+			Parameters: []*Identifier{{Value: "x"}, {Value: "y"}},
+			Defaults:   []Expression{nil, one()},
+			Rest:       &Identifier{Value: "rest"},
+			Body:       block(),
+			Name:       "f",
+		},
+		&CallExpression{Function: &Identifier{Value: "f"}, Arguments: []Expression{one()}},
+		&ArrayLiteral{Elements: []Expression{one(), &StringLiteral{Value: "a"}}},
+		&MacroLiteral{Parameters: []*Identifier{{Value: "x"}}, Body: block()},
+	}
+
+	for _, original := range tests {
+		copied := Copy(original)
+
+		if !reflect.DeepEqual(copied, original) {
+			t.Errorf("copy is not equal. got=%#v, want=%#v", copied, original)
+		}
+
+		// Changing every integer in the copy must leave the original alone
+		Modify(copied, func(node Node) Node {
+			if integer, ok := node.(*IntegerLiteral); ok {
+				integer.Value = 2
+			}
+			return node
+		})
+
+		Modify(original, func(node Node) Node {
+			if integer, ok := node.(*IntegerLiteral); ok && integer.Value != 1 {
+				t.Errorf("original was modified through the copy: %s", original.String())
+			}
+			return node
+		})
+	}
+
+	// Hash keys are pointers, so the pairs are compared by their values
+	hash := &HashLiteral{Pairs: map[Expression]Expression{&Boolean{Value: true}: one()}}
+	copied := Copy(hash).(*HashLiteral)
+	if len(copied.Pairs) != 1 {
+		t.Fatalf("copy has wrong number of pairs. got=%d", len(copied.Pairs))
+	}
+	for key, value := range copied.Pairs {
+		if _, ok := hash.Pairs[key]; ok {
+			t.Errorf("hash key was not copied")
+		}
+		if !key.(*Boolean).Value || value.(*IntegerLiteral).Value != 1 {
+			t.Errorf("copy is not equal. got=%#v: %#v", key, value)
+		}
+		value.(*IntegerLiteral).Value = 2
+	}
+	for _, value := range hash.Pairs {
+		if value.(*IntegerLiteral).Value != 1 {
+			t.Errorf("original was modified through the copy")
+		}
+	}
+}
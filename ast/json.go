@@ -0,0 +1,687 @@
+package ast
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/pwbrown/go-monkey/token"
+)
+
+// The JSON form of a node. Every node has a "type" naming its Go type and
+// the token it starts with, the other fields depend on the type. Value holds
+// a child node for let statements and assignments, and the literal value
+// for identifiers and literals
+type jsonNode struct {
+	Type        string          `json:"type"`
+	Token       *jsonToken      `json:"token,omitempty"`
+	Name        json.RawMessage `json:"name,omitempty"`
+	Target      *jsonNode       `json:"target,omitempty"`
+	Left        *jsonNode       `json:"left,omitempty"`
+	Operator    string          `json:"operator,omitempty"`
+	Right       *jsonNode       `json:"right,omitempty"`
+	Value       json.RawMessage `json:"value,omitempty"`
+	ReturnValue *jsonNode       `json:"returnValue,omitempty"`
+	Expression  *jsonNode       `json:"expression,omitempty"`
+	Condition   *jsonNode       `json:"condition,omitempty"`
+	Consequence *jsonNode       `json:"consequence,omitempty"`
+	Alternative *jsonNode       `json:"alternative,omitempty"`
+	Block       *jsonNode       `json:"block,omitempty"`
+	Param       *jsonNode       `json:"param,omitempty"`
+	Catch       *jsonNode       `json:"catch,omitempty"`
+	Key         *jsonNode       `json:"key,omitempty"`
+	Iterable    *jsonNode       `json:"iterable,omitempty"`
+	Parameters  []*jsonNode     `json:"parameters,omitempty"`
+	Defaults    []*jsonNode     `json:"defaults,omitempty"`
+	Rest        *jsonNode       `json:"rest,omitempty"`
+	Function    *jsonNode       `json:"function,omitempty"`
+	Arguments   []*jsonNode     `json:"arguments,omitempty"`
+	Elements    []*jsonNode     `json:"elements,omitempty"`
+	Index       *jsonNode       `json:"index,omitempty"`
+	Pairs       []jsonPair      `json:"pairs,omitempty"`
+	Statements  []*jsonNode     `json:"statements,omitempty"`
+	Body        *jsonNode       `json:"body,omitempty"`
+	Rparen      *jsonToken      `json:"rparen,omitempty"`
+	Rbracket    *jsonToken      `json:"rbracket,omitempty"`
+	Rbrace      *jsonToken      `json:"rbrace,omitempty"`
+	Comments    []jsonComment   `json:"comments,omitempty"`
+}
+
+type jsonToken struct {
+	Type    token.TokenType `json:"type"`
+	Literal string          `json:"literal"`
+	Pos     *jsonPosition   `json:"pos,omitempty"`
+	End     *jsonPosition   `json:"end,omitempty"`
+}
+
+type jsonPosition struct {
+	Filename string `json:"filename,omitempty"`
+	Offset   int    `json:"offset"`
+	Line     int    `json:"line"`
+	Column   int    `json:"column"`
+}
+
+type jsonPair struct {
+	Key   *jsonNode `json:"key"`
+	Value *jsonNode `json:"value"`
+}
+
+type jsonComment struct {
+	Text string        `json:"text"`
+	Pos  *jsonPosition `json:"pos,omitempty"`
+	End  *jsonPosition `json:"end,omitempty"`
+}
+
+// MarshalJSON encodes a program and all of its nodes as JSON
+func (p *Program) MarshalJSON() ([]byte, error) {
+	n, err := encodeNode(p)
+	if err != nil {
+		return nil, err
+	}
+	return marshal(n)
+}
+
+// Encode a value as JSON without escaping HTML characters, which are common
+// in source code
+func marshal(v interface{}) ([]byte, error) {
+	var out bytes.Buffer
+
+	enc := json.NewEncoder(&out)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(out.Bytes(), []byte("\n")), nil
+}
+
+// UnmarshalJSON decodes a program encoded by MarshalJSON
+func (p *Program) UnmarshalJSON(data []byte) error {
+	var n jsonNode
+	if err := json.Unmarshal(data, &n); err != nil {
+		return err
+	}
+	if n.Type != "Program" {
+		return fmt.Errorf("expected a Program, got %q", n.Type)
+	}
+
+	node, err := decodeNode(&n)
+	if err != nil {
+		return err
+	}
+	*p = *node.(*Program)
+	return nil
+}
+
+// *************************** ENCODING *****************************
+
+func encodeNode(node Node) (*jsonNode, error) {
+	var err error
+	n := &jsonNode{Type: nodeType(node)}
+
+	// Encode a child, keeping the first error
+	child := func(node Node) *jsonNode {
+		if err != nil || isNil(node) {
+			return nil
+		}
+		var c *jsonNode
+		c, err = encodeNode(node)
+		return c
+	}
+	children := func(nodes []Expression) []*jsonNode {
+		list := []*jsonNode{}
+		for _, node := range nodes {
+			list = append(list, child(node))
+		}
+		return list
+	}
+	identifiers := func(idents []*Identifier) []*jsonNode {
+		list := []*jsonNode{}
+		for _, ident := range idents {
+			list = append(list, child(ident))
+		}
+		return list
+	}
+	statements := func(stmts []Statement) []*jsonNode {
+		list := []*jsonNode{}
+		for _, stmt := range stmts {
+			list = append(list, child(stmt))
+		}
+		return list
+	}
+	raw := func(v interface{}) json.RawMessage {
+		if c, ok := v.(*jsonNode); err != nil || ok && c == nil {
+			return nil
+		}
+		var data []byte
+		data, err = marshal(v)
+		return data
+	}
+
+	switch node := node.(type) {
+	case *Program:
+		n.Statements = statements(node.Statements)
+		for _, c := range node.Comments {
+			n.Comments = append(n.Comments, jsonComment{
+				Text: c.Text,
+				Pos:  encodePosition(c.Pos),
+				End:  encodePosition(c.End),
+			})
+		}
+
+	case *LetStatement:
+		n.Token = encodeToken(node.Token)
+		n.Name = raw(child(node.Name))
+		n.Value = raw(child(node.Value))
+
+	case *ReturnStatement:
+		n.Token = encodeToken(node.Token)
+		n.ReturnValue = child(node.ReturnValue)
+
+	case *ExpressionStatement:
+		n.Token = encodeToken(node.Token)
+		n.Expression = child(node.Expression)
+
+	case *WhileStatement:
+		n.Token = encodeToken(node.Token)
+		n.Condition = child(node.Condition)
+		n.Body = child(node.Body)
+
+	case *ForStatement:
+		n.Token = encodeToken(node.Token)
+		n.Key = child(node.Key)
+		n.Value = raw(child(node.Value))
+		n.Iterable = child(node.Iterable)
+		n.Body = child(node.Body)
+
+	case *BreakStatement:
+		n.Token = encodeToken(node.Token)
+
+	case *ContinueStatement:
+		n.Token = encodeToken(node.Token)
+
+	case *BlockStatement:
+		n.Token = encodeToken(node.Token)
+		n.Statements = statements(node.Statements)
+		n.Rbrace = encodeToken(node.Rbrace)
+
+	case *Identifier:
+		n.Token = encodeToken(node.Token)
+		n.Value = raw(node.Value)
+
+	case *IntegerLiteral:
+		n.Token = encodeToken(node.Token)
+		n.Value = raw(node.Value)
+
+	case *FloatLiteral:
+		n.Token = encodeToken(node.Token)
+		n.Value = raw(node.Value)
+
+	case *StringLiteral:
+		n.Token = encodeToken(node.Token)
+		n.Value = raw(node.Value)
+
+	case *Boolean:
+		n.Token = encodeToken(node.Token)
+		n.Value = raw(node.Value)
+
+	case *PrefixExpression:
+		n.Token = encodeToken(node.Token)
+		n.Operator = node.Operator
+		n.Right = child(node.Right)
+
+	case *InfixExpression:
+		n.Token = encodeToken(node.Token)
+		n.Left = child(node.Left)
+		n.Operator = node.Operator
+		n.Right = child(node.Right)
+
+	case *AssignExpression:
+		n.Token = encodeToken(node.Token)
+		n.Target = child(node.Target)
+		n.Operator = node.Operator
+		n.Value = raw(child(node.Value))
+
+	case *IfExpression:
+		n.Token = encodeToken(node.Token)
+		n.Condition = child(node.Condition)
+		n.Consequence = child(node.Consequence)
+		n.Alternative = child(node.Alternative)
+
+	case *TryExpression:
+		n.Token = encodeToken(node.Token)
+		n.Block = child(node.Block)
+		n.Param = child(node.Param)
+		n.Catch = child(node.Catch)
+
+	case *FunctionLiteral:
+		n.Token = encodeToken(node.Token)
+		if node.Name != "" {
+			n.Name = raw(node.Name)
+		}
+		n.Parameters = identifiers(node.Parameters)
+		if node.Defaults != nil {
+			n.Defaults = children(node.Defaults)
+		}
+		n.Rest = child(node.Rest)
+		n.Body = child(node.Body)
+
+	case *CallExpression:
+		n.Token = encodeToken(node.Token)
+		n.Function = child(node.Function)
+		n.Arguments = children(node.Arguments)
+		n.Rparen = encodeToken(node.Rparen)
+
+	case *ArrayLiteral:
+		n.Token = encodeToken(node.Token)
+		n.Elements = children(node.Elements)
+		n.Rbracket = encodeToken(node.Rbracket)
+
+	case *IndexExpression:
+		n.Token = encodeToken(node.Token)
+		n.Left = child(node.Left)
+		n.Index = child(node.Index)
+		n.Rbracket = encodeToken(node.Rbracket)
+
+	case *HashLiteral:
+		n.Token = encodeToken(node.Token)
+		for _, key := range node.Keys() {
+			n.Pairs = append(n.Pairs, jsonPair{Key: child(key), Value: child(node.Pairs[key])})
+		}
+		n.Rbrace = encodeToken(node.Rbrace)
+
+	case *MacroLiteral:
+		n.Token = encodeToken(node.Token)
+		n.Parameters = identifiers(node.Parameters)
+		n.Body = child(node.Body)
+
+	default:
+		return nil, fmt.Errorf("cannot encode node of type %T", node)
+	}
+
+	return n, err
+}
+
+// Return the name of the Go type of a node, without the package
+func nodeType(node Node) string {
+	name := fmt.Sprintf("%T", node)
+	for i := len(name) - 1; i >= 0; i-- {
+		if name[i] == '.' {
+			return name[i+1:]
+		}
+	}
+	return name
+}
+
+// Report whether a node is nil, including typed nil pointers
+func isNil(node Node) bool {
+	switch node := node.(type) {
+	case nil:
+		return true
+	case *Identifier:
+		return node == nil
+	case *BlockStatement:
+		return node == nil
+	}
+	return false
+}
+
+func encodeToken(tok token.Token) *jsonToken {
+	if tok.Type == "" && tok.Literal == "" && !tok.Pos.IsValid() {
+		return nil
+	}
+	return &jsonToken{
+		Type:    tok.Type,
+		Literal: tok.Literal,
+		Pos:     encodePosition(tok.Pos),
+		End:     encodePosition(tok.End),
+	}
+}
+
+func encodePosition(pos token.Position) *jsonPosition {
+	if !pos.IsValid() {
+		return nil
+	}
+	return &jsonPosition{Filename: pos.Filename, Offset: pos.Offset, Line: pos.Line, Column: pos.Column}
+}
+
+// *************************** DECODING *****************************
+
+// A decoder keeps the first error found while decoding a tree
+type decoder struct {
+	err error
+}
+
+func (d *decoder) fail(format string, a ...interface{}) {
+	if d.err == nil {
+		d.err = fmt.Errorf(format, a...)
+	}
+}
+
+func decodeNode(n *jsonNode) (Node, error) {
+	d := &decoder{}
+	node := d.node(n)
+	if d.err != nil {
+		return nil, d.err
+	}
+	return node, nil
+}
+
+func (d *decoder) node(n *jsonNode) Node {
+	if d.err != nil {
+		return nil
+	}
+
+	tok := decodeToken(n.Token)
+
+	switch n.Type {
+	case "Program":
+		program := &Program{Statements: d.statements(n.Statements)}
+		for _, c := range n.Comments {
+			program.Comments = append(program.Comments, token.Comment{
+				Text: c.Text,
+				Pos:  decodePosition(c.Pos),
+				End:  decodePosition(c.End),
+			})
+		}
+		return program
+
+	case "LetStatement":
+		return &LetStatement{
+			Token: tok,
+			Name:  d.identifier(d.rawNode(n.Name, n.Type, "name"), n.Type, "name", true),
+			Value: d.expression(d.rawNode(n.Value, n.Type, "value"), n.Type, "value", true),
+		}
+
+	case "ReturnStatement":
+		return &ReturnStatement{Token: tok, ReturnValue: d.expression(n.ReturnValue, n.Type, "returnValue", false)}
+
+	case "ExpressionStatement":
+		return &ExpressionStatement{Token: tok, Expression: d.expression(n.Expression, n.Type, "expression", true)}
+
+	case "WhileStatement":
+		return &WhileStatement{
+			Token:     tok,
+			Condition: d.expression(n.Condition, n.Type, "condition", true),
+			Body:      d.block(n.Body, n.Type, "body", true),
+		}
+
+	case "ForStatement":
+		return &ForStatement{
+			Token:    tok,
+			Key:      d.identifier(n.Key, n.Type, "key", false),
+			Value:    d.identifier(d.rawNode(n.Value, n.Type, "value"), n.Type, "value", true),
+			Iterable: d.expression(n.Iterable, n.Type, "iterable", true),
+			Body:     d.block(n.Body, n.Type, "body", true),
+		}
+
+	case "BreakStatement":
+		return &BreakStatement{Token: tok}
+
+	case "ContinueStatement":
+		return &ContinueStatement{Token: tok}
+
+	case "BlockStatement":
+		return &BlockStatement{Token: tok, Statements: d.statements(n.Statements), Rbrace: decodeToken(n.Rbrace)}
+
+	case "Identifier":
+		ident := &Identifier{Token: tok}
+		d.value(n, &ident.Value)
+		return ident
+
+	case "IntegerLiteral":
+		lit := &IntegerLiteral{Token: tok}
+		d.value(n, &lit.Value)
+		return lit
+
+	case "FloatLiteral":
+		lit := &FloatLiteral{Token: tok}
+		d.value(n, &lit.Value)
+		return lit
+
+	case "StringLiteral":
+		lit := &StringLiteral{Token: tok}
+		d.value(n, &lit.Value)
+		return lit
+
+	case "Boolean":
+		lit := &Boolean{Token: tok}
+		d.value(n, &lit.Value)
+		return lit
+
+	case "PrefixExpression":
+		return &PrefixExpression{
+			Token:    tok,
+			Operator: n.Operator,
+			Right:    d.expression(n.Right, n.Type, "right", true),
+		}
+
+	case "InfixExpression":
+		return &InfixExpression{
+			Token:    tok,
+			Left:     d.expression(n.Left, n.Type, "left", true),
+			Operator: n.Operator,
+			Right:    d.expression(n.Right, n.Type, "right", true),
+		}
+
+	case "AssignExpression":
+		return &AssignExpression{
+			Token:    tok,
+			Target:   d.expression(n.Target, n.Type, "target", true),
+			Operator: n.Operator,
+			Value:    d.expression(d.rawNode(n.Value, n.Type, "value"), n.Type, "value", true),
+		}
+
+	case "IfExpression":
+		return &IfExpression{
+			Token:       tok,
+			Condition:   d.expression(n.Condition, n.Type, "condition", true),
+			Consequence: d.block(n.Consequence, n.Type, "consequence", true),
+			Alternative: d.block(n.Alternative, n.Type, "alternative", false),
+		}
+
+	case "TryExpression":
+		return &TryExpression{
+			Token: tok,
+			Block: d.block(n.Block, n.Type, "block", true),
+			Param: d.identifier(n.Param, n.Type, "param", true),
+			Catch: d.block(n.Catch, n.Type, "catch", true),
+		}
+
+	case "FunctionLiteral":
+		lit := &FunctionLiteral{
+			Token:      tok,
+			Parameters: d.identifiers(n.Parameters, n.Type),
+			Rest:       d.identifier(n.Rest, n.Type, "rest", false),
+			Body:       d.block(n.Body, n.Type, "body", true),
+		}
+		if n.Defaults != nil {
+			lit.Defaults = d.expressions(n.Defaults, n.Type, "defaults", false)
+		}
+		if n.Name != nil && d.err == nil {
+			if err := json.Unmarshal(n.Name, &lit.Name); err != nil {
+				d.fail("invalid name of FunctionLiteral: %s", err)
+			}
+		}
+		return lit
+
+	case "CallExpression":
+		return &CallExpression{
+			Token:     tok,
+			Function:  d.expression(n.Function, n.Type, "function", true),
+			Arguments: d.expressions(n.Arguments, n.Type, "arguments", true),
+			Rparen:    decodeToken(n.Rparen),
+		}
+
+	case "ArrayLiteral":
+		return &ArrayLiteral{
+			Token:    tok,
+			Elements: d.expressions(n.Elements, n.Type, "elements", true),
+			Rbracket: decodeToken(n.Rbracket),
+		}
+
+	case "IndexExpression":
+		return &IndexExpression{
+			Token:    tok,
+			Left:     d.expression(n.Left, n.Type, "left", true),
+			Index:    d.expression(n.Index, n.Type, "index", true),
+			Rbracket: decodeToken(n.Rbracket),
+		}
+
+	case "HashLiteral":
+		lit := &HashLiteral{Token: tok, Pairs: map[Expression]Expression{}, Rbrace: decodeToken(n.Rbrace)}
+		for _, pair := range n.Pairs {
+			key := d.expression(pair.Key, n.Type, "key", true)
+			value := d.expression(pair.Value, n.Type, "value", true)
+			if d.err == nil {
+				lit.Pairs[key] = value
+			}
+		}
+		return lit
+
+	case "MacroLiteral":
+		return &MacroLiteral{
+			Token:      tok,
+			Parameters: d.identifiers(n.Parameters, n.Type),
+			Body:       d.block(n.Body, n.Type, "body", true),
+		}
+	}
+
+	d.fail("unknown node type %q", n.Type)
+	return nil
+}
+
+// Decode a field holding either a node or a literal value as a node
+func (d *decoder) rawNode(data json.RawMessage, parent, field string) *jsonNode {
+	if data == nil || d.err != nil {
+		return nil
+	}
+
+	var n jsonNode
+	if err := json.Unmarshal(data, &n); err != nil {
+		d.fail("invalid %s of %s: %s", field, parent, err)
+		return nil
+	}
+	return &n
+}
+
+// Decode the literal value of an identifier or a literal
+func (d *decoder) value(n *jsonNode, v interface{}) {
+	if d.err != nil {
+		return
+	}
+	if n.Value == nil {
+		d.fail("missing value of %s", n.Type)
+		return
+	}
+	if err := json.Unmarshal(n.Value, v); err != nil {
+		d.fail("invalid value of %s: %s", n.Type, err)
+	}
+}
+
+func (d *decoder) expression(n *jsonNode, parent, field string, required bool) Expression {
+	if n == nil {
+		if required {
+			d.fail("missing %s of %s", field, parent)
+		}
+		return nil
+	}
+
+	node := d.node(n)
+	if d.err != nil {
+		return nil
+	}
+	exp, ok := node.(Expression)
+	if !ok {
+		d.fail("%s of %s must be an expression, got %s", field, parent, n.Type)
+	}
+	return exp
+}
+
+func (d *decoder) identifier(n *jsonNode, parent, field string, required bool) *Identifier {
+	exp := d.expression(n, parent, field, required)
+	if exp == nil {
+		return nil
+	}
+	ident, ok := exp.(*Identifier)
+	if !ok {
+		d.fail("%s of %s must be an Identifier, got %s", field, parent, n.Type)
+	}
+	return ident
+}
+
+func (d *decoder) block(n *jsonNode, parent, field string, required bool) *BlockStatement {
+	if n == nil {
+		if required {
+			d.fail("missing %s of %s", field, parent)
+		}
+		return nil
+	}
+
+	node := d.node(n)
+	if d.err != nil {
+		return nil
+	}
+	block, ok := node.(*BlockStatement)
+	if !ok {
+		d.fail("%s of %s must be a BlockStatement, got %s", field, parent, n.Type)
+	}
+	return block
+}
+
+// Decode a list of expressions. Elements may be null if they are not required
+func (d *decoder) expressions(list []*jsonNode, parent, field string, required bool) []Expression {
+	expressions := []Expression{}
+	for _, n := range list {
+		expressions = append(expressions, d.expression(n, parent, field, required))
+	}
+	return expressions
+}
+
+func (d *decoder) identifiers(list []*jsonNode, parent string) []*Identifier {
+	idents := []*Identifier{}
+	for _, n := range list {
+		idents = append(idents, d.identifier(n, parent, "parameters", true))
+	}
+	return idents
+}
+
+func (d *decoder) statements(list []*jsonNode) []Statement {
+	statements := []Statement{}
+	for _, n := range list {
+		if n == nil {
+			d.fail("missing statement")
+			return nil
+		}
+
+		node := d.node(n)
+		if d.err != nil {
+			return nil
+		}
+		stmt, ok := node.(Statement)
+		if !ok {
+			d.fail("expected a statement, got %s", n.Type)
+			return nil
+		}
+		statements = append(statements, stmt)
+	}
+	return statements
+}
+
+func decodeToken(tok *jsonToken) token.Token {
+	if tok == nil {
+		return token.Token{}
+	}
+	return token.Token{
+		Type:    tok.Type,
+		Literal: tok.Literal,
+		Pos:     decodePosition(tok.Pos),
+		End:     decodePosition(tok.End),
+	}
+}
+
+func decodePosition(pos *jsonPosition) token.Position {
+	if pos == nil {
+		return token.Position{}
+	}
+	return token.Position{Filename: pos.Filename, Offset: pos.Offset, Line: pos.Line, Column: pos.Column}
+}
@@ -0,0 +1,97 @@
+package ast
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/pwbrown/go-monkey/token"
+)
+
+func TestProgramJSON(t *testing.T) {
+	program := walkTestProgram()
+
+	data, err := json.Marshal(program)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var decoded Program
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if decoded.String() != program.String() {
+		t.Errorf("wrong program. want=%q, got=%q", program.String(), decoded.String())
+	}
+}
+
+func TestProgramJSONFields(t *testing.T) {
+	pos := token.Position{Filename: "a.mk", Offset: 4, Line: 1, Column: 5}
+	program := &Program{
+		Statements: []Statement{
+			&ExpressionStatement{
+				Token: token.Token{Type: token.IDENT, Literal: "x", Pos: pos},
+				Expression: &Identifier{
+					Token: token.Token{Type: token.IDENT, Literal: "x", Pos: pos},
+					Value: "x",
+				},
+			},
+		},
+	}
+
+	data, err := json.Marshal(program)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := `{"type":"Program","statements":[{"type":"ExpressionStatement",` +
+		`"token":{"type":"IDENT","literal":"x","pos":{"filename":"a.mk","offset":4,"line":1,"column":5}},` +
+		`"expression":{"type":"Identifier",` +
+		`"token":{"type":"IDENT","literal":"x","pos":{"filename":"a.mk","offset":4,"line":1,"column":5}},` +
+		`"value":"x"}}]}`
+	if string(data) != expected {
+		t.Errorf("wrong JSON.\nwant=%s\ngot =%s", expected, data)
+	}
+
+	var decoded Program
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := decoded.Statements[0].Pos(); got != pos {
+		t.Errorf("wrong position. want=%+v, got=%+v", pos, got)
+	}
+}
+
+func TestProgramJSONErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{"type":"Identifier","value":"x"}`, `expected a Program, got "Identifier"`},
+		{`{"type":"Program","statements":[{"type":"Loop"}]}`, `unknown node type "Loop"`},
+		{`{"type":"Program","statements":[{"type":"Identifier","value":"x"}]}`, "expected a statement, got Identifier"},
+		{`{"type":"Program","statements":[{"type":"ExpressionStatement"}]}`, "missing expression of ExpressionStatement"},
+		{
+			`{"type":"Program","statements":[{"type":"LetStatement","name":{"type":"Boolean","value":true},"value":{"type":"Boolean","value":true}}]}`,
+			"name of LetStatement must be an Identifier, got Boolean",
+		},
+		{
+			`{"type":"Program","statements":[{"type":"ExpressionStatement","expression":{"type":"IntegerLiteral","value":"1"}}]}`,
+			"invalid value of IntegerLiteral",
+		},
+		{`[]`, "cannot unmarshal array"},
+	}
+
+	for _, tt := range tests {
+		var program Program
+		err := json.Unmarshal([]byte(tt.input), &program)
+		if err == nil {
+			t.Errorf("%s: expected an error", tt.input)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("%s: wrong error. want=%q, got=%q", tt.input, tt.expected, err.Error())
+		}
+	}
+}
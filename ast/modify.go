@@ -2,6 +2,9 @@ package ast
 
 type ModifierFunc func(Node) Node
 
+// Modify rewrites a tree bottom up: the children of a node are modified
+// before the modifier is called on the node itself, and replaced by what it
+// returns. Children are visited in source order
 func Modify(node Node, modifier ModifierFunc) Node {
 	switch node := node.(type) {
 	case *Program:
@@ -16,6 +19,10 @@ func Modify(node Node, modifier ModifierFunc) Node {
 		node.Left, _ = Modify(node.Left, modifier).(Expression)
 		node.Right, _ = Modify(node.Right, modifier).(Expression)
 
+	case *AssignExpression:
+		node.Target, _ = Modify(node.Target, modifier).(Expression)
+		node.Value, _ = Modify(node.Value, modifier).(Expression)
+
 	case *PrefixExpression:
 		node.Right, _ = Modify(node.Right, modifier).(Expression)
 
@@ -36,17 +43,49 @@ func Modify(node Node, modifier ModifierFunc) Node {
 		}
 
 	case *ReturnStatement:
-		node.ReturnValue, _ = Modify(node.ReturnValue, modifier).(Expression)
+		if node.ReturnValue != nil {
+			node.ReturnValue, _ = Modify(node.ReturnValue, modifier).(Expression)
+		}
 
 	case *LetStatement:
+		node.Name, _ = Modify(node.Name, modifier).(*Identifier)
 		node.Value, _ = Modify(node.Value, modifier).(Expression)
 
+	case *WhileStatement:
+		node.Condition, _ = Modify(node.Condition, modifier).(Expression)
+		node.Body, _ = Modify(node.Body, modifier).(*BlockStatement)
+
+	case *ForStatement:
+		if node.Key != nil {
+			node.Key, _ = Modify(node.Key, modifier).(*Identifier)
+		}
+		node.Value, _ = Modify(node.Value, modifier).(*Identifier)
+		node.Iterable, _ = Modify(node.Iterable, modifier).(Expression)
+		node.Body, _ = Modify(node.Body, modifier).(*BlockStatement)
+
+	case *TryExpression:
+		node.Block, _ = Modify(node.Block, modifier).(*BlockStatement)
+		node.Param, _ = Modify(node.Param, modifier).(*Identifier)
+		node.Catch, _ = Modify(node.Catch, modifier).(*BlockStatement)
+
 	case *FunctionLiteral:
 		for i, param := range node.Parameters {
 			node.Parameters[i], _ = Modify(param, modifier).(*Identifier)
+			if def := node.Default(i); def != nil {
+				node.Defaults[i], _ = Modify(def, modifier).(Expression)
+			}
+		}
+		if node.Rest != nil {
+			node.Rest, _ = Modify(node.Rest, modifier).(*Identifier)
 		}
 		node.Body, _ = Modify(node.Body, modifier).(*BlockStatement)
 
+	case *CallExpression:
+		node.Function, _ = Modify(node.Function, modifier).(Expression)
+		for i, argument := range node.Arguments {
+			node.Arguments[i], _ = Modify(argument, modifier).(Expression)
+		}
+
 	case *ArrayLiteral:
 		for i, element := range node.Elements {
 			node.Elements[i] = Modify(element, modifier).(Expression)
@@ -54,12 +93,18 @@ func Modify(node Node, modifier ModifierFunc) Node {
 
 	case *HashLiteral:
 		newPairs := make(map[Expression]Expression)
-		for key, val := range node.Pairs {
+		for _, key := range node.Keys() {
 			newKey, _ := Modify(key, modifier).(Expression)
-			newVal, _ := Modify(val, modifier).(Expression)
+			newVal, _ := Modify(node.Pairs[key], modifier).(Expression)
 			newPairs[newKey] = newVal
 		}
 		node.Pairs = newPairs
+
+	case *MacroLiteral:
+		for i, param := range node.Parameters {
+			node.Parameters[i], _ = Modify(param, modifier).(*Identifier)
+		}
+		node.Body, _ = Modify(node.Body, modifier).(*BlockStatement)
 	}
 	return modifier(node)
 }
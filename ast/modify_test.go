@@ -95,6 +95,18 @@ func TestModify(t *testing.T) {
 			&LetStatement{Value: one()},
 			&LetStatement{Value: two()},
 		},
+		{
+			&FunctionLiteral{
+				Parameters: []*Identifier{{Value: "a"}, {Value: "b"}},
+				Defaults:   []Expression{nil, one()},
+				Body:       &BlockStatement{},
+			},
+			&FunctionLiteral{
+				Parameters: []*Identifier{{Value: "a"}, {Value: "b"}},
+				Defaults:   []Expression{nil, two()},
+				Body:       &BlockStatement{},
+			},
+		},
 		{
 			&FunctionLiteral{
 				Parameters: []*Identifier{},
@@ -113,6 +125,80 @@ func TestModify(t *testing.T) {
 				},
 			},
 		},
+		{
+			&WhileStatement{
+				Condition: one(),
+				Body: &BlockStatement{
+					Statements: []Statement{&ExpressionStatement{Expression: one()}},
+				},
+			},
+			&WhileStatement{
+				Condition: two(),
+				Body: &BlockStatement{
+					Statements: []Statement{&ExpressionStatement{Expression: two()}},
+				},
+			},
+		},
+		{
+			&ForStatement{
+				Value:    &Identifier{Value: "x"},
+				Iterable: one(),
+				Body: &BlockStatement{
+					Statements: []Statement{&ExpressionStatement{Expression: one()}},
+				},
+			},
+			&ForStatement{
+				Value:    &Identifier{Value: "x"},
+				Iterable: two(),
+				Body: &BlockStatement{
+					Statements: []Statement{&ExpressionStatement{Expression: two()}},
+				},
+			},
+		},
+		{
+			&TryExpression{
+				Block: &BlockStatement{
+					Statements: []Statement{&ExpressionStatement{Expression: one()}},
+				},
+				Param: &Identifier{Value: "e"},
+				Catch: &BlockStatement{
+					Statements: []Statement{&ExpressionStatement{Expression: one()}},
+				},
+			},
+			&TryExpression{
+				Block: &BlockStatement{
+					Statements: []Statement{&ExpressionStatement{Expression: two()}},
+				},
+				Param: &Identifier{Value: "e"},
+				Catch: &BlockStatement{
+					Statements: []Statement{&ExpressionStatement{Expression: two()}},
+				},
+			},
+		},
+		{
+			&CallExpression{
+				Function:  &Identifier{Value: "f"},
+				Arguments: []Expression{one(), one()},
+			},
+			&CallExpression{
+				Function:  &Identifier{Value: "f"},
+				Arguments: []Expression{two(), two()},
+			},
+		},
+		{
+			&MacroLiteral{
+				Parameters: []*Identifier{{Value: "x"}},
+				Body: &BlockStatement{
+					Statements: []Statement{&ExpressionStatement{Expression: one()}},
+				},
+			},
+			&MacroLiteral{
+				Parameters: []*Identifier{{Value: "x"}},
+				Body: &BlockStatement{
+					Statements: []Statement{&ExpressionStatement{Expression: two()}},
+				},
+			},
+		},
 		{
 			&ArrayLiteral{Elements: []Expression{one(), one()}},
 			&ArrayLiteral{Elements: []Expression{two(), two()}},
@@ -150,3 +236,19 @@ func TestModify(t *testing.T) {
 		}
 	}
 }
+
+func TestModifyOrder(t *testing.T) {
+	leaves := []string{}
+	Modify(walkTestProgram(), func(node Node) Node {
+		switch node := node.(type) {
+		case *Identifier, *IntegerLiteral:
+			leaves = append(leaves, node.String())
+		}
+		return node
+	})
+
+	expected := []string{"f", "a", "b", "1", "rest", "a", "b", "f", "2", "x", "3", "y"}
+	if !reflect.DeepEqual(leaves, expected) {
+		t.Errorf("wrong order of leaves. want=%v, got=%v", expected, leaves)
+	}
+}
@@ -0,0 +1,146 @@
+package ast
+
+// A Visitor's Visit method is called for each node found by Walk. If it
+// returns a visitor w, the children of the node are walked with w, followed
+// by a call of w.Visit(nil)
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// Walk traverses a tree in depth-first order without modifying it. Children
+// are visited in source order, nil children are skipped
+func Walk(node Node, v Visitor) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+
+	switch node := node.(type) {
+	case *Program:
+		walkStatements(node.Statements, v)
+
+	case *LetStatement:
+		walkIdentifier(node.Name, v)
+		walkExpression(node.Value, v)
+
+	case *ReturnStatement:
+		walkExpression(node.ReturnValue, v)
+
+	case *ExpressionStatement:
+		walkExpression(node.Expression, v)
+
+	case *WhileStatement:
+		walkExpression(node.Condition, v)
+		walkBlock(node.Body, v)
+
+	case *ForStatement:
+		walkIdentifier(node.Key, v)
+		walkIdentifier(node.Value, v)
+		walkExpression(node.Iterable, v)
+		walkBlock(node.Body, v)
+
+	case *BlockStatement:
+		walkStatements(node.Statements, v)
+
+	case *PrefixExpression:
+		walkExpression(node.Right, v)
+
+	case *InfixExpression:
+		walkExpression(node.Left, v)
+		walkExpression(node.Right, v)
+
+	case *AssignExpression:
+		walkExpression(node.Target, v)
+		walkExpression(node.Value, v)
+
+	case *IfExpression:
+		walkExpression(node.Condition, v)
+		walkBlock(node.Consequence, v)
+		walkBlock(node.Alternative, v)
+
+	case *TryExpression:
+		walkBlock(node.Block, v)
+		walkIdentifier(node.Param, v)
+		walkBlock(node.Catch, v)
+
+	case *FunctionLiteral:
+		for i, param := range node.Parameters {
+			walkIdentifier(param, v)
+			walkExpression(node.Default(i), v)
+		}
+		walkIdentifier(node.Rest, v)
+		walkBlock(node.Body, v)
+
+	case *CallExpression:
+		walkExpression(node.Function, v)
+		walkExpressions(node.Arguments, v)
+
+	case *ArrayLiteral:
+		walkExpressions(node.Elements, v)
+
+	case *IndexExpression:
+		walkExpression(node.Left, v)
+		walkExpression(node.Index, v)
+
+	case *HashLiteral:
+		for _, key := range node.Keys() {
+			walkExpression(key, v)
+			walkExpression(node.Pairs[key], v)
+		}
+
+	case *MacroLiteral:
+		for _, param := range node.Parameters {
+			walkIdentifier(param, v)
+		}
+		walkBlock(node.Body, v)
+	}
+
+	v.Visit(nil)
+}
+
+func walkStatements(statements []Statement, v Visitor) {
+	for _, statement := range statements {
+		if statement != nil {
+			Walk(statement, v)
+		}
+	}
+}
+
+func walkExpressions(expressions []Expression, v Visitor) {
+	for _, exp := range expressions {
+		walkExpression(exp, v)
+	}
+}
+
+func walkExpression(exp Expression, v Visitor) {
+	if exp != nil {
+		Walk(exp, v)
+	}
+}
+
+func walkIdentifier(ident *Identifier, v Visitor) {
+	if ident != nil {
+		Walk(ident, v)
+	}
+}
+
+func walkBlock(block *BlockStatement, v Visitor) {
+	if block != nil {
+		Walk(block, v)
+	}
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect traverses a tree in depth-first order, calling f for each node.
+// If f returns true, the children of the node are inspected, followed by a
+// call of f(nil)
+func Inspect(node Node, f func(Node) bool) {
+	Walk(node, inspector(f))
+}
@@ -0,0 +1,132 @@
+package ast
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/pwbrown/go-monkey/token"
+)
+
+// Build a tree covering most node types. Hash keys carry offsets, so their
+// pairs have a source order
+func walkTestProgram() *Program {
+	ident := func(name string) *Identifier {
+		return &Identifier{Token: token.Token{Type: token.IDENT, Literal: name}, Value: name}
+	}
+	integer := func(value int64, literal string, offset int) *IntegerLiteral {
+		t := token.Token{Type: token.INT, Literal: literal, Pos: token.Position{Offset: offset}}
+		return &IntegerLiteral{Token: t, Value: value}
+	}
+
+	return &Program{
+		Statements: []Statement{
+			&LetStatement{
+				Name: ident("f"),
+				Value: &FunctionLiteral{
+					Parameters: []*Identifier{ident("a"), ident("b")},
+					Defaults:   []Expression{nil, integer(1, "1", 0)},
+					Rest:       ident("rest"),
+					Body: &BlockStatement{
+						Statements: []Statement{
+							&ExpressionStatement{
+								Expression: &InfixExpression{Left: ident("a"), Operator: "+", Right: ident("b")},
+							},
+						},
+					},
+				},
+			},
+			&ExpressionStatement{
+				Expression: &CallExpression{
+					Function: ident("f"),
+					Arguments: []Expression{
+						&HashLiteral{Pairs: map[Expression]Expression{
+							integer(3, "3", 20): ident("y"),
+							integer(2, "2", 10): ident("x"),
+						}},
+					},
+				},
+			},
+			&ReturnStatement{},
+		},
+	}
+}
+
+func TestInspect(t *testing.T) {
+	program := walkTestProgram()
+
+	leaves := []string{}
+	entered, left := 0, 0
+	Inspect(program, func(node Node) bool {
+		if node == nil {
+			left++
+			return false
+		}
+		entered++
+
+		switch node := node.(type) {
+		case *Identifier, *IntegerLiteral:
+			leaves = append(leaves, node.String())
+		}
+		return true
+	})
+
+	expected := []string{"f", "a", "b", "1", "rest", "a", "b", "f", "2", "x", "3", "y"}
+	if !reflect.DeepEqual(leaves, expected) {
+		t.Errorf("wrong order of leaves. want=%v, got=%v", expected, leaves)
+	}
+	if entered != left {
+		t.Errorf("f(nil) not called once per node. entered=%d, left=%d", entered, left)
+	}
+
+	// Returning false skips the children of a node
+	leaves = []string{}
+	Inspect(program, func(node Node) bool {
+		if ident, ok := node.(*Identifier); ok {
+			leaves = append(leaves, ident.Value)
+		}
+		_, isFunction := node.(*FunctionLiteral)
+		_, isHash := node.(*HashLiteral)
+		return !isFunction && !isHash
+	})
+
+	expected = []string{"f", "f"}
+	if !reflect.DeepEqual(leaves, expected) {
+		t.Errorf("wrong identifiers. want=%v, got=%v", expected, leaves)
+	}
+}
+
+// Count nodes of each depth, to check that Walk passes on the visitor
+// returned for each node
+type depthCounter struct {
+	depth  int
+	counts map[int]int
+}
+
+func (d *depthCounter) Visit(node Node) Visitor {
+	if node == nil {
+		return nil
+	}
+	d.counts[d.depth]++
+	return &depthCounter{depth: d.depth + 1, counts: d.counts}
+}
+
+func TestWalk(t *testing.T) {
+	program := walkTestProgram()
+	before := program.String()
+
+	counter := &depthCounter{counts: map[int]int{}}
+	Walk(program, counter)
+
+	// Program; let, call and return statements; their children
+	expected := map[int]int{0: 1, 1: 3, 2: 3}
+	for depth, count := range expected {
+		if counter.counts[depth] != count {
+			t.Errorf("wrong number of nodes at depth %d. want=%d, got=%d",
+				depth, count, counter.counts[depth])
+		}
+	}
+
+	if program.String() != before {
+		t.Errorf("walk modified the tree. want=%q, got=%q", before, program.String())
+	}
+}
@@ -0,0 +1,245 @@
+package code
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+type Instructions []byte
+
+type Opcode byte
+
+const (
+	OpConstant Opcode = iota
+	OpPop
+
+	// Arithmetic and comparison
+	OpAdd
+	OpSub
+	OpMul
+	OpDiv
+	OpMod
+	OpEqual
+	OpNotEqual
+	OpGreaterThan
+	OpLessThan
+	OpGreaterThanOrEqual
+	OpLessThanOrEqual
+
+	// Prefix operators
+	OpMinus
+	OpBang
+
+	// Literal values
+	OpTrue
+	OpFalse
+	OpNull
+
+	// Control flow
+	OpJumpNotTruthy
+	OpJump
+
+	// Error handling
+	OpTry    // install a handler for runtime errors, operand: position of the catch block
+	OpEndTry // remove the innermost handler
+
+	// Loops
+	OpIter       // replace a collection with an iterator, operand: number of loop names
+	OpIterNext   // pop an iterator and push its next value (and key), or jump at the end
+	OpStackDepth // push the depth of the current frame's stack
+	OpUnwind     // pop a depth and drop the values above it, for break and continue
+
+	// Bindings
+	OpGetGlobal
+	OpSetGlobal
+	OpGetLocal
+	OpSetLocal
+	OpGetBuiltin
+	OpGetFree
+	OpCurrentClosure
+	OpGetLocalCell // push the value of a local shared with closures
+	OpSetLocalCell // pop a value into a local shared with closures
+	OpLocalCell    // push the cell of a local, for a closure to capture it
+	OpGetFreeCell  // push the value of a captured variable that can be assigned
+	OpSetFreeCell  // pop a value into a captured variable
+
+	// Composite values
+	OpArray
+	OpHash
+	OpIndex
+	OpSetIndex // assign to an element, operand: the opcode combining it with the value, 0 for =
+
+	// Functions
+	OpCall
+	OpReturnValue
+	OpReturn
+	OpClosure
+)
+
+// Definition of an opcode with a readable name and the byte width of each operand
+type Definition struct {
+	Name          string
+	OperandWidths []int
+}
+
+var definitions = map[Opcode]*Definition{
+	OpConstant:           {"OpConstant", []int{2}},
+	OpPop:                {"OpPop", []int{}},
+	OpAdd:                {"OpAdd", []int{}},
+	OpSub:                {"OpSub", []int{}},
+	OpMul:                {"OpMul", []int{}},
+	OpDiv:                {"OpDiv", []int{}},
+	OpMod:                {"OpMod", []int{}},
+	OpEqual:              {"OpEqual", []int{}},
+	OpNotEqual:           {"OpNotEqual", []int{}},
+	OpGreaterThan:        {"OpGreaterThan", []int{}},
+	OpLessThan:           {"OpLessThan", []int{}},
+	OpGreaterThanOrEqual: {"OpGreaterThanOrEqual", []int{}},
+	OpLessThanOrEqual:    {"OpLessThanOrEqual", []int{}},
+	OpMinus:              {"OpMinus", []int{}},
+	OpBang:               {"OpBang", []int{}},
+	OpTrue:               {"OpTrue", []int{}},
+	OpFalse:              {"OpFalse", []int{}},
+	OpNull:               {"OpNull", []int{}},
+	OpJumpNotTruthy:      {"OpJumpNotTruthy", []int{2}},
+	OpJump:               {"OpJump", []int{2}},
+	OpTry:                {"OpTry", []int{2}},
+	OpEndTry:             {"OpEndTry", []int{}},
+	OpIter:               {"OpIter", []int{1}},
+	OpIterNext:           {"OpIterNext", []int{2}},
+	OpStackDepth:         {"OpStackDepth", []int{}},
+	OpUnwind:             {"OpUnwind", []int{}},
+	OpGetGlobal:          {"OpGetGlobal", []int{2}},
+	OpSetGlobal:          {"OpSetGlobal", []int{2}},
+	OpGetLocal:           {"OpGetLocal", []int{1}},
+	OpSetLocal:           {"OpSetLocal", []int{1}},
+	OpGetBuiltin:         {"OpGetBuiltin", []int{1}},
+	OpGetFree:            {"OpGetFree", []int{1}},
+	OpCurrentClosure:     {"OpCurrentClosure", []int{}},
+	OpGetLocalCell:       {"OpGetLocalCell", []int{1}},
+	OpSetLocalCell:       {"OpSetLocalCell", []int{1}},
+	OpLocalCell:          {"OpLocalCell", []int{1}},
+	OpGetFreeCell:        {"OpGetFreeCell", []int{1}},
+	OpSetFreeCell:        {"OpSetFreeCell", []int{1}},
+	OpArray:              {"OpArray", []int{2}},
+	OpHash:               {"OpHash", []int{2}},
+	OpIndex:              {"OpIndex", []int{}},
+	OpSetIndex:           {"OpSetIndex", []int{1}},
+	OpCall:               {"OpCall", []int{1}},
+	OpReturnValue:        {"OpReturnValue", []int{}},
+	OpReturn:             {"OpReturn", []int{}},
+	OpClosure:            {"OpClosure", []int{2, 1}},
+}
+
+// Lookup the definition of an opcode
+func Lookup(op byte) (*Definition, error) {
+	def, ok := definitions[Opcode(op)]
+	if !ok {
+		return nil, fmt.Errorf("opcode %d undefined", op)
+	}
+
+	return def, nil
+}
+
+// Encode an opcode and its operands as a single instruction
+func Make(op Opcode, operands ...int) []byte {
+	def, ok := definitions[op]
+	if !ok {
+		return []byte{}
+	}
+
+	instructionLen := 1
+	for _, w := range def.OperandWidths {
+		instructionLen += w
+	}
+
+	instruction := make([]byte, instructionLen)
+	instruction[0] = byte(op)
+
+	offset := 1
+	for i, o := range operands {
+		width := def.OperandWidths[i]
+		switch width {
+		case 2:
+			binary.BigEndian.PutUint16(instruction[offset:], uint16(o))
+		case 1:
+			instruction[offset] = byte(o)
+		}
+		offset += width
+	}
+
+	return instruction
+}
+
+// Decode the operands of an instruction and return them with the number of bytes read
+func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
+	operands := make([]int, len(def.OperandWidths))
+	offset := 0
+
+	for i, width := range def.OperandWidths {
+		switch width {
+		case 2:
+			operands[i] = int(ReadUint16(ins[offset:]))
+		case 1:
+			operands[i] = int(ReadUint8(ins[offset:]))
+		}
+		offset += width
+	}
+
+	return operands, offset
+}
+
+// Read a big endian two byte operand
+func ReadUint16(ins Instructions) uint16 {
+	return binary.BigEndian.Uint16(ins)
+}
+
+// Read a single byte operand
+func ReadUint8(ins Instructions) uint8 {
+	return uint8(ins[0])
+}
+
+// Disassemble the instructions, one per line prefixed with its offset
+func (ins Instructions) String() string {
+	var out bytes.Buffer
+
+	i := 0
+	for i < len(ins) {
+		def, err := Lookup(ins[i])
+		if err != nil {
+			fmt.Fprintf(&out, "ERROR: %s\n", err)
+			i += 1
+			continue
+		}
+
+		operands, read := ReadOperands(def, ins[i+1:])
+
+		fmt.Fprintf(&out, "%04d %s\n", i, ins.fmtInstruction(def, operands))
+
+		i += 1 + read
+	}
+
+	return out.String()
+}
+
+// Format a single instruction
+func (ins Instructions) fmtInstruction(def *Definition, operands []int) string {
+	operandCount := len(def.OperandWidths)
+
+	if len(operands) != operandCount {
+		return fmt.Sprintf("ERROR: operand len %d does not match defined %d\n",
+			len(operands), operandCount)
+	}
+
+	switch operandCount {
+	case 0:
+		return def.Name
+	case 1:
+		return fmt.Sprintf("%s %d", def.Name, operands[0])
+	case 2:
+		return fmt.Sprintf("%s %d %d", def.Name, operands[0], operands[1])
+	}
+
+	return fmt.Sprintf("ERROR: unhandled operandCount for %s\n", def.Name)
+}
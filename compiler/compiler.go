@@ -0,0 +1,856 @@
+package compiler
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/pwbrown/go-monkey/ast"
+	"github.com/pwbrown/go-monkey/code"
+	"github.com/pwbrown/go-monkey/object"
+)
+
+// Instruction emitted most recently within a scope
+type EmittedInstruction struct {
+	Opcode   code.Opcode
+	Position int
+}
+
+// Instructions of a single function (or the main program) being compiled
+type CompilationScope struct {
+	instructions        code.Instructions
+	lastInstruction     EmittedInstruction
+	previousInstruction EmittedInstruction
+	loops               []*loopScope // loops enclosing the current instruction
+	tries               int          // try blocks enclosing the current instruction
+}
+
+// A loop being compiled, with the jumps of its break statements, which are
+// patched once the end of the loop is known
+type loopScope struct {
+	start  int // target of continue statements
+	breaks []int
+	tries  int     // try blocks entered before the loop, which break and continue stay in
+	depth  *Symbol // stack depth at the start of the loop, nil without break or continue
+}
+
+type Compiler struct {
+	constants []object.Object
+
+	symbolTable *SymbolTable
+
+	scopes     []CompilationScope
+	scopeIndex int
+}
+
+// The compiled program handed to the virtual machine
+type Bytecode struct {
+	Instructions code.Instructions
+	Constants    []object.Object
+	GlobalNames  []string // names of global bindings, by index
+}
+
+// Opcodes combining the current and assigned values of compound assignments.
+// Plain assignment has no entry and looks up as 0, the OpSetIndex operand for =
+var compoundOperators = map[string]code.Opcode{
+	"+=": code.OpAdd,
+	"-=": code.OpSub,
+	"*=": code.OpMul,
+	"/=": code.OpDiv,
+}
+
+// Create a new compiler with a fresh symbol table and constants pool
+func New() *Compiler {
+	mainScope := CompilationScope{
+		instructions:        code.Instructions{},
+		lastInstruction:     EmittedInstruction{},
+		previousInstruction: EmittedInstruction{},
+	}
+
+	symbolTable := NewSymbolTable()
+	for i, v := range object.Builtins {
+		symbolTable.DefineBuiltin(i, v.Name)
+	}
+
+	return &Compiler{
+		constants:   []object.Object{},
+		symbolTable: symbolTable,
+		scopes:      []CompilationScope{mainScope},
+		scopeIndex:  0,
+	}
+}
+
+// Create a compiler that continues from an existing symbol table and
+// constants pool (e.g. between lines of the REPL)
+func NewWithState(s *SymbolTable, constants []object.Object) *Compiler {
+	compiler := New()
+	compiler.symbolTable = s
+	compiler.constants = constants
+	return compiler
+}
+
+// Compile an AST node into the current scope
+func (c *Compiler) Compile(node ast.Node) error {
+	switch node := node.(type) {
+	// Statements
+	case *ast.Program:
+		for _, s := range node.Statements {
+			if err := c.Compile(s); err != nil {
+				return err
+			}
+		}
+	case *ast.ExpressionStatement:
+		if err := c.Compile(node.Expression); err != nil {
+			return err
+		}
+		c.emit(code.OpPop)
+	case *ast.BlockStatement:
+		for _, s := range node.Statements {
+			if err := c.Compile(s); err != nil {
+				return err
+			}
+		}
+	case *ast.LetStatement:
+		symbol := c.symbolTable.Define(node.Name.Value)
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+		c.emitSetSymbol(symbol)
+	case *ast.ReturnStatement:
+		if err := c.Compile(node.ReturnValue); err != nil {
+			return err
+		}
+		c.emit(code.OpReturnValue)
+	case *ast.WhileStatement:
+		depth := c.saveStackDepth(node.Body)
+		start := len(c.currentInstructions())
+
+		if err := c.Compile(node.Condition); err != nil {
+			return err
+		}
+		jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+		if err := c.compileLoopBody(start, depth, node.Body); err != nil {
+			return err
+		}
+		c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions()))
+	case *ast.ForStatement:
+		if err := c.compileForStatement(node); err != nil {
+			return err
+		}
+	case *ast.BreakStatement:
+		loop := c.currentLoop()
+		if loop == nil {
+			return c.errorf(node, "break is not in a loop")
+		}
+		c.leaveTries(loop)
+		c.unwindStack(loop)
+		loop.breaks = append(loop.breaks, c.emit(code.OpJump, 9999))
+	case *ast.ContinueStatement:
+		loop := c.currentLoop()
+		if loop == nil {
+			return c.errorf(node, "continue is not in a loop")
+		}
+		c.leaveTries(loop)
+		c.unwindStack(loop)
+		c.emit(code.OpJump, loop.start)
+
+	// Expressions
+	case *ast.AssignExpression:
+		if err := c.compileAssignExpression(node); err != nil {
+			return err
+		}
+	case *ast.PrefixExpression:
+		if err := c.Compile(node.Right); err != nil {
+			return err
+		}
+
+		switch node.Operator {
+		case "!":
+			c.emit(code.OpBang)
+		case "-":
+			c.emit(code.OpMinus)
+		default:
+			return c.errorf(node, "unknown operator %s", node.Operator)
+		}
+	case *ast.InfixExpression:
+		if node.Operator == "&&" || node.Operator == "||" {
+			return c.compileLogicalExpression(node)
+		}
+
+		if err := c.Compile(node.Left); err != nil {
+			return err
+		}
+		if err := c.Compile(node.Right); err != nil {
+			return err
+		}
+
+		switch node.Operator {
+		case "+":
+			c.emit(code.OpAdd)
+		case "-":
+			c.emit(code.OpSub)
+		case "*":
+			c.emit(code.OpMul)
+		case "/":
+			c.emit(code.OpDiv)
+		case "%":
+			c.emit(code.OpMod)
+		case ">":
+			c.emit(code.OpGreaterThan)
+		case "<":
+			c.emit(code.OpLessThan)
+		case ">=":
+			c.emit(code.OpGreaterThanOrEqual)
+		case "<=":
+			c.emit(code.OpLessThanOrEqual)
+		case "==":
+			c.emit(code.OpEqual)
+		case "!=":
+			c.emit(code.OpNotEqual)
+		default:
+			return c.errorf(node, "unknown operator %s", node.Operator)
+		}
+	case *ast.IfExpression:
+		if err := c.Compile(node.Condition); err != nil {
+			return err
+		}
+
+		// Emit with a bogus offset, patched once the consequence is compiled
+		jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+		if err := c.compileBlockValue(node.Consequence); err != nil {
+			return err
+		}
+
+		jumpPos := c.emit(code.OpJump, 9999)
+
+		afterConsequencePos := len(c.currentInstructions())
+		c.changeOperand(jumpNotTruthyPos, afterConsequencePos)
+
+		if node.Alternative == nil {
+			c.emit(code.OpNull)
+		} else {
+			if err := c.compileBlockValue(node.Alternative); err != nil {
+				return err
+			}
+		}
+
+		afterAlternativePos := len(c.currentInstructions())
+		c.changeOperand(jumpPos, afterAlternativePos)
+	case *ast.TryExpression:
+		if err := c.compileTryExpression(node); err != nil {
+			return err
+		}
+	case *ast.FunctionLiteral:
+		if node.Defaults != nil || node.Rest != nil {
+			return c.errorf(node, "default and rest parameters are not supported by the compiler")
+		}
+
+		c.enterScope()
+		c.symbolTable.cells = sharedVariables(node)
+
+		if node.Name != "" {
+			c.symbolTable.DefineFunctionName(node.Name)
+		}
+
+		for _, p := range node.Parameters {
+			c.symbolTable.Define(p.Value)
+		}
+
+		if err := c.Compile(node.Body); err != nil {
+			return err
+		}
+
+		if c.lastInstructionIs(code.OpPop) {
+			c.replaceLastPopWithReturn()
+		}
+		if !c.lastInstructionIs(code.OpReturnValue) {
+			c.emit(code.OpReturn)
+		}
+
+		freeSymbols := c.symbolTable.FreeSymbols
+		numLocals := c.symbolTable.numDefinitions
+		instructions := c.leaveScope()
+
+		for _, s := range freeSymbols {
+			c.loadCapture(s)
+		}
+
+		compiledFn := &object.CompiledFunction{
+			Instructions:  instructions,
+			NumLocals:     numLocals,
+			NumParameters: len(node.Parameters),
+		}
+
+		fnIndex := c.addConstant(compiledFn)
+		c.emit(code.OpClosure, fnIndex, len(freeSymbols))
+	case *ast.CallExpression:
+		if node.Function.TokenLiteral() == "quote" {
+			return c.errorf(node, "quote is not supported by the compiler")
+		}
+
+		if err := c.Compile(node.Function); err != nil {
+			return err
+		}
+
+		for _, a := range node.Arguments {
+			if err := c.Compile(a); err != nil {
+				return err
+			}
+		}
+
+		c.emit(code.OpCall, len(node.Arguments))
+	case *ast.ArrayLiteral:
+		for _, el := range node.Elements {
+			if err := c.Compile(el); err != nil {
+				return err
+			}
+		}
+
+		c.emit(code.OpArray, len(node.Elements))
+	case *ast.HashLiteral:
+		keys := []ast.Expression{}
+		for k := range node.Pairs {
+			keys = append(keys, k)
+		}
+
+		// Sort the keys so the emitted bytecode is deterministic
+		sort.Slice(keys, func(i, j int) bool {
+			return keys[i].String() < keys[j].String()
+		})
+
+		for _, k := range keys {
+			if err := c.Compile(k); err != nil {
+				return err
+			}
+			if err := c.Compile(node.Pairs[k]); err != nil {
+				return err
+			}
+		}
+
+		c.emit(code.OpHash, len(node.Pairs)*2)
+	case *ast.IndexExpression:
+		if err := c.Compile(node.Left); err != nil {
+			return err
+		}
+		if err := c.Compile(node.Index); err != nil {
+			return err
+		}
+
+		c.emit(code.OpIndex)
+	case *ast.Identifier:
+		symbol, ok := c.symbolTable.Resolve(node.Value)
+		if !ok {
+			// The name may still be bound by a later top-level let (or never
+			// be reached), so defer the "identifier not found" to runtime
+			symbol = c.symbolTable.Global().Define(node.Value)
+		}
+
+		c.loadSymbol(symbol)
+	case *ast.IntegerLiteral:
+		integer := &object.Integer{Value: node.Value}
+		c.emit(code.OpConstant, c.addConstant(integer))
+	case *ast.FloatLiteral:
+		float := &object.Float{Value: node.Value}
+		c.emit(code.OpConstant, c.addConstant(float))
+	case *ast.StringLiteral:
+		str := &object.String{Value: node.Value}
+		c.emit(code.OpConstant, c.addConstant(str))
+	case *ast.Boolean:
+		if node.Value {
+			c.emit(code.OpTrue)
+		} else {
+			c.emit(code.OpFalse)
+		}
+	case *ast.MacroLiteral:
+		return c.errorf(node, "macro literals must be expanded before compiling")
+	}
+
+	return nil
+}
+
+// Return the compiled program
+func (c *Compiler) Bytecode() *Bytecode {
+	return &Bytecode{
+		Instructions: c.currentInstructions(),
+		Constants:    c.constants,
+		GlobalNames:  c.symbolTable.Global().GlobalNames(),
+	}
+}
+
+// Return the symbol table of the current scope
+func (c *Compiler) SymbolTable() *SymbolTable {
+	return c.symbolTable
+}
+
+// Compile an assignment to an existing binding, leaving the assigned value
+// on the stack
+func (c *Compiler) compileAssignExpression(node *ast.AssignExpression) error {
+	switch target := node.Target.(type) {
+	case *ast.Identifier:
+		return c.compileIdentifierAssignment(node, target)
+	case *ast.IndexExpression:
+		return c.compileIndexAssignment(node, target)
+	default:
+		return c.errorf(node.Target, "cannot assign to %s", node.Target.String())
+	}
+}
+
+func (c *Compiler) compileIdentifierAssignment(node *ast.AssignExpression, ident *ast.Identifier) error {
+	symbol, ok := c.symbolTable.Resolve(ident.Value)
+	if !ok {
+		// Like reading an unbound name, report it at runtime
+		symbol = c.symbolTable.Global().Define(ident.Value)
+	}
+
+	switch symbol.Scope {
+	case BuiltinScope:
+		return c.errorf(node.Target, "cannot assign to builtin: %s", ident.Value)
+	case FreeScope, FunctionScope:
+		// Captured variables that are assigned are kept in cells. Inside a
+		// function, its own name is the closure being called
+		if !symbol.Cell {
+			return c.errorf(node.Target, "assigning to function %s inside its body is not supported by the compiler", ident.Value)
+		}
+	}
+
+	// Reading the current value raises "identifier not found" for a global
+	// that is not bound yet, locals are always bound
+	if node.Operator != "=" || symbol.Scope == GlobalScope {
+		c.loadSymbol(symbol)
+	}
+	if node.Operator == "=" && symbol.Scope == GlobalScope {
+		c.emit(code.OpPop)
+	}
+
+	if err := c.Compile(node.Value); err != nil {
+		return err
+	}
+
+	if op, ok := compoundOperators[node.Operator]; ok {
+		c.emit(op)
+	}
+
+	c.emitSetSymbol(symbol)
+	c.loadSymbol(symbol)
+
+	return nil
+}
+
+// Assign to an element of an array or hash. The collection, index and value
+// are left on the stack for OpSetIndex, which pushes the assigned value
+func (c *Compiler) compileIndexAssignment(node *ast.AssignExpression, target *ast.IndexExpression) error {
+	if err := c.Compile(target.Left); err != nil {
+		return err
+	}
+
+	if err := c.Compile(target.Index); err != nil {
+		return err
+	}
+
+	if err := c.Compile(node.Value); err != nil {
+		return err
+	}
+
+	c.emit(code.OpSetIndex, int(compoundOperators[node.Operator]))
+
+	return nil
+}
+
+// Compile && or || so that the right operand is skipped when the left one
+// decides the result. The operand deciding the result is converted to a
+// boolean with a double OpBang
+func (c *Compiler) compileLogicalExpression(node *ast.InfixExpression) error {
+	if err := c.Compile(node.Left); err != nil {
+		return err
+	}
+
+	jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+	// && continues with the right operand if the left one is truthy,
+	// || only if it is not
+	if node.Operator == "||" {
+		c.emit(code.OpTrue)
+		jumpPos := c.emit(code.OpJump, 9999)
+		c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions()))
+
+		if err := c.Compile(node.Right); err != nil {
+			return err
+		}
+		c.emit(code.OpBang)
+		c.emit(code.OpBang)
+
+		c.changeOperand(jumpPos, len(c.currentInstructions()))
+		return nil
+	}
+
+	if err := c.Compile(node.Right); err != nil {
+		return err
+	}
+	c.emit(code.OpBang)
+	c.emit(code.OpBang)
+	jumpPos := c.emit(code.OpJump, 9999)
+
+	c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions()))
+	c.emit(code.OpFalse)
+
+	c.changeOperand(jumpPos, len(c.currentInstructions()))
+	return nil
+}
+
+// Compile a for loop. The iterator is kept in a hidden binding, named so that
+// it cannot clash with an identifier, one per level of nesting
+func (c *Compiler) compileForStatement(node *ast.ForStatement) error {
+	if err := c.Compile(node.Iterable); err != nil {
+		return err
+	}
+
+	names := 1
+	if node.Key != nil {
+		names = 2
+	}
+	c.emit(code.OpIter, names)
+
+	iterator := c.symbolTable.Define(fmt.Sprintf("$iter%d", len(c.scopes[c.scopeIndex].loops)))
+	c.emitSetSymbol(iterator)
+
+	depth := c.saveStackDepth(node.Body)
+	start := len(c.currentInstructions())
+	c.loadSymbol(iterator)
+	iterNextPos := c.emit(code.OpIterNext, 9999)
+
+	// The key is pushed last, on top of the value
+	if node.Key != nil {
+		c.emitSetSymbol(c.symbolTable.Define(node.Key.Value))
+	}
+	c.emitSetSymbol(c.symbolTable.Define(node.Value.Value))
+
+	if err := c.compileLoopBody(start, depth, node.Body); err != nil {
+		return err
+	}
+	c.changeOperand(iterNextPos, len(c.currentInstructions()))
+
+	return nil
+}
+
+// Compile the body of a loop followed by the jump back to its start, then
+// patch the break statements to jump past the loop
+func (c *Compiler) compileLoopBody(start int, depth *Symbol, body *ast.BlockStatement) error {
+	loop := &loopScope{start: start, tries: c.scopes[c.scopeIndex].tries, depth: depth}
+	c.scopes[c.scopeIndex].loops = append(c.scopes[c.scopeIndex].loops, loop)
+
+	if err := c.Compile(body); err != nil {
+		return err
+	}
+	c.emit(code.OpJump, start)
+
+	loops := c.scopes[c.scopeIndex].loops
+	c.scopes[c.scopeIndex].loops = loops[:len(loops)-1]
+
+	end := len(c.currentInstructions())
+	for _, pos := range loop.breaks {
+		c.changeOperand(pos, end)
+	}
+
+	return nil
+}
+
+// Return the innermost loop of the current scope, or nil
+// Save the depth of the stack before a loop whose body has a break or
+// continue, in a hidden binding. They may be nested in an expression, such as
+// an if used as an operand, whose other operands are then left on the stack
+func (c *Compiler) saveStackDepth(body *ast.BlockStatement) *Symbol {
+	found := false
+	ast.Inspect(body, func(node ast.Node) bool {
+		switch node.(type) {
+		case *ast.BreakStatement, *ast.ContinueStatement:
+			found = true
+		case *ast.FunctionLiteral:
+			return false
+		}
+		return !found
+	})
+	if !found {
+		return nil
+	}
+
+	depth := c.symbolTable.Define(fmt.Sprintf("$depth%d", len(c.scopes[c.scopeIndex].loops)))
+	c.emit(code.OpStackDepth)
+	c.emitSetSymbol(depth)
+	return &depth
+}
+
+// Drop the values pushed since the start of a loop that a break or continue
+// jumps to
+func (c *Compiler) unwindStack(loop *loopScope) {
+	if loop.depth != nil {
+		c.loadSymbol(*loop.depth)
+		c.emit(code.OpUnwind)
+	}
+}
+
+// Remove the handlers of the try blocks that a break or continue jumps out of
+func (c *Compiler) leaveTries(loop *loopScope) {
+	for i := loop.tries; i < c.scopes[c.scopeIndex].tries; i++ {
+		c.emit(code.OpEndTry)
+	}
+}
+
+// Compile a try/catch expression. The VM jumps to the catch block with the
+// caught error on the stack, which is bound to the catch parameter
+func (c *Compiler) compileTryExpression(node *ast.TryExpression) error {
+	tryPos := c.emit(code.OpTry, 9999)
+
+	c.scopes[c.scopeIndex].tries++
+	err := c.compileBlockValue(node.Block)
+	c.scopes[c.scopeIndex].tries--
+	if err != nil {
+		return err
+	}
+
+	c.emit(code.OpEndTry)
+	jumpPos := c.emit(code.OpJump, 9999)
+
+	c.changeOperand(tryPos, len(c.currentInstructions()))
+	c.emitSetSymbol(c.symbolTable.Define(node.Param.Value))
+
+	if err := c.compileBlockValue(node.Catch); err != nil {
+		return err
+	}
+
+	c.changeOperand(jumpPos, len(c.currentInstructions()))
+
+	return nil
+}
+
+func (c *Compiler) currentLoop() *loopScope {
+	loops := c.scopes[c.scopeIndex].loops
+	if len(loops) == 0 {
+		return nil
+	}
+	return loops[len(loops)-1]
+}
+
+// Compile the block of an if expression so it always leaves one value on the stack
+func (c *Compiler) compileBlockValue(block *ast.BlockStatement) error {
+	if err := c.Compile(block); err != nil {
+		return err
+	}
+
+	var last ast.Statement
+	if len(block.Statements) > 0 {
+		last = block.Statements[len(block.Statements)-1]
+	}
+
+	switch last.(type) {
+	case *ast.ExpressionStatement:
+		c.removeLastPop()
+	case *ast.ReturnStatement:
+		// Control never reaches the end of the block
+	default:
+		c.emit(code.OpNull)
+	}
+
+	return nil
+}
+
+// Emit an instruction that pushes the value of a symbol
+func (c *Compiler) loadSymbol(s Symbol) {
+	switch s.Scope {
+	case GlobalScope:
+		c.emit(code.OpGetGlobal, s.Index)
+	case LocalScope:
+		if s.Cell {
+			c.emit(code.OpGetLocalCell, s.Index)
+		} else {
+			c.emit(code.OpGetLocal, s.Index)
+		}
+	case BuiltinScope:
+		c.emit(code.OpGetBuiltin, s.Index)
+	case FreeScope:
+		if s.Cell {
+			c.emit(code.OpGetFreeCell, s.Index)
+		} else {
+			c.emit(code.OpGetFree, s.Index)
+		}
+	case FunctionScope:
+		c.emit(code.OpCurrentClosure)
+	}
+}
+
+// Emit an instruction that pops the top of the stack into a symbol
+func (c *Compiler) emitSetSymbol(s Symbol) {
+	switch {
+	case s.Scope == GlobalScope:
+		c.emit(code.OpSetGlobal, s.Index)
+	case s.Scope == FreeScope:
+		c.emit(code.OpSetFreeCell, s.Index)
+	case s.Cell:
+		c.emit(code.OpSetLocalCell, s.Index)
+	default:
+		c.emit(code.OpSetLocal, s.Index)
+	}
+}
+
+// Emit an instruction that pushes a variable for a closure to capture: the
+// cell of a variable that can be assigned, or else its value
+func (c *Compiler) loadCapture(s Symbol) {
+	switch {
+	case s.Cell && s.Scope == LocalScope:
+		c.emit(code.OpLocalCell, s.Index)
+	case s.Cell && s.Scope == FreeScope:
+		c.emit(code.OpGetFree, s.Index)
+	default:
+		c.loadSymbol(s)
+	}
+}
+
+// Return the names of the variables of a function that are kept in cells:
+// those assigned somewhere in its body and used by a function nested in it.
+// The function and its closures then share the variable instead of holding
+// copies, as the evaluator's environments do
+func sharedVariables(fn *ast.FunctionLiteral) map[string]bool {
+	assigned := map[string]bool{}
+	captured := map[string]bool{}
+
+	ast.Inspect(fn.Body, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.AssignExpression:
+			if ident, ok := node.Target.(*ast.Identifier); ok {
+				assigned[ident.Value] = true
+			}
+		case *ast.FunctionLiteral:
+			ast.Inspect(node.Body, func(node ast.Node) bool {
+				if ident, ok := node.(*ast.Identifier); ok {
+					captured[ident.Value] = true
+				}
+				return true
+			})
+		}
+		return true
+	})
+
+	cells := map[string]bool{}
+	for name := range assigned {
+		if captured[name] {
+			cells[name] = true
+		}
+	}
+	return cells
+}
+
+// Add a constant to the pool and return its index
+func (c *Compiler) addConstant(obj object.Object) int {
+	c.constants = append(c.constants, obj)
+	return len(c.constants) - 1
+}
+
+// Emit an instruction and return its position
+func (c *Compiler) emit(op code.Opcode, operands ...int) int {
+	ins := code.Make(op, operands...)
+	pos := c.addInstruction(ins)
+
+	c.setLastInstruction(op, pos)
+
+	return pos
+}
+
+// Append an instruction to the current scope and return its position
+func (c *Compiler) addInstruction(ins []byte) int {
+	posNewInstruction := len(c.currentInstructions())
+	updatedInstructions := append(c.currentInstructions(), ins...)
+
+	c.scopes[c.scopeIndex].instructions = updatedInstructions
+
+	return posNewInstruction
+}
+
+// Track the last two emitted instructions of the current scope
+func (c *Compiler) setLastInstruction(op code.Opcode, pos int) {
+	previous := c.scopes[c.scopeIndex].lastInstruction
+	last := EmittedInstruction{Opcode: op, Position: pos}
+
+	c.scopes[c.scopeIndex].previousInstruction = previous
+	c.scopes[c.scopeIndex].lastInstruction = last
+}
+
+// Check if the last emitted instruction has a specific opcode
+func (c *Compiler) lastInstructionIs(op code.Opcode) bool {
+	if len(c.currentInstructions()) == 0 {
+		return false
+	}
+
+	return c.scopes[c.scopeIndex].lastInstruction.Opcode == op
+}
+
+// Remove a trailing OpPop so the value stays on the stack
+func (c *Compiler) removeLastPop() {
+	last := c.scopes[c.scopeIndex].lastInstruction
+	previous := c.scopes[c.scopeIndex].previousInstruction
+
+	old := c.currentInstructions()
+	new := old[:last.Position]
+
+	c.scopes[c.scopeIndex].instructions = new
+	c.scopes[c.scopeIndex].lastInstruction = previous
+}
+
+// Turn a trailing OpPop into an implicit return of the value
+func (c *Compiler) replaceLastPopWithReturn() {
+	lastPos := c.scopes[c.scopeIndex].lastInstruction.Position
+	c.replaceInstruction(lastPos, code.Make(code.OpReturnValue))
+
+	c.scopes[c.scopeIndex].lastInstruction.Opcode = code.OpReturnValue
+}
+
+// Overwrite the instruction at a position with one of the same width
+func (c *Compiler) replaceInstruction(pos int, newInstruction []byte) {
+	ins := c.currentInstructions()
+
+	for i := 0; i < len(newInstruction); i++ {
+		ins[pos+i] = newInstruction[i]
+	}
+}
+
+// Change the operand of the instruction at a position
+func (c *Compiler) changeOperand(opPos int, operand int) {
+	op := code.Opcode(c.currentInstructions()[opPos])
+	newInstruction := code.Make(op, operand)
+
+	c.replaceInstruction(opPos, newInstruction)
+}
+
+// Return the instructions of the current scope
+func (c *Compiler) currentInstructions() code.Instructions {
+	return c.scopes[c.scopeIndex].instructions
+}
+
+// Start compiling a new function
+func (c *Compiler) enterScope() {
+	scope := CompilationScope{
+		instructions:        code.Instructions{},
+		lastInstruction:     EmittedInstruction{},
+		previousInstruction: EmittedInstruction{},
+	}
+	c.scopes = append(c.scopes, scope)
+	c.scopeIndex++
+
+	c.symbolTable = NewEnclosedSymbolTable(c.symbolTable)
+}
+
+// Finish compiling a function and return its instructions
+func (c *Compiler) leaveScope() code.Instructions {
+	instructions := c.currentInstructions()
+
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.scopeIndex--
+
+	c.symbolTable = c.symbolTable.Outer
+
+	return instructions
+}
+
+// Format a compile error prefixed with the position of the offending node
+func (c *Compiler) errorf(node ast.Node, format string, a ...interface{}) error {
+	return fmt.Errorf("%s: %s", node.Pos(), fmt.Sprintf(format, a...))
+}
@@ -0,0 +1,63 @@
+package compiler
+
+import "testing"
+
+func TestDefineAndResolve(t *testing.T) {
+	global := NewSymbolTable()
+	a := global.Define("a")
+	global.DefineBuiltin(0, "len")
+
+	local := NewEnclosedSymbolTable(global)
+	b := local.Define("b")
+
+	nested := NewEnclosedSymbolTable(local)
+	c := nested.Define("c")
+
+	if a != (Symbol{Name: "a", Scope: GlobalScope, Index: 0}) {
+		t.Errorf("wrong global symbol. got=%+v", a)
+	}
+	if b != (Symbol{Name: "b", Scope: LocalScope, Index: 0}) {
+		t.Errorf("wrong local symbol. got=%+v", b)
+	}
+	if again := global.Define("a"); again != a {
+		t.Errorf("redefining a global should reuse its slot. got=%+v", again)
+	}
+
+	expected := []Symbol{
+		{Name: "a", Scope: GlobalScope, Index: 0},
+		{Name: "len", Scope: BuiltinScope, Index: 0},
+		{Name: "b", Scope: FreeScope, Index: 0},
+		c,
+	}
+
+	for _, sym := range expected {
+		result, ok := nested.Resolve(sym.Name)
+		if !ok {
+			t.Errorf("name %s not resolvable", sym.Name)
+			continue
+		}
+		if result != sym {
+			t.Errorf("expected %s to resolve to %+v, got=%+v", sym.Name, sym, result)
+		}
+	}
+
+	if len(nested.FreeSymbols) != 1 || nested.FreeSymbols[0] != b {
+		t.Errorf("wrong free symbols. got=%+v", nested.FreeSymbols)
+	}
+
+	if _, ok := nested.Resolve("unknown"); ok {
+		t.Errorf("name unknown resolved, but was expected not to")
+	}
+}
+
+func TestGlobalNames(t *testing.T) {
+	global := NewSymbolTable()
+	global.DefineBuiltin(0, "len")
+	global.Define("a")
+	global.Define("b")
+
+	names := NewEnclosedSymbolTable(global).Global().GlobalNames()
+	if len(names) != 2 || names[0] != "a" || names[1] != "b" {
+		t.Errorf("wrong global names. got=%v", names)
+	}
+}
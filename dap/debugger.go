@@ -0,0 +1,255 @@
+package dap
+
+import (
+	"sync"
+
+	"github.com/pwbrown/go-monkey/ast"
+	"github.com/pwbrown/go-monkey/object"
+	"github.com/pwbrown/go-monkey/token"
+)
+
+// How a paused program is resumed
+type stepMode int
+
+const (
+	runMode stepMode = iota
+	stepInMode
+	stepOverMode
+	stepOutMode
+)
+
+// A frame of the program's call stack. The outermost frame runs the
+// top level of the program
+type frame struct {
+	name string
+	env  *object.Environment
+	pos  token.Position // the statement or call being evaluated
+	last ast.Statement  // the last statement evaluated in the frame
+}
+
+// A debugger is an evaluator hook that pauses the program at breakpoints and
+// after steps. The evaluation runs on its own goroutine, which blocks while
+// the program is paused until the server resumes it
+type debugger struct {
+	mu          sync.Mutex
+	breakpoints map[int]bool // lines of the program
+	frames      []*frame
+	paused      bool
+	terminated  bool
+	pause       bool // pause at the next statement
+
+	// The step being made: its mode, the depth of the frame it started in
+	// and the statement it started from
+	mode      stepMode
+	reason    string
+	stepDepth int
+	stepStmt  ast.Statement
+
+	resume  chan struct{}
+	stopped func(reason string) // reports a pause, before blocking
+}
+
+func newDebugger(stopped func(string)) *debugger {
+	return &debugger{
+		breakpoints: map[int]bool{},
+		resume:      make(chan struct{}, 1),
+		stopped:     stopped,
+	}
+}
+
+// Prepare to debug a program evaluated in globals, pausing before its first
+// statement if stopOnEntry is set
+func (d *debugger) start(globals *object.Environment, stopOnEntry bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.frames = []*frame{{name: "main", env: globals}}
+	if stopOnEntry {
+		d.mode, d.reason, d.stepDepth = stepInMode, "entry", 0
+	}
+}
+
+// The error stopping a terminated program
+func terminatedError() *object.Error {
+	return &object.Error{Message: "evaluation canceled: debugger terminated the program", Kind: object.CANCELED_ERR}
+}
+
+func (d *debugger) Statement(stmt ast.Statement, env *object.Environment) *object.Error {
+	d.mu.Lock()
+
+	if d.terminated {
+		d.mu.Unlock()
+		return terminatedError()
+	}
+
+	pos := stmt.Pos()
+	top := d.frames[len(d.frames)-1]
+	top.env = env
+	if !pos.IsValid() {
+		// Statements built by macros have no place in the source
+		d.mu.Unlock()
+		return nil
+	}
+
+	last := top.last
+	top.pos, top.last = pos, stmt
+
+	reason := d.stopReason(stmt, last)
+	if reason == "" {
+		d.mu.Unlock()
+		return nil
+	}
+
+	d.paused, d.pause, d.mode = true, false, runMode
+	d.mu.Unlock()
+
+	d.stopped(reason)
+	<-d.resume
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.terminated {
+		return terminatedError()
+	}
+	return nil
+}
+
+// Decide whether to pause before a statement, and why. The last statement
+// evaluated in the same frame is used to pause only once at a line holding
+// a statement and the statements nested in it
+func (d *debugger) stopReason(stmt, last ast.Statement) string {
+	depth := len(d.frames)
+	sameLine := func(other ast.Statement) bool {
+		return other != nil && other.Pos().Line == stmt.Pos().Line && nested(stmt, other)
+	}
+
+	if d.pause {
+		return "pause"
+	}
+
+	switch d.mode {
+	case stepInMode:
+		if depth != d.stepDepth || !sameLine(d.stepStmt) {
+			return d.reason
+		}
+	case stepOverMode:
+		if depth < d.stepDepth || depth == d.stepDepth && !sameLine(d.stepStmt) {
+			return d.reason
+		}
+	case stepOutMode:
+		if depth < d.stepDepth {
+			return d.reason
+		}
+	}
+
+	if d.breakpoints[stmt.Pos().Line] && !sameLine(last) {
+		return "breakpoint"
+	}
+	return ""
+}
+
+// Report whether a statement is nested in another one
+func nested(stmt, outer ast.Statement) bool {
+	return stmt != outer &&
+		outer.Pos().Offset <= stmt.Pos().Offset &&
+		stmt.End().Offset <= outer.End().Offset
+}
+
+func (d *debugger) Call(fn *object.Function, env *object.Environment, pos token.Position) *object.Error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.terminated {
+		return terminatedError()
+	}
+
+	if pos.IsValid() {
+		d.frames[len(d.frames)-1].pos = pos
+	}
+
+	name := fn.Name
+	if name == "" {
+		name = "<anonymous>"
+	}
+	d.frames = append(d.frames, &frame{name: name, env: env, pos: fn.Body.Pos()})
+	return nil
+}
+
+func (d *debugger) Return(fn *object.Function, result object.Object) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.frames = d.frames[:len(d.frames)-1]
+}
+
+// Resume a paused program, making a step or running to the next breakpoint.
+// Returns false if the program is not paused
+func (d *debugger) resumeWith(mode stepMode) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if !d.paused {
+		return false
+	}
+
+	d.paused = false
+	d.mode, d.reason = mode, "step"
+	d.stepDepth = len(d.frames)
+	d.stepStmt = d.frames[len(d.frames)-1].last
+	d.resume <- struct{}{}
+	return true
+}
+
+func (d *debugger) isPaused() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.paused
+}
+
+// Pause the program at the next statement
+func (d *debugger) requestPause() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.pause = true
+}
+
+// Stop the program at the next statement or call, resuming it if it is paused
+func (d *debugger) terminate() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.terminated = true
+	if d.paused {
+		d.paused = false
+		d.resume <- struct{}{}
+	}
+}
+
+func (d *debugger) setBreakpoints(lines []int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.breakpoints = map[int]bool{}
+	for _, line := range lines {
+		d.breakpoints[line] = true
+	}
+}
+
+// Return a copy of the frames of a paused program, innermost first, or nil
+// if the program is running
+func (d *debugger) stack() []frame {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if !d.paused {
+		return nil
+	}
+
+	frames := []frame{}
+	for i := len(d.frames) - 1; i >= 0; i-- {
+		frames = append(frames, *d.frames[i])
+	}
+	return frames
+}
@@ -0,0 +1,491 @@
+// Package dap implements a debugger for Monkey programs speaking the Debug
+// Adapter Protocol, so that editors can set breakpoints, step through a
+// program and inspect its variables
+package dap
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pwbrown/go-monkey/ast"
+	"github.com/pwbrown/go-monkey/evaluator"
+	"github.com/pwbrown/go-monkey/internal/framing"
+	"github.com/pwbrown/go-monkey/lexer"
+	"github.com/pwbrown/go-monkey/object"
+	"github.com/pwbrown/go-monkey/parser"
+)
+
+// The only thread of a Monkey program
+const threadID = 1
+
+// A Server debugs one program for one client
+type Server struct {
+	in  *bufio.Reader
+	out io.Writer
+
+	mu  sync.Mutex // guards writes, seq and err
+	seq int
+	err error // first failure to write an event
+
+	debugger    *debugger
+	breakpoints map[string][]int // lines by source path
+
+	program    *ast.Program
+	path       string
+	stmtLines  map[int]bool // lines where a statement starts
+	builtins   *object.Environment
+	globals    *object.Environment
+	launched   bool
+	configured bool
+	running    bool
+	cancel     context.CancelFunc
+	done       chan struct{} // closed when the program has ended
+
+	// Values that can be expanded while the program is paused, by reference
+	// number minus one: environments, arrays and hashes
+	handles []interface{}
+}
+
+// Create a server reading requests from in and writing to out
+func NewServer(in io.Reader, out io.Writer) *Server {
+	s := &Server{
+		in:          bufio.NewReader(in),
+		out:         out,
+		breakpoints: map[string][]int{},
+	}
+	s.debugger = newDebugger(s.stopped)
+	return s
+}
+
+// Serve a client on a pair of streams, such as stdin and stdout
+func Serve(in io.Reader, out io.Writer) error {
+	return NewServer(in, out).Serve()
+}
+
+// Serve requests until the client disconnects or closes the input. A
+// running program is terminated first
+func (s *Server) Serve() error {
+	defer s.stop()
+
+	for {
+		content, err := framing.ReadMessage(s.in)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var req request
+		if err := json.Unmarshal(content, &req); err != nil {
+			return fmt.Errorf("invalid message: %s", err)
+		}
+
+		body, after, err := s.dispatch(&req)
+		res := response{Type: "response", RequestSeq: req.Seq, Success: err == nil, Command: req.Command, Body: body}
+		if err != nil {
+			res.Message = err.Error()
+			res.Body = nil
+		}
+		if err := s.send(&res); err != nil {
+			return err
+		}
+
+		if after != nil {
+			after()
+		}
+		if err := s.writeError(); err != nil {
+			return err
+		}
+		if req.Command == "disconnect" {
+			return nil
+		}
+	}
+}
+
+// Handle a request. The returned function, if any, runs after the response
+// is sent, so that events it causes follow the response
+func (s *Server) dispatch(req *request) (interface{}, func(), error) {
+	switch req.Command {
+	case "initialize":
+		capabilities := Capabilities{SupportsConfigurationDoneRequest: true, SupportsTerminateRequest: true}
+		return capabilities, func() { s.event("initialized", nil) }, nil
+
+	case "launch":
+		var args LaunchArguments
+		if err := decodeArguments(req, &args); err != nil {
+			return nil, nil, err
+		}
+		if err := s.launch(args); err != nil {
+			return nil, nil, err
+		}
+		return nil, s.startIfReady, nil
+
+	case "setBreakpoints":
+		var args SetBreakpointsArguments
+		if err := decodeArguments(req, &args); err != nil {
+			return nil, nil, err
+		}
+		return s.setBreakpoints(args), nil, nil
+
+	case "configurationDone":
+		s.configured = true
+		return nil, s.startIfReady, nil
+
+	case "threads":
+		return ThreadsResponseBody{Threads: []Thread{{ID: threadID, Name: "main"}}}, nil, nil
+
+	case "stackTrace":
+		var args StackTraceArguments
+		if err := decodeArguments(req, &args); err != nil {
+			return nil, nil, err
+		}
+		return s.stackTrace(args), nil, nil
+
+	case "scopes":
+		var args ScopesArguments
+		if err := decodeArguments(req, &args); err != nil {
+			return nil, nil, err
+		}
+		return s.scopes(args)
+
+	case "variables":
+		var args VariablesArguments
+		if err := decodeArguments(req, &args); err != nil {
+			return nil, nil, err
+		}
+		return s.variables(args)
+
+	case "continue":
+		after, err := s.resume(runMode)
+		return ContinueResponseBody{AllThreadsContinued: true}, after, err
+
+	case "next":
+		after, err := s.resume(stepOverMode)
+		return nil, after, err
+
+	case "stepIn":
+		after, err := s.resume(stepInMode)
+		return nil, after, err
+
+	case "stepOut":
+		after, err := s.resume(stepOutMode)
+		return nil, after, err
+
+	case "pause":
+		s.debugger.requestPause()
+		return nil, nil, nil
+
+	case "terminate", "disconnect":
+		s.stop()
+		return nil, nil, nil
+	}
+
+	return nil, nil, fmt.Errorf("unsupported request %q", req.Command)
+}
+
+func decodeArguments(req *request, args interface{}) error {
+	if len(req.Arguments) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(req.Arguments, args); err != nil {
+		return fmt.Errorf("invalid arguments: %s", err)
+	}
+	return nil
+}
+
+// Load the program to debug
+func (s *Server) launch(args LaunchArguments) error {
+	if s.launched {
+		return errors.New("a program is already launched")
+	}
+	if args.Program == "" {
+		return errors.New("missing program to debug")
+	}
+
+	source, err := os.ReadFile(args.Program)
+	if err != nil {
+		return err
+	}
+
+	p := parser.New(lexer.NewFile(args.Program, string(source)))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return errors.New(strings.Join(p.Errors(), "\n"))
+	}
+
+	macroEnv := object.NewEnvironment()
+	macroErrors := evaluator.DefineMacros(program, macroEnv)
+	expanded, expandErrors := evaluator.ExpandMacros(program, macroEnv)
+	macroErrors = append(macroErrors, expandErrors...)
+	if len(macroErrors) != 0 {
+		messages := []string{}
+		for _, err := range macroErrors {
+			messages = append(messages, err.Error())
+		}
+		return errors.New(strings.Join(messages, "\n"))
+	}
+
+	s.program = expanded.(*ast.Program)
+	s.path = filepath.Clean(args.Program)
+	s.stmtLines = map[int]bool{}
+	ast.Inspect(s.program, func(node ast.Node) bool {
+		if stmt, ok := node.(ast.Statement); ok && stmt.Pos().IsValid() {
+			if _, isBlock := stmt.(*ast.BlockStatement); !isBlock {
+				s.stmtLines[stmt.Pos().Line] = true
+			}
+		}
+		return true
+	})
+
+	// Output of the program is sent to the client
+	s.builtins = object.NewEnvironment()
+	s.builtins.Set("puts", &object.Builtin{Fn: func(args ...object.Object) object.Object {
+		for _, arg := range args {
+			s.event("output", OutputEventBody{Category: "stdout", Output: arg.Inspect() + "\n"})
+		}
+		return nil
+	}})
+	s.globals = object.NewEnclosedEnvironment(s.builtins)
+
+	s.debugger.start(s.globals, args.StopOnEntry)
+	s.debugger.setBreakpoints(s.breakpoints[s.path])
+	s.launched = true
+	return nil
+}
+
+// Run the program once it is launched and the client is configured
+func (s *Server) startIfReady() {
+	if !s.launched || !s.configured || s.running {
+		return
+	}
+	s.running = true
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.done = make(chan struct{})
+
+	go func() {
+		defer close(s.done)
+		defer cancel()
+
+		ctx := evaluator.WithHook(ctx, s.debugger)
+		result := evaluator.EvalContext(ctx, s.program, s.globals, object.Limits{})
+
+		exitCode := 0
+		if err, ok := result.(*object.Error); ok {
+			exitCode = 1
+			s.event("output", OutputEventBody{Category: "stderr", Output: err.Inspect() + "\n" + err.StackTrace()})
+		}
+		s.event("exited", ExitedEventBody{ExitCode: exitCode})
+		s.event("terminated", nil)
+	}()
+}
+
+// Terminate a running program and wait for it to end
+func (s *Server) stop() {
+	if !s.running {
+		return
+	}
+
+	s.debugger.terminate()
+	s.cancel()
+	<-s.done
+}
+
+func (s *Server) setBreakpoints(args SetBreakpointsArguments) SetBreakpointsResponseBody {
+	path := filepath.Clean(args.Source.Path)
+
+	lines := []int{}
+	breakpoints := []Breakpoint{}
+	for _, bp := range args.Breakpoints {
+		lines = append(lines, bp.Line)
+
+		breakpoint := Breakpoint{Verified: true, Line: bp.Line}
+		if s.launched && path == s.path && !s.stmtLines[bp.Line] {
+			breakpoint.Verified = false
+			breakpoint.Message = "no statement on this line"
+		}
+		breakpoints = append(breakpoints, breakpoint)
+	}
+
+	s.breakpoints[path] = lines
+	if s.launched && path == s.path {
+		s.debugger.setBreakpoints(lines)
+	}
+
+	return SetBreakpointsResponseBody{Breakpoints: breakpoints}
+}
+
+// Report that the program paused. Called on the program's goroutine
+func (s *Server) stopped(reason string) {
+	s.event("stopped", StoppedEventBody{Reason: reason, ThreadID: threadID, AllThreadsStopped: true})
+}
+
+// Return the function resuming a paused program once the response is sent.
+// References to values of the pause are dropped
+func (s *Server) resume(mode stepMode) (func(), error) {
+	if !s.debugger.isPaused() {
+		return nil, errors.New("the program is not paused")
+	}
+	s.handles = nil
+	return func() { s.debugger.resumeWith(mode) }, nil
+}
+
+func (s *Server) stackTrace(args StackTraceArguments) StackTraceResponseBody {
+	frames := s.debugger.stack()
+	source := &Source{Name: filepath.Base(s.path), Path: s.path}
+
+	stackFrames := []StackFrame{}
+	for i, f := range frames {
+		if i < args.StartFrame || args.Levels > 0 && len(stackFrames) == args.Levels {
+			continue
+		}
+		stackFrames = append(stackFrames, StackFrame{
+			ID:     i + 1,
+			Name:   f.name,
+			Source: source,
+			Line:   f.pos.Line,
+			Column: f.pos.Column,
+		})
+	}
+	return StackTraceResponseBody{StackFrames: stackFrames, TotalFrames: len(frames)}
+}
+
+// Return a scope for each environment of a frame, from its locals to the
+// globals of the program
+func (s *Server) scopes(args ScopesArguments) (interface{}, func(), error) {
+	frames := s.debugger.stack()
+	if args.FrameID < 1 || args.FrameID > len(frames) {
+		return nil, nil, fmt.Errorf("unknown frame %d", args.FrameID)
+	}
+
+	scopes := []Scope{}
+	for env := frames[args.FrameID-1].env; env != nil && env != s.builtins; env = env.Outer() {
+		name := "Closure"
+		switch {
+		case env == s.globals:
+			name = "Globals"
+		case len(scopes) == 0:
+			name = "Locals"
+		}
+		scopes = append(scopes, Scope{Name: name, VariablesReference: s.handle(env)})
+	}
+	return ScopesResponseBody{Scopes: scopes}, nil, nil
+}
+
+// Return the variables of an environment, or the elements of an array or
+// a hash
+func (s *Server) variables(args VariablesArguments) (interface{}, func(), error) {
+	if args.VariablesReference < 1 || args.VariablesReference > len(s.handles) {
+		return nil, nil, fmt.Errorf("unknown variables reference %d", args.VariablesReference)
+	}
+
+	variables := []Variable{}
+	switch value := s.handles[args.VariablesReference-1].(type) {
+	case *object.Environment:
+		for _, name := range value.Names() {
+			obj, _ := value.Get(name)
+			variables = append(variables, s.variable(name, obj))
+		}
+
+	case *object.Array:
+		for i, element := range value.Elements {
+			variables = append(variables, s.variable(strconv.Itoa(i), element))
+		}
+
+	case *object.Hash:
+		pairs := []object.HashPair{}
+		for _, pair := range value.Pairs {
+			pairs = append(pairs, pair)
+		}
+		sort.Slice(pairs, func(i, j int) bool { return pairs[i].Key.Inspect() < pairs[j].Key.Inspect() })
+		for _, pair := range pairs {
+			variables = append(variables, s.variable(pair.Key.Inspect(), pair.Value))
+		}
+	}
+	return VariablesResponseBody{Variables: variables}, nil, nil
+}
+
+// Describe a value. Arrays and hashes get a reference to their elements
+func (s *Server) variable(name string, obj object.Object) Variable {
+	v := Variable{Name: name, Value: obj.Inspect(), Type: string(obj.Type())}
+
+	switch obj := obj.(type) {
+	case *object.Array:
+		if len(obj.Elements) > 0 {
+			v.VariablesReference = s.handle(obj)
+		}
+	case *object.Hash:
+		if len(obj.Pairs) > 0 {
+			v.VariablesReference = s.handle(obj)
+		}
+	case *object.Function:
+		// The body of a function is too long to show
+		params := []string{}
+		for i, param := range obj.Parameters {
+			if i < len(obj.Defaults) && obj.Defaults[i] != nil {
+				params = append(params, param.String()+" = "+obj.Defaults[i].String())
+			} else {
+				params = append(params, param.String())
+			}
+		}
+		if obj.Rest != nil {
+			params = append(params, "..."+obj.Rest.String())
+		}
+		v.Value = fmt.Sprintf("fn(%s)", strings.Join(params, ", "))
+	}
+	return v
+}
+
+// Return a new reference to a value
+func (s *Server) handle(value interface{}) int {
+	s.handles = append(s.handles, value)
+	return len(s.handles)
+}
+
+// Send an event. Events are also sent by the running program, so the first
+// failure to write one is recorded for Serve to return
+func (s *Server) event(name string, body interface{}) {
+	if err := s.send(&event{Type: "event", Event: name, Body: body}); err != nil {
+		s.mu.Lock()
+		if s.err == nil {
+			s.err = err
+		}
+		s.mu.Unlock()
+	}
+}
+
+// Return the first failure to write an event
+func (s *Server) writeError() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.err
+}
+
+// Send a response or an event, numbering it
+func (s *Server) send(msg interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.seq++
+	switch msg := msg.(type) {
+	case *response:
+		msg.Seq = s.seq
+	case *event:
+		msg.Seq = s.seq
+	}
+
+	return framing.WriteMessage(s.out, msg)
+}
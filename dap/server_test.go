@@ -0,0 +1,435 @@
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pwbrown/go-monkey/internal/framing"
+)
+
+// A message received by the test client
+type testMessage struct {
+	Type       string          `json:"type"`
+	RequestSeq int             `json:"request_seq"`
+	Success    bool            `json:"success"`
+	Command    string          `json:"command"`
+	Message    string          `json:"message"`
+	Event      string          `json:"event"`
+	Body       json.RawMessage `json:"body"`
+}
+
+// A scripted DAP client talking to a server over pipes
+type testClient struct {
+	t        *testing.T
+	w        *io.PipeWriter
+	messages chan testMessage
+	events   []testMessage // received while waiting for a response
+	done     chan error
+	seq      int
+}
+
+func newTestClient(t *testing.T) *testClient {
+	clientIn, serverOut := io.Pipe()
+	serverIn, clientOut := io.Pipe()
+
+	c := &testClient{
+		t:        t,
+		w:        clientOut,
+		messages: make(chan testMessage, 100),
+		done:     make(chan error, 1),
+	}
+
+	go func() {
+		c.done <- Serve(serverIn, serverOut)
+		serverOut.Close()
+	}()
+
+	go func() {
+		r := bufio.NewReader(clientIn)
+		for {
+			content, err := framing.ReadMessage(r)
+			if err != nil {
+				close(c.messages)
+				return
+			}
+			var msg testMessage
+			if err := json.Unmarshal(content, &msg); err != nil {
+				t.Errorf("invalid message from server: %s", content)
+			}
+			c.messages <- msg
+		}
+	}()
+
+	return c
+}
+
+// Wait for the next message from the server
+func (c *testClient) receive() testMessage {
+	select {
+	case msg, ok := <-c.messages:
+		if !ok {
+			c.t.Fatalf("server closed the connection")
+		}
+		return msg
+	case <-time.After(5 * time.Second):
+		c.t.Fatalf("timed out waiting for the server")
+	}
+	return testMessage{}
+}
+
+// Send a request and wait for its response, decoding its body into result
+func (c *testClient) request(command string, args interface{}, result interface{}) testMessage {
+	c.seq++
+	req := map[string]interface{}{"seq": c.seq, "type": "request", "command": command}
+	if args != nil {
+		req["arguments"] = args
+	}
+
+	if err := framing.WriteMessage(c.w, req); err != nil {
+		c.t.Fatalf("cannot write to server: %v", err)
+	}
+
+	for {
+		msg := c.receive()
+		if msg.Type == "event" {
+			c.events = append(c.events, msg)
+			continue
+		}
+		if msg.RequestSeq != c.seq || msg.Command != command {
+			c.t.Fatalf("got response %+v, want a response to %s", msg, command)
+		}
+		if result != nil && msg.Success {
+			if err := json.Unmarshal(msg.Body, result); err != nil {
+				c.t.Fatalf("cannot decode %s response: %v", command, err)
+			}
+		}
+		return msg
+	}
+}
+
+// Wait for an event, decoding its body into result. Events of other kinds
+// received before it are dropped
+func (c *testClient) event(name string, result interface{}) {
+	for {
+		var msg testMessage
+		if len(c.events) > 0 {
+			msg, c.events = c.events[0], c.events[1:]
+		} else {
+			msg = c.receive()
+		}
+		if msg.Type != "event" || msg.Event != name {
+			continue
+		}
+		if result != nil {
+			if err := json.Unmarshal(msg.Body, result); err != nil {
+				c.t.Fatalf("cannot decode %s event: %v", name, err)
+			}
+		}
+		return
+	}
+}
+
+// Wait for the program to stop, checking the reason and the stack
+func (c *testClient) stopped(reason string, frames []string) {
+	c.t.Helper()
+
+	var body StoppedEventBody
+	c.event("stopped", &body)
+	if body.Reason != reason {
+		c.t.Errorf("stopped for %q, want %q", body.Reason, reason)
+	}
+
+	var trace StackTraceResponseBody
+	c.request("stackTrace", StackTraceArguments{ThreadID: threadID}, &trace)
+	got := []string{}
+	for _, f := range trace.StackFrames {
+		got = append(got, fmt.Sprintf("%s:%d", f.Name, f.Line))
+	}
+	if !reflect.DeepEqual(got, frames) {
+		c.t.Errorf("wrong stack. got=%v, want=%v", got, frames)
+	}
+}
+
+// Return the variables of a reference by name
+func (c *testClient) variables(ref int) map[string]Variable {
+	var body VariablesResponseBody
+	c.request("variables", VariablesArguments{VariablesReference: ref}, &body)
+	variables := map[string]Variable{}
+	for _, v := range body.Variables {
+		variables[v.Name] = v
+	}
+	return variables
+}
+
+func (c *testClient) close() error {
+	c.w.Close()
+	select {
+	case err := <-c.done:
+		return err
+	case <-time.After(5 * time.Second):
+		c.t.Fatalf("timed out waiting for the server to stop")
+	}
+	return nil
+}
+
+func writeProgram(t *testing.T, source string) string {
+	path := filepath.Join(t.TempDir(), "program.monkey")
+	if err := os.WriteFile(path, []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+const testProgram = `let add = fn(a, b) {
+  let sum = a + b;
+  sum
+};
+let xs = [1, 2];
+let total = add(xs[0], xs[1]);
+puts(total);
+`
+
+func TestDebugSession(t *testing.T) {
+	path := writeProgram(t, testProgram)
+	c := newTestClient(t)
+
+	var capabilities Capabilities
+	c.request("initialize", map[string]string{"adapterID": "monkey"}, &capabilities)
+	if !capabilities.SupportsConfigurationDoneRequest {
+		t.Errorf("configurationDone is not supported")
+	}
+	c.event("initialized", nil)
+
+	if res := c.request("launch", LaunchArguments{Program: path}, nil); !res.Success {
+		t.Fatalf("launch failed: %s", res.Message)
+	}
+
+	var breakpoints SetBreakpointsResponseBody
+	c.request("setBreakpoints", SetBreakpointsArguments{
+		Source:      Source{Path: path},
+		Breakpoints: []SourceBreakpoint{{Line: 6}, {Line: 4}},
+	}, &breakpoints)
+	want := []Breakpoint{{Verified: true, Line: 6}, {Verified: false, Line: 4, Message: "no statement on this line"}}
+	if !reflect.DeepEqual(breakpoints.Breakpoints, want) {
+		t.Errorf("wrong breakpoints. got=%+v, want=%+v", breakpoints.Breakpoints, want)
+	}
+
+	c.request("configurationDone", nil, nil)
+	c.stopped("breakpoint", []string{"main:6"})
+
+	c.request("stepIn", map[string]int{"threadId": threadID}, nil)
+	c.stopped("step", []string{"add:2", "main:6"})
+
+	var scopes ScopesResponseBody
+	c.request("scopes", ScopesArguments{FrameID: 1}, &scopes)
+	names := []string{}
+	for _, scope := range scopes.Scopes {
+		names = append(names, scope.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"Locals", "Globals"}) {
+		t.Fatalf("wrong scopes. got=%v", names)
+	}
+
+	locals := c.variables(scopes.Scopes[0].VariablesReference)
+	if len(locals) != 2 || locals["a"].Value != "1" || locals["b"].Value != "2" {
+		t.Errorf("wrong locals. got=%+v", locals)
+	}
+
+	globals := c.variables(scopes.Scopes[1].VariablesReference)
+	if globals["add"].Value != "fn(a, b)" || globals["add"].Type != "FUNCTION" {
+		t.Errorf("wrong add variable. got=%+v", globals["add"])
+	}
+	if _, ok := globals["total"]; ok {
+		t.Errorf("total is bound before its let statement ends")
+	}
+	xs := c.variables(globals["xs"].VariablesReference)
+	if len(xs) != 2 || xs["0"].Value != "1" || xs["1"].Value != "2" {
+		t.Errorf("wrong elements of xs. got=%+v", xs)
+	}
+
+	c.request("next", map[string]int{"threadId": threadID}, nil)
+	c.stopped("step", []string{"add:3", "main:6"})
+
+	c.request("stepOut", map[string]int{"threadId": threadID}, nil)
+	c.stopped("step", []string{"main:7"})
+
+	if res := c.request("variables", VariablesArguments{VariablesReference: 1}, nil); res.Success {
+		t.Errorf("a reference of a previous pause is still valid")
+	}
+
+	c.request("continue", map[string]int{"threadId": threadID}, nil)
+	var output OutputEventBody
+	c.event("output", &output)
+	if output.Category != "stdout" || output.Output != "3\n" {
+		t.Errorf("wrong output. got=%+v", output)
+	}
+	var exited ExitedEventBody
+	c.event("exited", &exited)
+	if exited.ExitCode != 0 {
+		t.Errorf("wrong exit code. got=%d", exited.ExitCode)
+	}
+	c.event("terminated", nil)
+
+	if res := c.request("continue", map[string]int{"threadId": threadID}, nil); res.Success {
+		t.Errorf("continue succeeded after the program ended")
+	}
+
+	c.request("disconnect", nil, nil)
+	if err := c.close(); err != nil {
+		t.Errorf("server failed: %v", err)
+	}
+}
+
+func TestDebugClosures(t *testing.T) {
+	path := writeProgram(t, `let counter = fn(start) {
+  let count = start;
+  fn(step) {
+    count = count + step;
+    count
+  }
+};
+let next = counter(10);
+next(1);
+`)
+	c := newTestClient(t)
+
+	c.request("initialize", nil, nil)
+	c.request("launch", LaunchArguments{Program: path}, nil)
+	c.request("setBreakpoints", SetBreakpointsArguments{
+		Source:      Source{Path: path},
+		Breakpoints: []SourceBreakpoint{{Line: 4}},
+	}, nil)
+	c.request("configurationDone", nil, nil)
+	c.stopped("breakpoint", []string{"<anonymous>:4", "main:9"})
+
+	var scopes ScopesResponseBody
+	c.request("scopes", ScopesArguments{FrameID: 1}, &scopes)
+	got := map[string]map[string]Variable{}
+	for _, scope := range scopes.Scopes {
+		got[scope.Name] = c.variables(scope.VariablesReference)
+	}
+
+	if len(scopes.Scopes) != 3 {
+		t.Fatalf("wrong number of scopes. got=%+v", scopes.Scopes)
+	}
+	if got["Locals"]["step"].Value != "1" {
+		t.Errorf("wrong locals. got=%+v", got["Locals"])
+	}
+	if got["Closure"]["count"].Value != "10" || got["Closure"]["start"].Value != "10" {
+		t.Errorf("wrong closure. got=%+v", got["Closure"])
+	}
+	if _, ok := got["Globals"]["next"]; !ok {
+		t.Errorf("wrong globals. got=%+v", got["Globals"])
+	}
+
+	c.request("terminate", nil, nil)
+	c.event("terminated", nil)
+	if err := c.close(); err != nil {
+		t.Errorf("server failed: %v", err)
+	}
+}
+
+func TestDebugErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   string
+		exitCode int
+		output   string
+	}{
+		{"runtime error", "let f = fn() { 1 + true };\nf();\n", 1, "program.monkey:1:16: type mismatch: INTEGER + BOOLEAN\n  in f, called at "},
+		{"uncaught throw", "throw(\"oops\");\n", 1, "program.monkey:1:1: oops\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeProgram(t, tt.source)
+			c := newTestClient(t)
+
+			c.request("initialize", nil, nil)
+			c.request("launch", LaunchArguments{Program: path}, nil)
+			c.request("configurationDone", nil, nil)
+
+			var output OutputEventBody
+			c.event("output", &output)
+			if output.Category != "stderr" || !strings.HasPrefix(output.Output, "ERROR: ") || !strings.Contains(output.Output, tt.output) {
+				t.Errorf("wrong output. got=%+v, want an error containing %q", output, tt.output)
+			}
+			var exited ExitedEventBody
+			c.event("exited", &exited)
+			if exited.ExitCode != tt.exitCode {
+				t.Errorf("wrong exit code. got=%d, want=%d", exited.ExitCode, tt.exitCode)
+			}
+
+			if err := c.close(); err != nil {
+				t.Errorf("server failed: %v", err)
+			}
+		})
+	}
+}
+
+func TestDebugRequestErrors(t *testing.T) {
+	c := newTestClient(t)
+
+	tests := []struct {
+		command string
+		args    interface{}
+		message string
+	}{
+		{"launch", LaunchArguments{}, "missing program to debug"},
+		{"launch", LaunchArguments{Program: writeProgram(t, "let = 1;")}, "program.monkey:1:5: expected next token to be IDENT, got = instead"},
+		{"stackTrace", StackTraceArguments{}, ""},
+		{"scopes", ScopesArguments{FrameID: 1}, "unknown frame 1"},
+		{"next", nil, "the program is not paused"},
+		{"evaluate", nil, `unsupported request "evaluate"`},
+	}
+
+	for _, tt := range tests {
+		res := c.request(tt.command, tt.args, nil)
+		if tt.message == "" {
+			if !res.Success {
+				t.Errorf("%s failed: %s", tt.command, res.Message)
+			}
+			continue
+		}
+		if res.Success {
+			t.Errorf("%s succeeded, want error %q", tt.command, tt.message)
+		} else if !strings.HasSuffix(res.Message, tt.message) {
+			t.Errorf("wrong %s error. got=%q, want=%q", tt.command, res.Message, tt.message)
+		}
+	}
+
+	if err := c.close(); err != nil {
+		t.Errorf("server failed: %v", err)
+	}
+}
+
+func TestStopOnEntryAndPause(t *testing.T) {
+	path := writeProgram(t, "let x = 1;\nlet loop = fn() { loop() };\nloop();\n")
+	c := newTestClient(t)
+
+	c.request("initialize", nil, nil)
+	c.request("launch", LaunchArguments{Program: path, StopOnEntry: true}, nil)
+	c.request("configurationDone", nil, nil)
+	c.stopped("entry", []string{"main:1"})
+
+	c.request("continue", nil, nil)
+	c.request("pause", nil, nil)
+	var body StoppedEventBody
+	c.event("stopped", &body)
+	if body.Reason != "pause" {
+		t.Errorf("stopped for %q, want pause", body.Reason)
+	}
+
+	c.request("disconnect", nil, nil)
+	if err := c.close(); err != nil {
+		t.Errorf("server failed: %v", err)
+	}
+}
@@ -1,92 +1,165 @@
 package evaluator
 
 import (
+	"context"
 	"fmt"
+	"math"
+	"strings"
 
 	"github.com/pwbrown/go-monkey/ast"
 	"github.com/pwbrown/go-monkey/object"
+	"github.com/pwbrown/go-monkey/token"
 )
 
 var (
-	NULL  = &object.Null{}
-	TRUE  = &object.Boolean{Value: true}
-	FALSE = &object.Boolean{Value: false}
+	NULL     = &object.Null{}
+	TRUE     = &object.Boolean{Value: true}
+	FALSE    = &object.Boolean{Value: false}
+	BREAK    = &object.Break{}
+	CONTINUE = &object.Continue{}
 )
 
 // Eval an AST Node and return an object type
 func Eval(node ast.Node, env *object.Environment) object.Object {
+	return evalNode(node, env, false)
+}
+
+// Eval an AST Node. In tail position, where the value of the node is the
+// result of the enclosing function, calls to functions are not applied but
+// returned as tail calls for applyFunction to run without growing the Go stack
+func evalNode(node ast.Node, env *object.Environment, tail bool) object.Object {
+	if err := env.Budget().Step(); err != nil {
+		err.Pos = node.Pos()
+		return err
+	}
+
+	result := eval(node, env, tail)
+
+	// Errors are located at the innermost node that produced them
+	if err, ok := result.(*object.Error); ok && !err.Pos.IsValid() {
+		err.Pos = node.Pos()
+	}
+
+	return result
+}
+
+// Eval an AST Node under a context and resource limits. When ctx is done or
+// a limit is exceeded, evaluation stops with an error of the matching kind
+func EvalContext(ctx context.Context, node ast.Node, env *object.Environment, limits object.Limits) object.Object {
+	previous := env.Budget()
+	env.SetBudget(object.NewBudget(ctx, limits))
+	defer env.SetBudget(previous)
+
+	return Eval(node, env)
+}
+
+// Eval a single AST Node without locating errors
+func eval(node ast.Node, env *object.Environment, tail bool) object.Object {
 	switch node := node.(type) {
 	// Statements
 	case *ast.Program:
-		return evalStatements(node.Statements, true, env)
+		return evalStatements(node.Statements, true, env, false)
 	case *ast.ExpressionStatement:
-		return Eval(node.Expression, env)
+		return evalNode(node.Expression, env, tail)
 	case *ast.BlockStatement:
-		return evalStatements(node.Statements, false, env)
+		return evalStatements(node.Statements, false, env, tail)
 	case *ast.ReturnStatement:
-		val := Eval(node.ReturnValue, env)
-		if isError(val) {
+		val := evalNode(node.ReturnValue, env, tail)
+		if isAbrupt(val) {
 			return val
 		}
 		return &object.ReturnValue{Value: val}
 	case *ast.LetStatement:
 		val := Eval(node.Value, env)
-		if isError(val) {
+		if isAbrupt(val) {
 			return val
 		}
 		env.Set(node.Name.Value, val)
+	case *ast.WhileStatement:
+		return evalWhileStatement(node, env)
+	case *ast.ForStatement:
+		return evalForStatement(node, env)
+	case *ast.BreakStatement:
+		return BREAK
+	case *ast.ContinueStatement:
+		return CONTINUE
 	// Expressions
 	case *ast.FunctionLiteral:
-		params := node.Parameters
-		body := node.Body
-		return &object.Function{Parameters: params, Body: body, Env: env}
+		return &object.Function{
+			Parameters: node.Parameters,
+			Defaults:   node.Defaults,
+			Rest:       node.Rest,
+			Body:       node.Body,
+			Env:        env,
+			Name:       node.Name,
+		}
 	case *ast.CallExpression:
 		if node.Function.TokenLiteral() == "quote" {
+			if len(node.Arguments) != 1 {
+				return newError("wrong number of arguments to quote. got=%d, want=1",
+					len(node.Arguments))
+			}
 			return quote(node.Arguments[0], env)
 		}
 		function := Eval(node.Function, env)
-		if isError(function) {
+		if isAbrupt(function) {
 			return function
 		}
 		args := evalExpressions(node.Arguments, env)
-		if len(args) == 1 && isError(args[0]) {
+		if len(args) == 1 && isAbrupt(args[0]) {
 			return args[0]
 		}
 
-		return applyFunction(function, args)
+		if fn, ok := function.(*object.Function); ok && tail {
+			return &object.TailCall{Function: fn, Arguments: args, Pos: node.Pos()}
+		}
+		return applyFunction(function, args, env.Budget(), node.Pos())
+	case *ast.AssignExpression:
+		result := evalAssignExpression(node, env)
+		// Compound assignments may build a new string
+		if node.Operator != "=" {
+			return allocate(env, result)
+		}
+		return result
 	case *ast.PrefixExpression:
 		right := Eval(node.Right, env)
-		if isError(right) {
+		if isAbrupt(right) {
 			return right
 		}
 		return evalPrefixExpression(node.Operator, right)
 	case *ast.InfixExpression:
+		if node.Operator == "&&" || node.Operator == "||" {
+			return evalLogicalExpression(node, env)
+		}
+
 		left := Eval(node.Left, env)
-		if isError(left) {
+		if isAbrupt(left) {
 			return left
 		}
 
 		right := Eval(node.Right, env)
-		if isError(right) {
+		if isAbrupt(right) {
 			return right
 		}
 
-		return evalInfixExpression(node.Operator, left, right)
+		return allocate(env, evalInfixExpression(node.Operator, left, right))
 	case *ast.IfExpression:
-		return evalIfExpression(node, env)
+		return evalIfExpression(node, env, tail)
+	case *ast.TryExpression:
+		return evalTryExpression(node, env)
 	case *ast.ArrayLiteral:
 		elements := evalExpressions(node.Elements, env)
-		if len(elements) == 1 && isError(elements[0]) {
+		if len(elements) == 1 && isAbrupt(elements[0]) {
 			return elements[0]
 		}
-		return &object.Array{Elements: elements}
+		return allocate(env, &object.Array{Elements: elements})
 	case *ast.IndexExpression:
 		left := Eval(node.Left, env)
-		if isError(left) {
+		if isAbrupt(left) {
 			return left
 		}
 		index := Eval(node.Index, env)
-		if isError(index) {
+		if isAbrupt(index) {
 			return index
 		}
 		return evalIndexExpression(left, index)
@@ -96,38 +169,174 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		return evalIdentifier(node, env)
 	case *ast.IntegerLiteral:
 		return &object.Integer{Value: node.Value}
+	case *ast.FloatLiteral:
+		return &object.Float{Value: node.Value}
 	case *ast.Boolean:
 		return nativeBoolToBooleanObject(node.Value)
 	case *ast.StringLiteral:
-		return &object.String{Value: node.Value}
+		return allocate(env, &object.String{Value: node.Value})
 	}
 
 	return nil
 }
 
-// Apply a function object with arguments
-func applyFunction(fn object.Object, args []object.Object) object.Object {
+// Count a newly allocated value against the budget of an environment
+func allocate(env *object.Environment, obj object.Object) object.Object {
+	if err := env.Budget().Allocate(obj); err != nil {
+		return err
+	}
+	return obj
+}
+
+// Apply a function object to arguments from outside of a program, e.g. when
+// a host application calls back into a script
+func Apply(fn object.Object, args []object.Object) object.Object {
+	return applyFunction(fn, args, nil, token.Position{})
+}
+
+// Apply a function object to arguments from outside of a program under a
+// context and resource limits (see EvalContext)
+func ApplyContext(ctx context.Context, fn object.Object, args []object.Object, limits object.Limits) object.Object {
+	return applyFunction(fn, args, object.NewBudget(ctx, limits), token.Position{})
+}
+
+// Apply a function object with arguments, counting the call against the
+// budget of the caller. Errors raised by the function record the call at pos
+// in their stack
+func applyFunction(fn object.Object, args []object.Object, budget *object.Budget, pos token.Position) object.Object {
 	switch fn := fn.(type) {
 	case *object.Function:
-		extendedEnv := extendFunctionEnv(fn, args)
-		evaluated := Eval(fn.Body, extendedEnv)
-		return unwrapReturnValue(evaluated)
+		if err := budget.Enter(); err != nil {
+			return err
+		}
+		defer budget.Leave()
+
+		// Calls in tail position replace the running function. An error keeps
+		// the frames of the first and the last call
+		called := object.StackFrame{Function: fn.Name, Pos: pos}
+		tailCalls := 0
+
+		for {
+			var evaluated object.Object
+			extendedEnv, err := extendFunctionEnv(fn, args, budget)
+			if err != nil {
+				if !err.Pos.IsValid() {
+					err.Pos = pos
+				}
+				evaluated = err
+			} else if hook := hookOf(budget); hook != nil {
+				if err := hook.Call(fn, extendedEnv, pos); err != nil {
+					if !err.Pos.IsValid() {
+						err.Pos = pos
+					}
+					evaluated = err
+				} else {
+					evaluated = unwrapReturnValue(evalNode(fn.Body, extendedEnv, true))
+					if _, ok := evaluated.(*object.TailCall); ok {
+						hook.Return(fn, nil)
+					} else {
+						hook.Return(fn, evaluated)
+					}
+				}
+			} else {
+				evaluated = unwrapReturnValue(evalNode(fn.Body, extendedEnv, true))
+			}
+			if err, ok := evaluated.(*object.Error); ok {
+				if tailCalls > 0 {
+					err.Stack = append(err.Stack, object.StackFrame{Function: fn.Name, Pos: pos})
+					called.TailCalls = tailCalls - 1
+				}
+				err.Stack = append(err.Stack, called)
+			}
+
+			call, ok := evaluated.(*object.TailCall)
+			if !ok {
+				return evaluated
+			}
+			fn, args, pos = call.Function, call.Arguments, call.Pos
+			tailCalls++
+		}
 	case *object.Builtin:
-		return fn.Fn(args...)
+		result := fn.Fn(args...)
+		if result == nil {
+			return NULL
+		}
+		// Results of builtins are counted as new values
+		if err := budget.Allocate(result); err != nil {
+			return err
+		}
+		return result
 	default:
 		return newError("not a function: %s", fn.Type())
 	}
 }
 
-// Extend a function's environment with values from arguments
-func extendFunctionEnv(fn *object.Function, args []object.Object) *object.Environment {
+// Extend a function's environment with values from arguments. The function
+// may have been defined in an earlier evaluation, so the budget is the caller's.
+// Missing arguments take their default values, which are evaluated in order
+// and can refer to the parameters before them. Remaining arguments are
+// collected into an array for the rest parameter
+func extendFunctionEnv(fn *object.Function, args []object.Object, budget *object.Budget) (*object.Environment, *object.Error) {
+	required := 0
+	for idx := range fn.Parameters {
+		if idx >= len(fn.Defaults) || fn.Defaults[idx] == nil {
+			required = idx + 1
+		}
+	}
+
+	if len(args) < required || fn.Rest == nil && len(args) > len(fn.Parameters) {
+		return nil, newError("wrong number of arguments%s. got=%d, want=%s",
+			functionNameSuffix(fn), len(args), arity(fn, required))
+	}
+
 	env := object.NewEnclosedEnvironment(fn.Env)
+	env.SetBudget(budget)
 
 	for idx, param := range fn.Parameters {
-		env.Set(param.Value, args[idx])
+		if idx < len(args) {
+			env.Set(param.Value, args[idx])
+			continue
+		}
+
+		value := Eval(fn.Defaults[idx], env)
+		if err, ok := value.(*object.Error); ok {
+			return nil, err
+		}
+		env.Set(param.Value, value)
 	}
 
-	return env
+	if fn.Rest != nil {
+		rest := &object.Array{Elements: []object.Object{}}
+		if len(args) > len(fn.Parameters) {
+			rest.Elements = append(rest.Elements, args[len(fn.Parameters):]...)
+		}
+		if err := budget.Allocate(rest); err != nil {
+			return nil, err
+		}
+		env.Set(fn.Rest.Value, rest)
+	}
+
+	return env, nil
+}
+
+// Name a function in an error message, if it has a name
+func functionNameSuffix(fn *object.Function) string {
+	if fn.Name == "" {
+		return ""
+	}
+	return " to " + fn.Name
+}
+
+// Describe the number of arguments a function accepts
+func arity(fn *object.Function, required int) string {
+	switch {
+	case fn.Rest != nil:
+		return fmt.Sprintf("at least %d", required)
+	case required == len(fn.Parameters):
+		return fmt.Sprintf("%d", required)
+	default:
+		return fmt.Sprintf("%d to %d", required, len(fn.Parameters))
+	}
 }
 
 // Unwrap a return value
@@ -140,11 +349,24 @@ func unwrapReturnValue(obj object.Object) object.Object {
 }
 
 // Eval a list of statements
-func evalStatements(stmts []ast.Statement, unwrap bool, env *object.Environment) object.Object {
+func evalStatements(stmts []ast.Statement, unwrap bool, env *object.Environment, tail bool) object.Object {
 	var result object.Object
+	hook := hookOf(env.Budget())
+
+	for i, statement := range stmts {
+		if hook != nil {
+			if err := hook.Statement(statement, env); err != nil {
+				if !err.Pos.IsValid() {
+					err.Pos = statement.Pos()
+				}
+				return err
+			}
+		}
 
-	for _, statement := range stmts {
-		result = Eval(statement, env)
+		// In a tail block, the last statement and return statements are in
+		// tail position
+		_, isReturn := statement.(*ast.ReturnStatement)
+		result = evalNode(statement, env, tail && (isReturn || i == len(stmts)-1))
 
 		if isError(result) {
 			return result
@@ -154,6 +376,8 @@ func evalStatements(stmts []ast.Statement, unwrap bool, env *object.Environment)
 			} else {
 				return result
 			}
+		} else if result == BREAK || result == CONTINUE {
+			return result
 		}
 	}
 
@@ -166,7 +390,7 @@ func evalExpressions(exps []ast.Expression, env *object.Environment) []object.Ob
 
 	for _, e := range exps {
 		evaluated := Eval(e, env)
-		if isError(evaluated) {
+		if isAbrupt(evaluated) {
 			return []object.Object{evaluated}
 		}
 		result = append(result, evaluated)
@@ -188,6 +412,122 @@ func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object
 	return newError("identifier not found: %s", node.Value)
 }
 
+// Evaluate an assignment to an existing binding. A compound assignment like
+// x += 1 applies the operator to the current value first
+func evalAssignExpression(node *ast.AssignExpression, env *object.Environment) object.Object {
+	switch target := node.Target.(type) {
+	case *ast.Identifier:
+		return evalIdentifierAssignment(node, target, env)
+	case *ast.IndexExpression:
+		return evalIndexAssignment(node, target, env)
+	default:
+		return newError("cannot assign to %s", node.Target.String())
+	}
+}
+
+func evalIdentifierAssignment(node *ast.AssignExpression, ident *ast.Identifier, env *object.Environment) object.Object {
+	current, ok := env.Get(ident.Value)
+	if !ok {
+		if _, ok := builtins[ident.Value]; ok {
+			return newError("cannot assign to builtin: %s", ident.Value)
+		}
+		return newError("identifier not found: %s", ident.Value)
+	}
+
+	value := Eval(node.Value, env)
+	if isAbrupt(value) {
+		return value
+	}
+
+	value = evalCompoundAssignment(node.Operator, current, value)
+	if isError(value) {
+		return value
+	}
+
+	env.Assign(ident.Value, value)
+	return value
+}
+
+// Assign to an element of an array or hash in place. The collection, index
+// and value are evaluated before the target is checked
+func evalIndexAssignment(node *ast.AssignExpression, target *ast.IndexExpression, env *object.Environment) object.Object {
+	left := Eval(target.Left, env)
+	if isAbrupt(left) {
+		return left
+	}
+
+	index := Eval(target.Index, env)
+	if isAbrupt(index) {
+		return index
+	}
+
+	value := Eval(node.Value, env)
+	if isAbrupt(value) {
+		return value
+	}
+
+	switch left := left.(type) {
+	case *object.Array:
+		return evalArrayIndexAssignment(node.Operator, left, index, value)
+	case *object.Hash:
+		return evalHashIndexAssignment(node.Operator, left, index, value)
+	default:
+		return newError("index assignment not supported: %s", left.Type())
+	}
+}
+
+func evalArrayIndexAssignment(operator string, array *object.Array, index, value object.Object) object.Object {
+	idx, ok := index.(*object.Integer)
+	if !ok {
+		return newError("array index must be INTEGER, got %s", index.Type())
+	}
+
+	if idx.Value < 0 || idx.Value >= int64(len(array.Elements)) {
+		return newError("index out of range: %d with length %d", idx.Value, len(array.Elements))
+	}
+
+	value = evalCompoundAssignment(operator, array.Elements[idx.Value], value)
+	if isError(value) {
+		return value
+	}
+
+	array.Elements[idx.Value] = value
+	return value
+}
+
+func evalHashIndexAssignment(operator string, hash *object.Hash, index, value object.Object) object.Object {
+	key, ok := index.(object.Hashable)
+	if !ok {
+		return newError("unusable as hash key: %s", index.Type())
+	}
+
+	hashKey := key.HashKey()
+
+	if operator != "=" {
+		pair, ok := hash.Pairs[hashKey]
+		if !ok {
+			return newError("key not found: %s", index.Inspect())
+		}
+
+		value = evalCompoundAssignment(operator, pair.Value, value)
+		if isError(value) {
+			return value
+		}
+	}
+
+	hash.Pairs[hashKey] = object.HashPair{Key: index, Value: value}
+	return value
+}
+
+// Combine the current and assigned values of a compound assignment like +=,
+// plain assignments return the assigned value
+func evalCompoundAssignment(operator string, current, value object.Object) object.Object {
+	if operator == "=" {
+		return value
+	}
+	return evalInfixExpression(strings.TrimSuffix(operator, "="), current, value)
+}
+
 // Evaluate a prefix expression
 func evalPrefixExpression(operator string, right object.Object) object.Object {
 	switch operator {
@@ -203,10 +543,12 @@ func evalPrefixExpression(operator string, right object.Object) object.Object {
 // Evaluate an infix expression
 func evalInfixExpression(operator string, left object.Object, right object.Object) object.Object {
 	switch {
-	case left.Type() != right.Type():
-		return newError("type mismatch: %s %s %s", left.Type(), operator, right.Type())
 	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
 		return evalIntegerInfixExpression(operator, left, right)
+	case isNumber(left) && isNumber(right):
+		return evalFloatInfixExpression(operator, left, right)
+	case left.Type() != right.Type():
+		return newError("type mismatch: %s %s %s", left.Type(), operator, right.Type())
 	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
 		return evalStringInfixExpression(operator, left, right)
 	case operator == "==":
@@ -218,16 +560,113 @@ func evalInfixExpression(operator string, left object.Object, right object.Objec
 	}
 }
 
-func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
+// Evaluate && or ||, only evaluating the right operand if the left one does
+// not decide the result
+func evalLogicalExpression(node *ast.InfixExpression, env *object.Environment) object.Object {
+	left := Eval(node.Left, env)
+	if isAbrupt(left) {
+		return left
+	}
+
+	if isTruthy(left) == (node.Operator == "||") {
+		return nativeBoolToBooleanObject(isTruthy(left))
+	}
+
+	right := Eval(node.Right, env)
+	if isAbrupt(right) {
+		return right
+	}
+
+	return nativeBoolToBooleanObject(isTruthy(right))
+}
+
+// Evaluate a while loop. Loops are statements and have no value
+func evalWhileStatement(node *ast.WhileStatement, env *object.Environment) object.Object {
+	for {
+		condition := Eval(node.Condition, env)
+		if isAbrupt(condition) {
+			return condition
+		}
+
+		if !isTruthy(condition) {
+			return nil
+		}
+
+		if result, done := evalLoopBody(node.Body, env); done {
+			return result
+		}
+	}
+}
+
+// Evaluate a for loop over the items of an array, string or hash
+func evalForStatement(node *ast.ForStatement, env *object.Environment) object.Object {
+	iterable := Eval(node.Iterable, env)
+	if isAbrupt(iterable) {
+		return iterable
+	}
+
+	iter, ok := object.NewIterator(iterable, node.Key != nil)
+	if !ok {
+		err := newError("cannot iterate over %s", iterable.Type())
+		err.Pos = node.Iterable.Pos()
+		return err
+	}
+
+	for key, value, ok := iter.Next(); ok; key, value, ok = iter.Next() {
+		if node.Key != nil {
+			env.Set(node.Key.Value, key)
+		}
+		env.Set(node.Value.Value, value)
+
+		if result, done := evalLoopBody(node.Body, env); done {
+			return result
+		}
+	}
+
+	return nil
+}
+
+// Evaluate the body of a loop and report whether the loop ends, along with
+// the result to pass on (a return value or an error)
+func evalLoopBody(body *ast.BlockStatement, env *object.Environment) (object.Object, bool) {
+	result := Eval(body, env)
+
+	switch {
+	case result == BREAK:
+		return nil, true
+	case isError(result):
+		return result, true
+	case result != nil && result.Type() == object.RETURN_VALUE_OBJ:
+		return result, true
+	default:
+		return nil, false
+	}
+}
+
+// Evaluate a try block. If it raises an error that can be caught, bind the
+// error to the catch parameter and evaluate the catch block instead
+func evalTryExpression(node *ast.TryExpression, env *object.Environment) object.Object {
+	result := Eval(node.Block, env)
+
+	err, ok := result.(*object.Error)
+	if !ok || !err.Catchable() {
+		return result
+	}
+
+	env.Set(node.Param.Value, err.ToHash())
+	return Eval(node.Catch, env)
+}
+
+func evalIfExpression(ie *ast.IfExpression, env *object.Environment, tail bool) object.Object {
 	condition := Eval(ie.Condition, env)
-	if isError(condition) {
+	if isAbrupt(condition) {
 		return condition
 	}
 
 	if isTruthy(condition) {
-		return Eval(ie.Consequence, env)
+		return evalNode(ie.Consequence, env, tail)
 	} else if ie.Alternative != nil {
-		return Eval(ie.Alternative, env)
+		return evalNode(ie.Alternative, env, tail)
 	} else {
 		return NULL
 	}
@@ -237,6 +676,8 @@ func evalIndexExpression(left, index object.Object) object.Object {
 	switch {
 	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
 		return evalArrayIndexExpression(left, index)
+	case left.Type() == object.STRING_OBJ && index.Type() == object.INTEGER_OBJ:
+		return evalStringIndexExpression(left, index)
 	case left.Type() == object.HASH_OBJ:
 		return evalHashIndexExpression(left, index)
 	default:
@@ -249,7 +690,7 @@ func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Obje
 
 	for keyNode, valueNode := range node.Pairs {
 		key := Eval(keyNode, env)
-		if isError(key) {
+		if isAbrupt(key) {
 			return key
 		}
 
@@ -259,7 +700,7 @@ func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Obje
 		}
 
 		value := Eval(valueNode, env)
-		if isError(value) {
+		if isAbrupt(value) {
 			return value
 		}
 
@@ -267,7 +708,7 @@ func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Obje
 		pairs[hashed] = object.HashPair{Key: key, Value: value}
 	}
 
-	return &object.Hash{Pairs: pairs}
+	return allocate(env, &object.Hash{Pairs: pairs})
 }
 
 func evalArrayIndexExpression(array, index object.Object) object.Object {
@@ -282,6 +723,23 @@ func evalArrayIndexExpression(array, index object.Object) object.Object {
 	return arrayObj.Elements[idx]
 }
 
+// Index a string by character (rune), returning a one character string
+func evalStringIndexExpression(str, index object.Object) object.Object {
+	value := str.(*object.String).Value
+	idx := index.(*object.Integer).Value
+
+	if idx >= 0 {
+		for _, ch := range value {
+			if idx == 0 {
+				return &object.String{Value: string(ch)}
+			}
+			idx--
+		}
+	}
+
+	return NULL
+}
+
 func evalHashIndexExpression(hash, index object.Object) object.Object {
 	hashObject := hash.(*object.Hash)
 
@@ -314,11 +772,14 @@ func evalBangOperatorExpression(right object.Object) object.Object {
 
 // Evaluate a minus prefix operator expression
 func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
-	if right.Type() != object.INTEGER_OBJ {
+	switch right := right.(type) {
+	case *object.Integer:
+		return &object.Integer{Value: -right.Value}
+	case *object.Float:
+		return &object.Float{Value: -right.Value}
+	default:
 		return newError("unknown operator: -%s", right.Type())
 	}
-	value := right.(*object.Integer).Value
-	return &object.Integer{Value: -value}
 }
 
 // Evaluate an integer infix expression
@@ -334,11 +795,56 @@ func evalIntegerInfixExpression(operator string, left object.Object, right objec
 	case "*":
 		return &object.Integer{Value: leftVal * rightVal}
 	case "/":
+		if rightVal == 0 {
+			return newError("division by zero")
+		}
 		return &object.Integer{Value: leftVal / rightVal}
+	case "%":
+		if rightVal == 0 {
+			return newError("division by zero")
+		}
+		return &object.Integer{Value: leftVal % rightVal}
 	case "<":
 		return nativeBoolToBooleanObject(leftVal < rightVal)
 	case ">":
 		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "<=":
+		return nativeBoolToBooleanObject(leftVal <= rightVal)
+	case ">=":
+		return nativeBoolToBooleanObject(leftVal >= rightVal)
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+// Evaluate a float infix expression, promoting an integer operand to a float
+func evalFloatInfixExpression(operator string, left object.Object, right object.Object) object.Object {
+	leftVal := toFloat(left)
+	rightVal := toFloat(right)
+
+	switch operator {
+	case "+":
+		return &object.Float{Value: leftVal + rightVal}
+	case "-":
+		return &object.Float{Value: leftVal - rightVal}
+	case "*":
+		return &object.Float{Value: leftVal * rightVal}
+	case "/":
+		return &object.Float{Value: leftVal / rightVal}
+	case "%":
+		return &object.Float{Value: math.Mod(leftVal, rightVal)}
+	case "<":
+		return nativeBoolToBooleanObject(leftVal < rightVal)
+	case ">":
+		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "<=":
+		return nativeBoolToBooleanObject(leftVal <= rightVal)
+	case ">=":
+		return nativeBoolToBooleanObject(leftVal >= rightVal)
 	case "==":
 		return nativeBoolToBooleanObject(leftVal == rightVal)
 	case "!=":
@@ -387,6 +893,23 @@ func isTruthy(obj object.Object) bool {
 	}
 }
 
+// Check if an object is an integer or a float
+func isNumber(obj object.Object) bool {
+	return obj.Type() == object.INTEGER_OBJ || obj.Type() == object.FLOAT_OBJ
+}
+
+// Convert an integer or float object to a native float
+func toFloat(obj object.Object) float64 {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return float64(obj.Value)
+	case *object.Float:
+		return obj.Value
+	default:
+		return 0
+	}
+}
+
 // Check if an object is an error
 func isError(obj object.Object) bool {
 	if obj != nil {
@@ -394,3 +917,10 @@ func isError(obj object.Object) bool {
 	}
 	return false
 }
+
+// Report whether an expression ended abruptly, with an error or with a break
+// or continue out of an if used as a value. Either way the expression using
+// it stops and passes it on, to the enclosing loop for break and continue
+func isAbrupt(obj object.Object) bool {
+	return isError(obj) || obj == BREAK || obj == CONTINUE
+}
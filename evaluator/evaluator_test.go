@@ -1,7 +1,10 @@
 package evaluator
 
 import (
+	"context"
+	"runtime/debug"
 	"testing"
+	"time"
 
 	"github.com/pwbrown/go-monkey/lexer"
 	"github.com/pwbrown/go-monkey/object"
@@ -28,6 +31,33 @@ func TestEvalIntegerExpression(t *testing.T) {
 		{"3 * 3 * 3 + 10", 37},
 		{"3 * (3 * 3) + 10", 37},
 		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+		{"7 % 3", 1},
+		{"-7 % 3", -1},
+		{"2 + 9 % 4 * 3", 5},
+	}
+
+	for _, tt := range tests {
+		testLiteral(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestEvalFloatExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"3.14", 3.14},
+		{"1e-9", 1e-9},
+		{"2.5E3", 2500},
+		{"-1.5", -1.5},
+		{"1.5 + 1.5", 3},
+		{"0.5 * 4", 2},
+		{"1 + 0.5", 1.5},
+		{"0.5 + 1", 1.5},
+		{"5.5 % 2", 1.5},
+		{"7 / 2.0", 3.5},
+		{"10 - 2.5 * 2", 5},
+		{"-(1 + 0.25)", -1.25},
 	}
 
 	for _, tt := range tests {
@@ -49,6 +79,27 @@ func TestEvalBooleanExpression(t *testing.T) {
 		{"1 == 1", true},
 		{"1 != 1", false},
 		{"1 == 2", false},
+		{"1.5 < 2", true},
+		{"2 > 1.5", true},
+		{"1 == 1.0", true},
+		{"0.1 + 0.2 != 0.3", true},
+		{"2.5 == 2.5", true},
+		{"1 <= 1", true},
+		{"2 <= 1", false},
+		{"1 >= 1", true},
+		{"1 >= 2", false},
+		{"1.5 >= 1.5", true},
+		{"1 <= 0.5", false},
+		{"true && true", true},
+		{"true && false", false},
+		{"false && true", false},
+		{"false || true", true},
+		{"false || false", false},
+		{"1 && 2", true},
+		{"1 < 2 && 2 <= 2", true},
+		{"1 > 2 || 3 >= 4", false},
+		{"let f = fn() { 1 + true }; false && f()", false},
+		{"let f = fn() { 1 + true }; true || f()", true},
 		{"1 != 2", true},
 		{"true == true", true},
 		{"false == false", true},
@@ -141,6 +192,26 @@ func TestErrorHandling(t *testing.T) {
 			"5 + true; 5;",
 			"type mismatch: INTEGER + BOOLEAN",
 		},
+		{
+			"1.5 + true;",
+			"type mismatch: FLOAT + BOOLEAN",
+		},
+		{
+			`1.5 + "a";`,
+			"type mismatch: FLOAT + STRING",
+		},
+		{
+			"let f = fn() { 1 + true }; true && f()",
+			"type mismatch: INTEGER + BOOLEAN",
+		},
+		{
+			"1 / 0",
+			"division by zero",
+		},
+		{
+			"1 % 0",
+			"division by zero",
+		},
 		{
 			"-true",
 			"unknown operator: -BOOLEAN",
@@ -196,6 +267,346 @@ func TestErrorHandling(t *testing.T) {
 	}
 }
 
+func TestErrorPositions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"5 + true;", "ERROR: 1:1: type mismatch: INTEGER + BOOLEAN"},
+		{"let x = 1;\nlet y = -true;", "ERROR: 2:9: unknown operator: -BOOLEAN"},
+		{"let f = fn() {\n  1;\n  foobar;\n};\nf();", "ERROR: 3:3: identifier not found: foobar"},
+		{`len(1, 2)`, "ERROR: 1:1: wrong number of arguments. got=2, want=1"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated == nil || evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong error for %q. expected=%q, got=%+v",
+				tt.input, tt.expected, evaluated)
+		}
+	}
+}
+
+func TestStackTraces(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"5 + true", nil},
+		{
+			"let add = fn(a, b) { a + b };\nadd(1, true)",
+			[]string{"in add, called at 2:1"},
+		},
+		{
+			"let inner = fn() { -true };\nlet outer = fn() { 1; inner() };\nouter()",
+			[]string{"in inner, called at 2:23", "in outer, called at 3:1"},
+		},
+		{
+			"fn() { len(1) }()",
+			[]string{"in <anonymous>, called at 1:1"},
+		},
+		// Frames replaced by calls in tail position are summarized
+		{
+			"let f = fn(n) { if (n == 0) { x } else { f(n - 1) } };\nf(3)",
+			[]string{"in f, called at 1:42", "... 2 tail calls", "in f, called at 2:1"},
+		},
+		{
+			"let f = fn(n) { if (n == 0) { x } else { return f(n - 1); } };\n1 + f(1)",
+			[]string{"in f, called at 1:49", "in f, called at 2:5"},
+		},
+		// Errors returned from a call are not raised inside of it
+		{"let f = fn() { 1 }; f() + true", nil},
+	}
+
+	for _, tt := range tests {
+		errObj, ok := testEval(tt.input).(*object.Error)
+		if !ok {
+			t.Fatalf("no error object returned for %q", tt.input)
+		}
+
+		expected := ""
+		for _, line := range tt.expected {
+			expected += "  " + line + "\n"
+		}
+
+		if errObj.StackTrace() != expected {
+			t.Errorf("wrong stack for %q.\nwant=%q\ngot =%q", tt.input, expected, errObj.StackTrace())
+		}
+	}
+}
+
+func TestLoops(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let i = 0; let sum = 0; while (i < 5) { let sum = sum + i; let i = i + 1; }; sum", 10},
+		{"let i = 0; while (true) { if (i == 3) { break; } let i = i + 1; } i", 3},
+		{"let i = 0; let odd = 0; while (i < 6) { let i = i + 1; if (i % 2 == 0) { continue; } let odd = odd + i; } odd", 9},
+		{"let i = 0; while (i < 100000) { let i = i + 1; } i", 100000},
+		{"let s = 0; for (x in [1, 2, 3]) { let s = s + x; } s", 6},
+		{"let s = 0; for (i, x in [10, 20]) { let s = s + i * x; } s", 20},
+		{"let n = 0; for (c in \"héllo\") { let n = n + 1; } n", 5},
+		{"let s = 0; for (k, v in {\"b\": 2, \"a\": 1}) { let s = s * 10 + v; } s", 12},
+		{"let s = 0; for (p in {\"a\": 1, \"b\": 2}) { let s = s + p[1]; } s", 3},
+		{"let s = 0; for (x in [1, 2, 3, 4]) { if (x == 3) { break; } let s = s + x; } s", 3},
+		{"let s = 0; for (x in [1, 2, 3, 4]) { if (x % 2 == 1) { continue; } let s = s + x; } s", 6},
+		{"let n = 0; for (x in [1, 2]) { for (y in [1, 2, 3]) { if (y == 2) { break; } let n = n + 1; } } n", 2},
+		{"let f = fn() { for (x in [1, 2, 3]) { if (x == 2) { return x * 10; } } }; f()", 20},
+		{"let f = fn(n) { let i = 0; while (i < n) { let i = i + 1; } i }; f(4)", 4},
+		{"for (x in []) { x }", nil},
+		{"for (x in 5) { x }", "cannot iterate over INTEGER"},
+		{"while (true) { 1 + true; }", "type mismatch: INTEGER + BOOLEAN"},
+		// break and continue in an if used as a value reach the loop
+		{"let i = 0; while (i < 2) { i += 1; let x = if (true) { break }; puts(x) } i", 1},
+		{"let i = 0; while (i < 2) { i += 1; puts(if (true) { break }) } i", 1},
+		{"let i = 0; while (i < 2) { i += 1; let h = {\"k\": if (true) { break }} } i", 1},
+		{"let s = 0; for (x in [1, 2, 3]) { s += 1 + if (x == 2) { continue } else { 10 } } s", 22},
+		{"let s = 0; for (x in [1, 2, 3]) { let a = [if (x == 2) { continue }]; s += x } s", 4},
+		{"let s = 0; for (x in [1, 2, 3]) { s += [10, 20, 30][if (x == 3) { break } else { x }] } s", 50},
+		{"let s = 0; for (x in [1, 2]) { while (if (x == 2) { break } else { false }) { } s += x } s", 1},
+		{"let f = fn(n) { n }; let s = 0; for (x in [1, 2, 3]) { s += f(if (x == 1) { continue } else { x }) } s", 5},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if tt.expected == nil {
+			if evaluated != nil {
+				t.Errorf("expected no value for %q. got=%T (%+v)", tt.input, evaluated, evaluated)
+			}
+			continue
+		}
+		testLiteral(t, evaluated, tt.expected)
+	}
+}
+
+func TestAssignment(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let x = 1; x = 2; x", 2},
+		{"let x = 1; x += 2; x", 3},
+		{"let x = 5; x -= 2; x", 3},
+		{"let x = 5; x *= 2; x", 10},
+		{"let x = 9; x /= 2; x", 4},
+		{"let x = 1; let y = (x = 5); x + y", 10},
+		{"let a = 1; let b = 2; a = b = 7; a + b", 14},
+		{"let c = 0; let inc = fn() { c += 1 }; inc(); inc(); c", 2},
+		{"let x = 1; let f = fn() { let x = 5; x = 6; x }; f() + x", 7},
+		{"let f = fn() { let n = 1; n += 2; n }; f()", 3},
+		{"let i = 0; while (i < 5) { i += 1; } i", 5},
+		{"let x = 1.5; x *= 2; x", 3.0},
+		{"y = 1", "identifier not found: y"},
+		{"y += 1", "identifier not found: y"},
+		{"let f = fn() { y = 1 }; let y = 0; f(); y", 1},
+		{"len = 1", "cannot assign to builtin: len"},
+		{"let x = 1; x += true", "type mismatch: INTEGER + BOOLEAN"},
+		{"let x = 1; x /= 0", "division by zero"},
+		{"let make = fn() { let n = 0; fn() { n += 1; n } }; let next = make(); next(); next()", 2},
+	}
+
+	for _, tt := range tests {
+		testLiteral(t, testEval(tt.input), tt.expected)
+	}
+
+	testStringObject(t, testEval(`let s = "a"; s += "b"; s`), "ab")
+}
+
+func TestIndexAssignment(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let a = [1, 2, 3]; a[0] = 5; a", []int{5, 2, 3}},
+		{"let a = [1, 2, 3]; a[1] += 5; a", []int{1, 7, 3}},
+		{"let a = [1, 2, 3]; a[2] = 9", 9},
+		{"let a = [1, 2]; let b = a; b[0] = 3; a", []int{3, 2}},
+		{"let a = [0, 0, 0]; let i = 0; while (i < 3) { a[i] = i * i; i += 1; } a", []int{0, 1, 4}},
+		{"let m = [[1, 2], [3, 4]]; m[1][0] *= 10; m[1]", []int{30, 4}},
+		{`let h = {}; h["a"] = 1; h["a"]`, 1},
+		{`let h = {"a": 1}; h["a"] += 2; h["a"]`, 3},
+		{"let h = {}; h[true] = 1; h[2] = 2; h[true] + h[2]", 3},
+		{"let f = fn(a) { a[0] = 1 }; let a = [0]; f(a); a", []int{1}},
+		{"let a = [1, 2]; a[2] = 3", "index out of range: 2 with length 2"},
+		{"let a = [1, 2]; a[-1] = 3", "index out of range: -1 with length 2"},
+		{"let a = []; a[0] += 1", "index out of range: 0 with length 0"},
+		{`let a = [1]; a["x"] = 1`, "array index must be INTEGER, got STRING"},
+		{"let h = {}; h[fn(x) { x }] = 1", "unusable as hash key: FUNCTION"},
+		{"let h = {}; h[[]] = 1", "unusable as hash key: ARRAY"},
+		{`let h = {}; h["n"] += 1`, "key not found: n"},
+		{`let h = {"n": 1}; h["n"] += true`, "type mismatch: INTEGER + BOOLEAN"},
+		{`let s = "abc"; s[0] = "x"`, "index assignment not supported: STRING"},
+		{"let a = [1]; a[0] = b", "identifier not found: b"},
+		{"b[0] = 1", "identifier not found: b"},
+	}
+
+	for _, tt := range tests {
+		testLiteral(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	tests := []struct {
+		input    string
+		limits   object.Limits
+		kind     object.ErrorKind
+		expected string
+	}{
+		{
+			"while (true) { }",
+			object.Limits{MaxSteps: 100},
+			object.STEP_LIMIT_ERR,
+			"step limit exceeded: 100 steps",
+		},
+		{
+			"let f = fn() { 1 + f() }; f()",
+			object.Limits{MaxDepth: 50},
+			object.DEPTH_LIMIT_ERR,
+			"call depth limit exceeded: 50 nested calls",
+		},
+		{
+			`let s = "ab"; while (true) { s += s }`,
+			object.Limits{MaxAllocations: 1000},
+			object.ALLOCATION_LIMIT_ERR,
+			"allocation limit exceeded: 1000 values",
+		},
+		{
+			"let a = []; while (true) { a = push(a, 1) }",
+			object.Limits{MaxAllocations: 1000},
+			object.ALLOCATION_LIMIT_ERR,
+			"allocation limit exceeded: 1000 values",
+		},
+		{
+			"[1, 2, 3, 4]",
+			object.Limits{MaxAllocations: 3},
+			object.ALLOCATION_LIMIT_ERR,
+			"allocation limit exceeded: 3 values",
+		},
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		evaluated := EvalContext(context.Background(), program, object.NewEnvironment(), tt.limits)
+
+		errObj := testErrorObject(t, evaluated, tt.expected)
+		if errObj.Kind != tt.kind {
+			t.Errorf("wrong error kind for %q. want=%s, got=%s", tt.input, tt.kind, errObj.Kind)
+		}
+	}
+
+	// Limits that are not reached do not change the result
+	program := parser.New(lexer.New("let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; fib(10)")).ParseProgram()
+	limits := object.Limits{MaxSteps: 100000, MaxDepth: 20, MaxAllocations: 100}
+	testIntegerObject(t, EvalContext(context.Background(), program, object.NewEnvironment(), limits), 55)
+
+	// The budget of the environment is restored afterwards
+	env := object.NewEnvironment()
+	EvalContext(context.Background(), program, env, limits)
+	if env.Budget() != nil {
+		t.Errorf("budget was not restored")
+	}
+}
+
+func TestEvalContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	program := parser.New(lexer.New("while (true) { }")).ParseProgram()
+	evaluated := EvalContext(ctx, program, object.NewEnvironment(), object.Limits{})
+
+	errObj := testErrorObject(t, evaluated, "evaluation canceled: context canceled")
+	if errObj.Kind != object.CANCELED_ERR {
+		t.Errorf("wrong error kind. want=%s, got=%s", object.CANCELED_ERR, errObj.Kind)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	evaluated = EvalContext(ctx, program, object.NewEnvironment(), object.Limits{})
+	testErrorObject(t, evaluated, "evaluation canceled: context deadline exceeded")
+}
+
+func TestTryCatch(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"try { 1 } catch (e) { 2 }", 1},
+		{"try { 1 + true } catch (e) { 2 }", 2},
+		{`try { throw("boom") } catch (e) { e["message"] }`, "boom"},
+		{`try { throw(42) } catch (e) { e["value"] + 1 }`, 43},
+		{`try { throw([1, 2]) } catch (e) { e["message"] }`, "[1, 2]"},
+		{`try { -true } catch (e) { e["message"] }`, "unknown operator: -BOOLEAN"},
+		{`try { -true } catch (e) { e["value"] }`, "unknown operator: -BOOLEAN"},
+		{"try {\n  1;\n  x\n} catch (e) { [e[\"line\"], e[\"column\"]] }", []int{3, 3}},
+		{"let f = fn() { throw(1); 2 }; try { f() } catch (e) { e[\"value\"] * 10 }", 10},
+		{"let f = fn() { try { return 1; } catch (e) { 2 }; 3 }; f()", 1},
+		{"try { try { throw(1) } catch (e) { throw(e[\"value\"] + 1) } } catch (e) { e[\"value\"] }", 2},
+		{"let i = 0; while (true) { try { i += 1; if (i > 2) { break } } catch (e) { } } i", 3},
+		{"try { 1 } catch (e) { 2 }; e", "identifier not found: e"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		if str, ok := evaluated.(*object.String); ok {
+			testStringObject(t, str, tt.expected.(string))
+			continue
+		}
+		testLiteral(t, evaluated, tt.expected)
+	}
+
+	// Uncaught errors keep their message
+	testErrorObject(t, testEval(`throw("boom")`), "boom")
+
+	// Errors that stop an evaluation from outside of the program cannot be caught
+	program := parser.New(lexer.New("while (true) { try { while (true) { } } catch (e) { } }")).ParseProgram()
+	evaluated := EvalContext(context.Background(), program, object.NewEnvironment(), object.Limits{MaxSteps: 1000})
+	testErrorObject(t, evaluated, "step limit exceeded: 1000 steps")
+}
+
+func TestTailCalls(t *testing.T) {
+	// Without tail calls, these would need far more than 16 MB of Go stack
+	defer debug.SetMaxStack(debug.SetMaxStack(16 << 20))
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let count = fn(n, acc) { if (n == 0) { acc } else { count(n - 1, acc + 1) } }; count(100000, 0)", 100000},
+		{"let count = fn(n) { if (n == 0) { return 0; } return count(n - 1); }; count(100000)", 0},
+		{
+			"let even = fn(n) { if (n == 0) { true } else { odd(n - 1) } };" +
+				"let odd = fn(n) { if (n == 0) { false } else { even(n - 1) } };" +
+				"even(100001)",
+			false,
+		},
+		{
+			"let reduce = fn(arr, initial, f) {" +
+				"  let iter = fn(arr, result) { if (len(arr) == 0) { result } else { iter(rest(arr), f(result, first(arr))) } };" +
+				"  iter(arr, initial)" +
+				"};" +
+				"let range = fn(n, acc) { if (n == 0) { acc } else { range(n - 1, push(acc, n)) } };" +
+				"reduce(range(2000, []), 0, fn(sum, x) { sum + x })",
+			2001000,
+		},
+		// Calls that are not in tail position still nest
+		{"let f = fn(n) { if (n == 0) { 0 } else { 1 + f(n - 1) } }; f(100)", 100},
+		{"let f = fn() { try { g() } catch (e) { 1 } }; let g = fn() { throw(0) }; f()", 1},
+		{"let f = fn() { g() }; let g = fn() { len }; f()(\"ab\")", 2},
+	}
+
+	for _, tt := range tests {
+		testLiteral(t, testEval(tt.input), tt.expected)
+	}
+
+	// Calls in tail position do not count against the call depth limit
+	program := parser.New(lexer.New("let count = fn(n) { if (n > 0) { count(n - 1) } else { n } }; count(1000)")).ParseProgram()
+	evaluated := EvalContext(context.Background(), program, object.NewEnvironment(), object.Limits{MaxDepth: 10})
+	testIntegerObject(t, evaluated, 0)
+}
+
 func TestLetStatements(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -242,6 +653,53 @@ func TestFunctionApplication(t *testing.T) {
 	}
 }
 
+func TestDefaultAndRestParameters(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let add = fn(a, b = 2) { a + b }; add(1)", 3},
+		{"let add = fn(a, b = 2) { a + b }; add(1, 5)", 6},
+		{"let f = fn(a = 1, b = a * 10) { a + b }; f()", 11},
+		{"let f = fn(a = 1, b = a * 10) { a + b }; f(2)", 22},
+		{"let n = 1; let f = fn(x = n) { x }; n = 5; f()", 5},
+		{"let f = fn(first, ...rest) { rest }; f(1, 2, 3)", []int{2, 3}},
+		{"let f = fn(first, ...rest) { rest }; f(1)", []int{}},
+		{"let f = fn(...all) { len(all) }; f()", 0},
+		{"let f = fn(a, b = 2, ...rest) { len(rest) + a + b }; f(1)", 3},
+		{"let f = fn(a, b = 2, ...rest) { push(rest, a + b) }; f(1, 3, 9)", []int{9, 4}},
+		{"let f = fn(a, b = missing) { a }; f(1)", "identifier not found: missing"},
+		{"let f = fn(a, b = missing) { a }; f(1, 2)", 1},
+	}
+
+	for _, tt := range tests {
+		testLiteral(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestArityErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let add = fn(a, b) { a + b };\nadd(1)", "ERROR: 2:1: wrong number of arguments to add. got=1, want=2"},
+		{"let add = fn(a, b) { a + b };\nadd(1, 2, 3)", "ERROR: 2:1: wrong number of arguments to add. got=3, want=2"},
+		{"fn() { 1 }(1)", "ERROR: 1:1: wrong number of arguments. got=1, want=0"},
+		{"let f = fn(a, b = 1) { a }; f()", "ERROR: 1:29: wrong number of arguments to f. got=0, want=1 to 2"},
+		{"let f = fn(a, ...rest) { a }; f()", "ERROR: 1:31: wrong number of arguments to f. got=0, want=at least 1"},
+		{"let f = fn(a) { a };\nlet g = fn() { f() };\ng()", "ERROR: 2:16: wrong number of arguments to f. got=0, want=1"},
+		{"let f = fn(a, b = -true) { a }; f(1)", "ERROR: 1:19: unknown operator: -BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated == nil || evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong error for %q. expected=%q, got=%+v",
+				tt.input, tt.expected, evaluated)
+		}
+	}
+}
+
 func TestEnclosingEnvironments(t *testing.T) {
 	input := `
 		let first = 10;
@@ -283,6 +741,35 @@ func TestStringConcatenation(t *testing.T) {
 	testStringObject(t, testEval(input), "Hello World!")
 }
 
+func TestStringEscapes(t *testing.T) {
+	input := `"tab\there \"quoted\" \\ \u{E9}"`
+	testStringObject(t, testEval(input), "tab\there \"quoted\" \\ é")
+}
+
+func TestStringIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`"abc"[0]`, "a"},
+		{`"abc"[2]`, "c"},
+		{`"héllo"[1]`, "é"},
+		{`"héllo"[4]`, "o"},
+		{`"abc"[3]`, nil},
+		{`"abc"[-1]`, nil},
+		{`""[0]`, nil},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if expected, ok := tt.expected.(string); ok {
+			testStringObject(t, evaluated, expected)
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
 func TestBuiltinFunctions(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -291,6 +778,8 @@ func TestBuiltinFunctions(t *testing.T) {
 		{`len("")`, 0},
 		{`len("four")`, 4},
 		{`len("hello world")`, 11},
+		{`len("héllo")`, 5},
+		{`len("\u{1F600}")`, 1},
 		{`len(1)`, "argument to `len` not supported, got INTEGER"},
 		{`len("one", "two")`, "wrong number of arguments. got=2, want=1"},
 		{`len([1, 2, 3])`, 3},
@@ -476,6 +965,8 @@ func testLiteral(t *testing.T, obj object.Object, expected interface{}) object.O
 		return testIntegerObject(t, obj, int64(expected))
 	case int64:
 		return testIntegerObject(t, obj, expected)
+	case float64:
+		return testFloatObject(t, obj, expected)
 	case string:
 		return testErrorObject(t, obj, expected)
 	case bool:
@@ -505,6 +996,21 @@ func testIntegerObject(t *testing.T, obj object.Object, expected int64) *object.
 	return intObj
 }
 
+// Test a float object
+func testFloatObject(t *testing.T, obj object.Object, expected float64) *object.Float {
+	floatObj, ok := obj.(*object.Float)
+	if !ok {
+		t.Fatalf("object is not Float. got=%T (%+v)", obj, obj)
+	}
+
+	if floatObj.Value != expected {
+		t.Fatalf("object has wrong value. got=%g, want=%g",
+			floatObj.Value, expected)
+	}
+
+	return floatObj
+}
+
 // Test a string object
 func testStringObject(t *testing.T, obj object.Object, expected string) *object.String {
 	strObj, ok := obj.(*object.String)
@@ -0,0 +1,44 @@
+package evaluator
+
+import (
+	"context"
+
+	"github.com/pwbrown/go-monkey/ast"
+	"github.com/pwbrown/go-monkey/object"
+	"github.com/pwbrown/go-monkey/token"
+)
+
+// A Hook observes an evaluation, e.g. to implement a debugger. Its methods
+// are called on the evaluating goroutine and may block to pause the program.
+// An error returned by a hook stops the evaluation with that error
+type Hook interface {
+	// Called before each statement of a program or a block is evaluated
+	Statement(stmt ast.Statement, env *object.Environment) *object.Error
+
+	// Called before the body of a function is evaluated, with env holding
+	// its parameters. The call is made at pos
+	Call(fn *object.Function, env *object.Environment, pos token.Position) *object.Error
+
+	// Called after the body of a function is evaluated, unless Call returned
+	// an error. The result is nil when the function ends with a tail call,
+	// which replaces it
+	Return(fn *object.Function, result object.Object)
+}
+
+type hookKey struct{}
+
+// Return a context that makes evaluations under it, such as EvalContext,
+// report to a hook
+func WithHook(ctx context.Context, hook Hook) context.Context {
+	return context.WithValue(ctx, hookKey{}, hook)
+}
+
+// Return the hook of the evaluation a budget belongs to, or nil
+func hookOf(budget *object.Budget) Hook {
+	ctx := budget.Context()
+	if ctx == nil {
+		return nil
+	}
+	hook, _ := ctx.Value(hookKey{}).(Hook)
+	return hook
+}
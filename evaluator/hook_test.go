@@ -0,0 +1,132 @@
+package evaluator
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/pwbrown/go-monkey/ast"
+	"github.com/pwbrown/go-monkey/lexer"
+	"github.com/pwbrown/go-monkey/object"
+	"github.com/pwbrown/go-monkey/parser"
+	"github.com/pwbrown/go-monkey/token"
+)
+
+// A hook recording the events of an evaluation, optionally failing at the
+// statement or the call on a line
+type recordingHook struct {
+	events     []string
+	failAt     int
+	failCallAt int
+}
+
+func (h *recordingHook) Statement(stmt ast.Statement, env *object.Environment) *object.Error {
+	h.events = append(h.events, fmt.Sprintf("statement %d", stmt.Pos().Line))
+	if stmt.Pos().Line == h.failAt {
+		return &object.Error{Message: "stopped", Kind: object.CANCELED_ERR}
+	}
+	return nil
+}
+
+func (h *recordingHook) Call(fn *object.Function, env *object.Environment, pos token.Position) *object.Error {
+	names := []string{}
+	for e := env; e != nil; e = e.Outer() {
+		names = append(names, e.Names()...)
+	}
+	h.events = append(h.events, fmt.Sprintf("call %s at %d %v", fn.Name, pos.Line, names))
+	if pos.Line == h.failCallAt {
+		return &object.Error{Message: "stopped", Kind: object.CANCELED_ERR}
+	}
+	return nil
+}
+
+func (h *recordingHook) Return(fn *object.Function, result object.Object) {
+	if result == nil {
+		h.events = append(h.events, "tail "+fn.Name)
+		return
+	}
+	h.events = append(h.events, "return "+fn.Name+" "+result.Inspect())
+}
+
+func TestHook(t *testing.T) {
+	input := `let count = fn(n) {
+  if (n == 0) { return 0; }
+  count(n - 1)
+};
+let x = count(1);
+x`
+
+	tests := []struct {
+		failAt     int
+		failCallAt int
+		expected   []string
+		result     string
+	}{
+		{
+			0,
+			0,
+			[]string{
+				"statement 1",
+				"statement 5",
+				"call count at 5 [n count]",
+				"statement 2",
+				"statement 3",
+				"tail count",
+				"call count at 3 [n count]",
+				"statement 2",
+				"statement 2",
+				"return count 0",
+				"statement 6",
+			},
+			"0",
+		},
+		{
+			3,
+			0,
+			[]string{
+				"statement 1",
+				"statement 5",
+				"call count at 5 [n count]",
+				"statement 2",
+				"statement 3",
+				"return count ERROR: 3:3: stopped",
+			},
+			"ERROR: 3:3: stopped",
+		},
+		// Return is not called for a call stopped by the hook
+		{
+			0,
+			3,
+			[]string{
+				"statement 1",
+				"statement 5",
+				"call count at 5 [n count]",
+				"statement 2",
+				"statement 3",
+				"tail count",
+				"call count at 3 [n count]",
+			},
+			"ERROR: 3:3: stopped",
+		},
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(input)).ParseProgram()
+		hook := &recordingHook{failAt: tt.failAt, failCallAt: tt.failCallAt}
+		ctx := WithHook(context.Background(), hook)
+
+		result := EvalContext(ctx, program, object.NewEnvironment(), object.Limits{})
+		if result.Inspect() != tt.result {
+			t.Errorf("wrong result. want=%s, got=%s", tt.result, result.Inspect())
+		}
+		if !reflect.DeepEqual(hook.events, tt.expected) {
+			t.Errorf("wrong events.\nwant=%q\ngot =%q", tt.expected, hook.events)
+		}
+	}
+
+	// Evaluations without a hook in their context are not observed
+	if hookOf(nil) != nil || hookOf(object.NewBudget(context.Background(), object.Limits{})) != nil {
+		t.Errorf("unexpected hook")
+	}
+}
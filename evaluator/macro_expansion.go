@@ -1,16 +1,53 @@
 package evaluator
 
 import (
+	"fmt"
+	"sync/atomic"
+
 	"github.com/pwbrown/go-monkey/ast"
 	"github.com/pwbrown/go-monkey/object"
+	"github.com/pwbrown/go-monkey/parser"
+	"github.com/pwbrown/go-monkey/token"
 )
 
-func DefineMacros(program *ast.Program, env *object.Environment) {
+// A MacroError reports a macro that could not be defined or expanded
+type MacroError struct {
+	Macro   string         // name of the macro
+	Pos     token.Position // the macro call, or the definition
+	End     token.Position
+	Message string
+	Err     *object.Error // error the macro evaluated to, if any
+}
+
+// Format the error as "position: message", like a parser error
+func (e *MacroError) Error() string {
+	return e.Pos.String() + ": " + e.Message
+}
+
+// Convert the error to a diagnostic, so it can be reported with parser errors
+func (e *MacroError) Diagnostic() parser.Diagnostic {
+	return parser.Diagnostic{
+		Pos:      e.Pos,
+		End:      e.End,
+		Severity: parser.SeverityError,
+		Message:  e.Message,
+	}
+}
+
+// Define the macros bound by top level let statements and remove their
+// definitions from the program. Returns errors for invalid definitions and
+// for macro literals anywhere else, which can't be evaluated
+func DefineMacros(program *ast.Program, env *object.Environment) []*MacroError {
+	errors := []*MacroError{}
 	definitions := []int{}
 
 	for i, statement := range program.Statements {
 		if isMacroDefinition(statement) {
-			addMacro(statement, env)
+			if err := checkMacroDefinition(statement.(*ast.LetStatement)); err != nil {
+				errors = append(errors, err)
+			} else {
+				addMacro(statement, env)
+			}
 			definitions = append(definitions, i)
 		}
 	}
@@ -22,10 +59,48 @@ func DefineMacros(program *ast.Program, env *object.Environment) {
 			program.Statements[definitionIndex+1:]...,
 		)
 	}
+
+	ast.Inspect(program, func(node ast.Node) bool {
+		macro, ok := node.(*ast.MacroLiteral)
+		if ok {
+			errors = append(errors, &MacroError{
+				Pos:     macro.Pos(),
+				End:     macro.End(),
+				Message: "macros must be defined by a top level let statement",
+			})
+		}
+		return !ok
+	})
+
+	return errors
 }
 
-func ExpandMacros(program ast.Node, env *object.Environment) ast.Node {
-	return ast.Modify(program, func(node ast.Node) ast.Node {
+// Check that the parameters of a macro definition have distinct names
+func checkMacroDefinition(let *ast.LetStatement) *MacroError {
+	macro := let.Value.(*ast.MacroLiteral)
+
+	seen := map[string]bool{}
+	for _, param := range macro.Parameters {
+		if seen[param.Value] {
+			return &MacroError{
+				Macro:   let.Name.Value,
+				Pos:     param.Pos(),
+				End:     param.End(),
+				Message: fmt.Sprintf("duplicate parameter %s in macro %s", param.Value, let.Name.Value),
+			}
+		}
+		seen[param.Value] = true
+	}
+
+	return nil
+}
+
+// Replace macro calls with their expansions. A call that fails to expand is
+// left in place and reported with the macro name and the call site
+func ExpandMacros(program ast.Node, env *object.Environment) (ast.Node, []*MacroError) {
+	errors := []*MacroError{}
+
+	expanded := ast.Modify(program, func(node ast.Node) ast.Node {
 		callExpresssion, ok := node.(*ast.CallExpression)
 		if !ok {
 			return node
@@ -36,18 +111,146 @@ func ExpandMacros(program ast.Node, env *object.Environment) ast.Node {
 			return node
 		}
 
-		args := quoteArgs(callExpresssion)
-		evalEnv := extendMacroEnv(macro, args)
+		expansion, err := expandMacro(macro, callExpresssion)
+		if err != nil {
+			errors = append(errors, err)
+			return node
+		}
+
+		return expansion
+	})
 
-		evaluated := Eval(macro.Body, evalEnv)
+	return expanded, errors
+}
 
-		quote, ok := evaluated.(*object.Quote)
-		if !ok {
-			panic("we only support returning AST-nodes from macros")
+// Expand a single macro call
+func expandMacro(macro *object.Macro, call *ast.CallExpression) (ast.Node, *MacroError) {
+	name := call.Function.(*ast.Identifier).Value
+	fail := func(format string, a ...interface{}) *MacroError {
+		return &MacroError{
+			Macro:   name,
+			Pos:     call.Pos(),
+			End:     call.End(),
+			Message: fmt.Sprintf(format, a...),
 		}
+	}
 
-		return quote.Node
-	})
+	if len(call.Arguments) != len(macro.Parameters) {
+		return nil, fail("wrong number of arguments to macro %s. got=%d, want=%d",
+			name, len(call.Arguments), len(macro.Parameters))
+	}
+
+	args := quoteArgs(call)
+	evalEnv := extendMacroEnv(macro, args)
+
+	evaluated := Eval(macro.Body, evalEnv)
+	if returnValue, ok := evaluated.(*object.ReturnValue); ok {
+		evaluated = returnValue.Value
+	}
+
+	switch evaluated := evaluated.(type) {
+	case *object.Quote:
+		return renameMacroBindings(evaluated.Node, call.Arguments), nil
+	case *object.Error:
+		message := evaluated.Message
+		if evaluated.Pos.IsValid() {
+			message = evaluated.Pos.String() + ": " + message
+		}
+		err := fail("error expanding macro %s: %s", name, message)
+		err.Err = evaluated
+		return nil, err
+	default:
+		return nil, fail("macro %s must return a quoted node, got %s", name, typeName(evaluated))
+	}
+}
+
+// Counter for the fresh names given to identifiers bound by macros
+var macroBindingCounter uint64
+
+// Rename the identifiers that a macro expansion binds itself, so they can't
+// capture or shadow variables of the caller. Only the identifiers in the
+// scope of a binding are renamed: the function literal of a parameter, or
+// the function body (or the whole expansion) holding a let, for or catch.
+// Nodes passed to the macro as arguments keep their names. The fresh names
+// contain a '$', which can't appear in identifiers written by the user
+func renameMacroBindings(expanded ast.Node, arguments []ast.Expression) ast.Node {
+	fromArguments := map[ast.Node]bool{}
+	for _, argument := range arguments {
+		fromArguments[argument] = true
+	}
+
+	// Visit the nodes of a scope that come from the macro itself
+	inspectTemplate := func(scope ast.Node, f func(ast.Node) bool) {
+		ast.Inspect(scope, func(node ast.Node) bool {
+			if node == nil || fromArguments[node] {
+				return false
+			}
+			return f(node)
+		})
+	}
+
+	var renameScope func(scope ast.Node)
+	renameScope = func(scope ast.Node) {
+		binders := []*ast.Identifier{}
+		if fn, ok := scope.(*ast.FunctionLiteral); ok {
+			binders = append(binders, fn.Parameters...)
+			binders = append(binders, fn.Rest)
+		}
+
+		// Nested functions are renamed first, so that the names they bind
+		// themselves no longer match the bindings of this scope
+		inspectTemplate(scope, func(node ast.Node) bool {
+			switch node := node.(type) {
+			case *ast.FunctionLiteral:
+				if node != scope {
+					renameScope(node)
+					return false
+				}
+			case *ast.LetStatement:
+				binders = append(binders, node.Name)
+			case *ast.ForStatement:
+				binders = append(binders, node.Key, node.Value)
+			case *ast.TryExpression:
+				binders = append(binders, node.Param)
+			}
+			return true
+		})
+
+		renamed := map[string]string{}
+		for _, ident := range binders {
+			if ident == nil || fromArguments[ident] {
+				continue
+			}
+			if _, ok := renamed[ident.Value]; !ok {
+				n := atomic.AddUint64(&macroBindingCounter, 1)
+				renamed[ident.Value] = fmt.Sprintf("%s$%d", ident.Value, n)
+			}
+		}
+
+		if len(renamed) == 0 {
+			return
+		}
+
+		inspectTemplate(scope, func(node ast.Node) bool {
+			switch node := node.(type) {
+			case *ast.Identifier:
+				if name, ok := renamed[node.Value]; ok {
+					node.Value = name
+					node.Token.Literal = name
+				}
+			case *ast.LetStatement:
+				if fn, ok := node.Value.(*ast.FunctionLiteral); ok && fn.Name == node.Name.Value {
+					if name, ok := renamed[fn.Name]; ok {
+						fn.Name = name
+					}
+				}
+			}
+			return true
+		})
+	}
+
+	renameScope(expanded)
+	return expanded
 }
 
 // Checks if an AST statement is a let statement with a macro literal value
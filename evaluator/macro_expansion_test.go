@@ -101,6 +101,38 @@ func TestExpandMacros(t *testing.T) {
 			`,
 			`if (!(10 > 5)) { puts("not greater") } else { puts("greater") }`,
 		},
+		{
+			`
+				let double = macro(x) { quote(unquote(x) * 2); };
+
+				for (x in xs) { while (double(x) > 2) { break; } }
+			`,
+			`for (x in xs) { while ((x * 2) > 2) { break; } }`,
+		},
+		{
+			`
+				let double = macro(x) { quote(unquote(x) * 2); };
+
+				puts(double(1), [double(2)], {"k": double(3)});
+			`,
+			`puts((1 * 2), [(2 * 2)], {"k": (3 * 2)})`,
+		},
+		{
+			`
+				let double = macro(x) { quote(unquote(x) * 2); };
+
+				double(double(1));
+			`,
+			`((1 * 2) * 2)`,
+		},
+		{
+			`
+				let inc = macro(x) { quote(unquote(x) + 1); };
+
+				inc(1); inc(5);
+			`,
+			`(1 + 1); (5 + 1);`,
+		},
 	}
 
 	for _, tt := range tests {
@@ -109,7 +141,10 @@ func TestExpandMacros(t *testing.T) {
 
 		env := object.NewEnvironment()
 		DefineMacros(program, env)
-		expanded := ExpandMacros(program, env)
+		expanded, errors := ExpandMacros(program, env)
+		if len(errors) != 0 {
+			t.Fatalf("unexpected macro errors: %v", errors)
+		}
 
 		if expanded.String() != expected.String() {
 			t.Errorf("not equal. want=%q, got=%q",
@@ -118,6 +153,176 @@ func TestExpandMacros(t *testing.T) {
 	}
 }
 
+func TestMacroHygiene(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		// The macro's temporary doesn't collide with the caller's tmp
+		{
+			`
+				let swap = macro(a, b) {
+					quote(if (true) {
+						let tmp = unquote(a);
+						unquote(a) = unquote(b);
+						unquote(b) = tmp;
+					});
+				};
+
+				let tmp = 1;
+				let y = 2;
+				swap(tmp, y);
+				tmp * 10 + y;
+			`,
+			21,
+		},
+		// A variable bound by the macro doesn't shadow the caller's variable
+		{
+			`
+				let twice = macro(x) {
+					quote(if (true) { let value = unquote(x); value + value });
+				};
+
+				let value = 3;
+				twice(value + 1) * 100 + value;
+			`,
+			803,
+		},
+		// A function parameter bound by the macro doesn't capture the argument
+		{
+			`
+				let addTo = macro(x) {
+					quote(fn(n) { n + unquote(x) });
+				};
+
+				let n = 10;
+				addTo(n)(1);
+			`,
+			11,
+		},
+		// Expanding the same macro twice binds separate temporaries
+		{
+			`
+				let keep = macro(x) {
+					quote(if (true) { let tmp = unquote(x); tmp });
+				};
+
+				let tmp = 7;
+				keep(tmp) + keep(tmp + 1);
+			`,
+			15,
+		},
+		// A parameter is only renamed inside its function, so the macro can
+		// still refer to the caller's variable of the same name
+		{
+			`
+				let y = 10;
+				let m = macro(a) { quote(fn(y) { y }(unquote(a)) + y) };
+				m(1);
+			`,
+			11,
+		},
+		// A let in a function is only renamed inside that function
+		{
+			`
+				let y = 10;
+				let m = macro(a) { quote(fn() { let y = unquote(a); y }() * y) };
+				m(2);
+			`,
+			20,
+		},
+		// A nested function sees the renamed binding of the enclosing one
+		{
+			`
+				let n = 100;
+				let m = macro(a) { quote(fn(n) { fn() { n + unquote(a) } }(1)()) };
+				m(n);
+			`,
+			101,
+		},
+	}
+
+	for _, tt := range tests {
+		program := testParseProgram(tt.input)
+
+		macros := object.NewEnvironment()
+		DefineMacros(program, macros)
+		expanded, errors := ExpandMacros(program, macros)
+		if len(errors) != 0 {
+			t.Fatalf("unexpected macro errors: %v", errors)
+		}
+
+		evaluated := Eval(expanded, object.NewEnvironment())
+		testIntegerObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestMacroErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{
+			"let m = macro(x, x) { quote(x) };",
+			[]string{"1:18: duplicate parameter x in macro m"},
+		},
+		{
+			"let f = fn() { let m = macro() { quote(1) }; };",
+			[]string{"1:24: macros must be defined by a top level let statement"},
+		},
+		{
+			"let m = macro(a, b) { quote(unquote(a) + unquote(b)) };\nm(1);\nm(1, 2, 3);",
+			[]string{
+				"2:1: wrong number of arguments to macro m. got=1, want=2",
+				"3:1: wrong number of arguments to macro m. got=3, want=2",
+			},
+		},
+		{
+			"let m = macro(x) { 1 };\nlet y = m(2);",
+			[]string{"2:9: macro m must return a quoted node, got INTEGER"},
+		},
+		{
+			"let m = macro() { };\nm();",
+			[]string{"2:1: macro m must return a quoted node, got NULL"},
+		},
+		{
+			"let m = macro(x) { missing };\nm(1);",
+			[]string{"2:1: error expanding macro m: 1:20: identifier not found: missing"},
+		},
+		{
+			"let m = macro(x) { quote(unquote([1])) };\nm(1);",
+			[]string{"2:1: error expanding macro m: 1:26: cannot unquote ARRAY"},
+		},
+		{
+			"let m = macro() { quote() };\nm();",
+			[]string{"2:1: error expanding macro m: 1:19: wrong number of arguments to quote. got=0, want=1"},
+		},
+		{
+			"let m = macro() { return quote(1) };\nm();",
+			[]string{},
+		},
+	}
+
+	for _, tt := range tests {
+		program := testParseProgram(tt.input)
+
+		env := object.NewEnvironment()
+		errors := DefineMacros(program, env)
+		_, expandErrors := ExpandMacros(program, env)
+		errors = append(errors, expandErrors...)
+
+		if len(errors) != len(tt.expected) {
+			t.Errorf("wrong number of errors for %q. want=%v, got=%v", tt.input, tt.expected, errors)
+			continue
+		}
+		for i, err := range errors {
+			if err.Error() != tt.expected[i] {
+				t.Errorf("wrong error for %q. want=%q, got=%q", tt.input, tt.expected[i], err.Error())
+			}
+		}
+	}
+}
+
 func testParseProgram(input string) *ast.Program {
 	l := lexer.New(input)
 	p := parser.New(l)
@@ -8,15 +8,23 @@ import (
 	"github.com/pwbrown/go-monkey/token"
 )
 
+// Quote a node. The node is copied first, so that each evaluation of the
+// same quote call substitutes its own unquoted values
 func quote(node ast.Node, env *object.Environment) object.Object {
-	node = evalUnquoteCalls(node, env)
+	node, err := evalUnquoteCalls(ast.Copy(node), env)
+	if err != nil {
+		return err
+	}
 	return &object.Quote{Node: node}
 }
 
-// Evaluates any unquote calls
-func evalUnquoteCalls(quoted ast.Node, env *object.Environment) ast.Node {
-	return ast.Modify(quoted, func(node ast.Node) ast.Node {
-		if !isUnquoteCall(node) {
+// Evaluates any unquote calls. Returns the first error an unquoted
+// expression evaluated to, or an error if its value has no AST form
+func evalUnquoteCalls(quoted ast.Node, env *object.Environment) (ast.Node, *object.Error) {
+	var err *object.Error
+
+	node := ast.Modify(quoted, func(node ast.Node) ast.Node {
+		if err != nil || !isUnquoteCall(node) {
 			return node
 		}
 
@@ -30,8 +38,29 @@ func evalUnquoteCalls(quoted ast.Node, env *object.Environment) ast.Node {
 		}
 
 		unquoted := Eval(call.Arguments[0], env)
-		return convertObjectToASTNode(unquoted)
+		if isError(unquoted) {
+			err = unquoted.(*object.Error)
+			return node
+		}
+
+		converted := convertObjectToASTNode(unquoted)
+		if converted == nil {
+			err = newError("cannot unquote %s", typeName(unquoted))
+			err.Pos = call.Pos()
+			return node
+		}
+		return converted
 	})
+
+	return node, err
+}
+
+// Name the type of an object, which may be nil
+func typeName(obj object.Object) string {
+	if obj == nil {
+		return object.NULL_OBJ
+	}
+	return string(obj.Type())
 }
 
 // Convert an object back into an AST Node
@@ -44,6 +73,13 @@ func convertObjectToASTNode(obj object.Object) ast.Node {
 		}
 		return &ast.IntegerLiteral{Token: t, Value: obj.Value}
 
+	case *object.Float:
+		t := token.Token{
+			Type:    token.FLOAT,
+			Literal: object.FormatFloat(obj.Value),
+		}
+		return &ast.FloatLiteral{Token: t, Value: obj.Value}
+
 	case *object.Boolean:
 		var t token.Token
 		if obj.Value {
@@ -43,6 +43,26 @@ func TestQuoteUnquote(t *testing.T) {
 			`quote(unquote(4 + 4))`,
 			`8`,
 		},
+		{
+			`quote(unquote(1.5 * 3))`,
+			`4.5`,
+		},
+		{
+			`quote(unquote(2.5 + 0.5) + 1)`,
+			`(3.0 + 1)`,
+		},
+		{
+			`quote(f(unquote(1 + 1), g(unquote(3))))`,
+			`f(2, g(3))`,
+		},
+		{
+			`quote(fn(a, b = unquote(2 * 2)) { a + b })`,
+			`fn(a, b = 4) (a + b)`,
+		},
+		{
+			`quote({"a": unquote(1 + 1)})`,
+			`{a:2}`,
+		},
 		{
 			`quote(8 + unquote(4 + 4))`,
 			`(8 + 8)`,
@@ -0,0 +1,62 @@
+// Package format prints Monkey programs as canonical, indented source
+package format
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+
+	"github.com/pwbrown/go-monkey/ast"
+	"github.com/pwbrown/go-monkey/lexer"
+	"github.com/pwbrown/go-monkey/parser"
+)
+
+// Format source code. The filename is used in the positions of parser
+// errors. A "#!" interpreter line at the start of the source is kept
+func Source(filename string, src []byte) ([]byte, error) {
+	p := parser.New(lexer.NewFile(filename, string(src)))
+
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, errors.New(strings.Join(p.Errors(), "\n"))
+	}
+
+	var out bytes.Buffer
+	if bytes.HasPrefix(src, []byte("#!")) {
+		line := src
+		if end := bytes.IndexByte(src, '\n'); end >= 0 {
+			line = src[:end]
+		}
+		out.Write(bytes.TrimRight(line, "\r"))
+		out.WriteString("\n")
+	}
+	out.WriteString(Node(program))
+
+	return out.Bytes(), nil
+}
+
+// Format a node. The comments of a program are kept, and the layout of the
+// source is followed where positions are known: blank lines between
+// statements, blocks written on one line, and lists written one element
+// per line
+func Node(node ast.Node) string {
+	p := &printer{}
+
+	if program, ok := node.(*ast.Program); ok {
+		p.comments = program.Comments
+		p.printStatements(program.Statements)
+		p.printCommentLines(p.comments)
+		if p.midLine {
+			p.newline()
+		}
+		return p.out.String()
+	}
+
+	switch node := node.(type) {
+	case ast.Statement:
+		p.printStatement(node)
+	case ast.Expression:
+		p.printExpression(node)
+	}
+	return p.out.String()
+}
@@ -0,0 +1,112 @@
+package format
+
+import (
+	"testing"
+
+	"github.com/pwbrown/go-monkey/lexer"
+	"github.com/pwbrown/go-monkey/parser"
+)
+
+func TestSource(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x=5", "let x = 5;\n"},
+		{"return x", "return x;\n"},
+		{"x = y = 1", "x = y = 1;\n"},
+		{"1.50; 2", "1.50;\n2;\n"},
+		{`"a\"b\\c\nd\te"`, `"a\"b\\c\nd\te";` + "\n"},
+		// Minimal parentheses
+		{"(1 + 2) * 3", "(1 + 2) * 3;\n"},
+		{"1 + (2 * 3)", "1 + 2 * 3;\n"},
+		{"(1 - 2) - 3", "1 - 2 - 3;\n"},
+		{"1 - (2 - 3)", "1 - (2 - 3);\n"},
+		{"-(a + b)", "-(a + b);\n"},
+		{"!(!a)", "!!a;\n"},
+		{"-(-a)", "- -a;\n"},
+		{"- -a", "- -a;\n"},
+		{"-(!a)", "-!a;\n"},
+		{"!(-a)", "!-a;\n"},
+		{"-a[0]", "-a[0];\n"},
+		{"(-a)[0]", "(-a)[0];\n"},
+		{"(a + b)(c)", "(a + b)(c);\n"},
+		{"f(a)(b)[c]", "f(a)(b)[c];\n"},
+		{"(a = 1) + 2", "(a = 1) + 2;\n"},
+		{"fn(x) { x }(5)", "fn(x) { x }(5);\n"},
+		// Blocks
+		{"if(a){b}else{c}", "if (a) { b } else { c }\n"},
+		{"if (a) { b; c; }", "if (a) { b; c }\n"},
+		{"let f = fn(){}", "let f = fn() {};\n"},
+		{"if (a) {\nb; c\n}", "if (a) {\n    b;\n    c;\n}\n"},
+		{"while(x<3){x=x+1;}", "while (x < 3) { x = x + 1 }\n"},
+		{"for(k,v in m){\nbreak\n}", "for (k, v in m) {\n    break;\n}\n"},
+		{"for (v in m) { continue }", "for (v in m) { continue; }\n"},
+		{"let t = try{f()}catch(e){e}", "let t = try { f() } catch (e) { e };\n"},
+		{"fn(a,b=2,...rest){a}", "fn(a, b = 2, ...rest) { a };\n"},
+		{"let m = macro(a){quote(unquote(a))}", "let m = macro(a) { quote(unquote(a)) };\n"},
+		{"if (a) { b };\n[1]", "if (a) { b };\n[1];\n"},
+		{"if (a) { b }\nc", "if (a) { b }\nc;\n"},
+		// Lists
+		{"[1,2,3]", "[1, 2, 3];\n"},
+		{`{"a":1,"b":2,}`, `{"a": 1, "b": 2};` + "\n"},
+		{"f(\n1,\n2)", "f(\n    1,\n    2\n);\n"},
+		{"f(1, fn() {\nx\n})", "f(1, fn() {\n    x;\n});\n"},
+		{"let h = {\n\"a\": 1,\n\"b\": 2,\n}", "let h = {\n    \"a\": 1,\n    \"b\": 2\n};\n"},
+		// Blank lines
+		{"a\n\n\n\nb\nc", "a;\n\nb;\nc;\n"},
+		{"#!/usr/bin/env monkey\nlet x = 1", "#!/usr/bin/env monkey\nlet x = 1;\n"},
+		// Comments
+		{"// a\nlet x = 1 // b\n// c", "// a\nlet x = 1; // b\n// c\n"},
+		{"f(/* a */ 1, [/* b */]) /* c */", "f(/* a */ 1, [/* b */]); /* c */\n"},
+		{"f(1, // one\n2)", "f(\n    1, // one\n    2\n);\n"},
+		{"fn() { /* x */ }", "fn() { /* x */ };\n"},
+		{"if (a) {\nb\n\n// end\n}", "if (a) {\n    b;\n\n    // end\n}\n"},
+		{"let x = 1 + // one\n2", "let x = 1 + 2; // one\n"},
+		{"/* a\nb */ x", "/* a\nb */\nx;\n"},
+	}
+
+	for _, tt := range tests {
+		formatted, err := Source("test", []byte(tt.input))
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tt.input, err)
+			continue
+		}
+
+		if string(formatted) != tt.expected {
+			t.Errorf("%q: wrong output.\nwant=%q\ngot =%q", tt.input, tt.expected, formatted)
+			continue
+		}
+
+		again, err := Source("test", formatted)
+		if err != nil || string(again) != string(formatted) {
+			t.Errorf("%q: formatting is not idempotent. got=%q (err=%v)", tt.input, again, err)
+		}
+
+		if parse(t, tt.input) != parse(t, string(formatted)) {
+			t.Errorf("%q: formatting changed the program. got=%q", tt.input, formatted)
+		}
+	}
+}
+
+func TestSourceErrors(t *testing.T) {
+	_, err := Source("test.mk", []byte("let x 1"))
+	if err == nil {
+		t.Fatalf("expected an error")
+	}
+
+	expected := "test.mk:1:7: expected next token to be =, got INT instead"
+	if err.Error() != expected {
+		t.Errorf("wrong error. want=%q, got=%q", expected, err.Error())
+	}
+}
+
+// Parse a program and return its canonical string form
+func parse(t *testing.T, input string) string {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	return program.String()
+}
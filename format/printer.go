@@ -0,0 +1,552 @@
+package format
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/pwbrown/go-monkey/ast"
+	"github.com/pwbrown/go-monkey/object"
+	"github.com/pwbrown/go-monkey/parser"
+	"github.com/pwbrown/go-monkey/token"
+)
+
+// Indentation of one level of blocks and lists
+const indentation = "    "
+
+// Precedence of expressions that never need parentheses
+const highest = parser.INDEX + 1
+
+type printer struct {
+	out      bytes.Buffer
+	indent   int
+	midLine  bool            // something was written on the current line
+	comments []token.Comment // comments not printed yet, in source order
+	lineEnd  []string        // line comments moved to the end of the current line
+	lastLine int             // source line of the last item printed on its own line
+}
+
+// An item of a list, such as an argument or a key/value pair
+type listItem struct {
+	pos, end token.Position
+	print    func()
+}
+
+func (p *printer) write(s string) {
+	if !p.midLine {
+		p.out.WriteString(strings.Repeat(indentation, p.indent))
+		p.midLine = true
+	}
+	p.out.WriteString(s)
+}
+
+// End the current line, after the line comments moved to it
+func (p *printer) newline() {
+	if len(p.lineEnd) > 0 {
+		p.write(" " + strings.Join(p.lineEnd, " "))
+		p.lineEnd = nil
+	}
+	p.out.WriteString("\n")
+	p.midLine = false
+}
+
+// Keep one blank line before an item on a source line that is separated
+// from the last printed item by blank lines
+func (p *printer) blankLine(line int) {
+	if p.lastLine > 0 && line > p.lastLine+1 {
+		p.out.WriteString("\n")
+	}
+}
+
+// Remove and return the comments that start before a position
+func (p *printer) commentsBefore(pos token.Position) []token.Comment {
+	if !pos.IsValid() {
+		return nil
+	}
+
+	n := 0
+	for n < len(p.comments) && p.comments[n].Pos.Offset < pos.Offset {
+		n++
+	}
+
+	before := p.comments[:n]
+	p.comments = p.comments[n:]
+	return before
+}
+
+// Report whether there are comments to print before a position
+func (p *printer) hasCommentsBefore(pos token.Position) bool {
+	return pos.IsValid() && len(p.comments) > 0 && p.comments[0].Pos.Offset < pos.Offset
+}
+
+// Print comments on lines of their own
+func (p *printer) printCommentLines(comments []token.Comment) {
+	for _, comment := range comments {
+		if p.midLine {
+			p.newline()
+		}
+		p.blankLine(comment.Pos.Line)
+		p.write(comment.Text)
+		p.newline()
+		p.lastLine = comment.End.Line
+	}
+}
+
+// Print the comments before a position within the current line. Block
+// comments are written in place, line comments are moved to the end of
+// the line. Comments before a closing bracket are separated from the
+// preceding code instead of the following one
+func (p *printer) inlineComments(pos token.Position, closing bool) {
+	for _, comment := range p.commentsBefore(pos) {
+		switch {
+		case strings.HasPrefix(comment.Text, "//"):
+			p.lineEnd = append(p.lineEnd, comment.Text)
+		case closing && !p.afterOpening():
+			p.write(" " + comment.Text)
+		case closing:
+			p.write(comment.Text)
+		default:
+			p.write(comment.Text + " ")
+		}
+	}
+}
+
+// Report whether the last thing written opens a list or is a space
+func (p *printer) afterOpening() bool {
+	b := p.out.Bytes()
+	return len(b) > 0 && strings.IndexByte("([{ ", b[len(b)-1]) >= 0
+}
+
+// Print the comments that start on a source line at the end of the
+// current line
+func (p *printer) trailingComments(line int) {
+	for line > 0 && len(p.comments) > 0 && p.comments[0].Pos.Line == line {
+		comment := p.comments[0]
+		p.comments = p.comments[1:]
+
+		p.write(" " + comment.Text)
+		if comment.End.Line > p.lastLine {
+			p.lastLine = comment.End.Line
+		}
+	}
+}
+
+// Print the statements of a program or a multi-line block, one per line
+func (p *printer) printStatements(statements []ast.Statement) {
+	for i, stmt := range statements {
+		p.printCommentLines(p.commentsBefore(stmt.Pos()))
+
+		if pos := stmt.Pos(); pos.IsValid() {
+			p.blankLine(pos.Line)
+		}
+
+		p.printStatement(stmt)
+		if needsSemicolon(stmt, nextStatement(statements, i)) {
+			p.write(";")
+		}
+
+		end := stmt.End()
+		if end.IsValid() {
+			p.lastLine = end.Line
+		}
+		p.trailingComments(end.Line)
+		p.newline()
+	}
+}
+
+// Return the statement after the i-th one, or nil
+func nextStatement(statements []ast.Statement, i int) ast.Statement {
+	if i+1 < len(statements) {
+		return statements[i+1]
+	}
+	return nil
+}
+
+// Report whether a statement is terminated by a semicolon. Expressions that
+// end with a block only need one if the next statement would otherwise
+// continue the expression
+func needsSemicolon(stmt, next ast.Statement) bool {
+	switch stmt := stmt.(type) {
+	case *ast.ExpressionStatement:
+		switch stmt.Expression.(type) {
+		case *ast.IfExpression, *ast.TryExpression:
+			return next != nil && continuesExpression(next)
+		}
+		return true
+	case *ast.WhileStatement, *ast.ForStatement:
+		return false
+	default:
+		return true
+	}
+}
+
+// Report whether a statement starts with a token that would continue the
+// expression before it, as a call, an index or a subtraction
+func continuesExpression(stmt ast.Statement) bool {
+	exp, ok := stmt.(*ast.ExpressionStatement)
+	if !ok {
+		return false
+	}
+
+	s := Node(exp.Expression)
+	return strings.HasPrefix(s, "(") || strings.HasPrefix(s, "[") || strings.HasPrefix(s, "-")
+}
+
+func (p *printer) printStatement(stmt ast.Statement) {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		p.write("let ")
+		p.printExpression(stmt.Name)
+		p.write(" = ")
+		p.printExpression(stmt.Value)
+
+	case *ast.ReturnStatement:
+		p.write("return")
+		if stmt.ReturnValue != nil {
+			p.write(" ")
+			p.printExpression(stmt.ReturnValue)
+		}
+
+	case *ast.ExpressionStatement:
+		if stmt.Expression != nil {
+			p.printExpression(stmt.Expression)
+		}
+
+	case *ast.WhileStatement:
+		p.write("while (")
+		p.printExpression(stmt.Condition)
+		p.write(") ")
+		p.printBlock(stmt.Body)
+
+	case *ast.ForStatement:
+		p.write("for (")
+		if stmt.Key != nil {
+			p.printExpression(stmt.Key)
+			p.write(", ")
+		}
+		p.printExpression(stmt.Value)
+		p.write(" in ")
+		p.printExpression(stmt.Iterable)
+		p.write(") ")
+		p.printBlock(stmt.Body)
+
+	case *ast.BreakStatement:
+		p.write("break")
+
+	case *ast.ContinueStatement:
+		p.write("continue")
+	}
+}
+
+// Print a block. A block written on one line in the source stays on one
+// line, others get one statement per line
+func (p *printer) printBlock(block *ast.BlockStatement) {
+	if len(block.Statements) == 0 && !p.hasCommentsBefore(block.Rbrace.Pos) {
+		p.write("{}")
+		return
+	}
+
+	if onOneLine(block.Token.Pos, block.Rbrace.Pos) {
+		if len(block.Statements) == 0 {
+			p.write("{ ")
+		} else {
+			p.write("{")
+		}
+		for i, stmt := range block.Statements {
+			p.write(" ")
+			p.inlineComments(stmt.Pos(), false)
+			p.printStatement(stmt)
+
+			last := i == len(block.Statements)-1
+			_, isExpression := stmt.(*ast.ExpressionStatement)
+			if needsSemicolon(stmt, nextStatement(block.Statements, i)) && !(last && isExpression) {
+				p.write(";")
+			}
+		}
+		p.inlineComments(block.Rbrace.Pos, true)
+		p.write(" }")
+		return
+	}
+
+	p.write("{")
+	p.newline()
+	p.indent++
+	p.lastLine = block.Token.Pos.Line
+
+	p.printStatements(block.Statements)
+	p.printCommentLines(p.commentsBefore(block.Rbrace.Pos))
+
+	p.indent--
+	p.write("}")
+	p.lastLine = block.Rbrace.Pos.Line
+}
+
+// Report whether two known positions are on the same line
+func onOneLine(pos, end token.Position) bool {
+	return pos.IsValid() && end.IsValid() && pos.Line == end.Line
+}
+
+// Return the precedence of an expression as an operand
+func precedence(exp ast.Expression) int {
+	switch exp := exp.(type) {
+	case *ast.AssignExpression:
+		return parser.ASSIGN
+	case *ast.InfixExpression:
+		return parser.Precedence(token.TokenType(exp.Operator))
+	case *ast.PrefixExpression:
+		return parser.PREFIX
+	case *ast.CallExpression:
+		return parser.CALL
+	case *ast.IndexExpression:
+		return parser.INDEX
+	default:
+		return highest
+	}
+}
+
+// Print an operand, in parentheses if it binds less tightly than its operator
+func (p *printer) printOperand(exp ast.Expression, parenthesize bool) {
+	if !parenthesize {
+		p.printExpression(exp)
+		return
+	}
+
+	p.write("(")
+	p.printExpression(exp)
+	p.write(")")
+}
+
+func (p *printer) printExpression(exp ast.Expression) {
+	p.inlineComments(exp.Pos(), false)
+
+	switch exp := exp.(type) {
+	case *ast.Identifier:
+		p.write(exp.Value)
+
+	case *ast.IntegerLiteral:
+		p.write(literal(exp.Token, strconv.FormatInt(exp.Value, 10)))
+
+	case *ast.FloatLiteral:
+		p.write(literal(exp.Token, object.FormatFloat(exp.Value)))
+
+	case *ast.StringLiteral:
+		p.write(quote(exp.Value))
+
+	case *ast.Boolean:
+		p.write(strconv.FormatBool(exp.Value))
+
+	case *ast.PrefixExpression:
+		p.write(exp.Operator)
+		// Keep - -a from reading as a decrement, as gofmt does
+		if right, ok := exp.Right.(*ast.PrefixExpression); ok && exp.Operator == "-" && right.Operator == "-" {
+			p.write(" ")
+		}
+		p.printOperand(exp.Right, precedence(exp.Right) < parser.PREFIX)
+
+	case *ast.InfixExpression:
+		// Operators are left associative
+		operator := parser.Precedence(token.TokenType(exp.Operator))
+		p.printOperand(exp.Left, precedence(exp.Left) < operator)
+		p.write(" " + exp.Operator + " ")
+		p.printOperand(exp.Right, precedence(exp.Right) <= operator)
+
+	case *ast.AssignExpression:
+		p.printExpression(exp.Target)
+		p.write(" " + exp.Operator + " ")
+		p.printExpression(exp.Value)
+
+	case *ast.IfExpression:
+		p.write("if (")
+		p.printExpression(exp.Condition)
+		p.write(") ")
+		p.printBlock(exp.Consequence)
+		if exp.Alternative != nil {
+			p.write(" else ")
+			p.printBlock(exp.Alternative)
+		}
+
+	case *ast.TryExpression:
+		p.write("try ")
+		p.printBlock(exp.Block)
+		p.write(" catch (")
+		p.printExpression(exp.Param)
+		p.write(") ")
+		p.printBlock(exp.Catch)
+
+	case *ast.FunctionLiteral:
+		p.write("fn(")
+		for i, param := range exp.Parameters {
+			if i > 0 {
+				p.write(", ")
+			}
+			p.printExpression(param)
+			if def := exp.Default(i); def != nil {
+				p.write(" = ")
+				p.printExpression(def)
+			}
+		}
+		if exp.Rest != nil {
+			if len(exp.Parameters) > 0 {
+				p.write(", ")
+			}
+			p.write("...")
+			p.printExpression(exp.Rest)
+		}
+		p.write(") ")
+		p.printBlock(exp.Body)
+
+	case *ast.MacroLiteral:
+		p.write("macro(")
+		for i, param := range exp.Parameters {
+			if i > 0 {
+				p.write(", ")
+			}
+			p.printExpression(param)
+		}
+		p.write(") ")
+		p.printBlock(exp.Body)
+
+	case *ast.CallExpression:
+		p.printOperand(exp.Function, precedence(exp.Function) < parser.CALL)
+		p.printList("(", ")", exp.Token, exp.Rparen, p.expressionItems(exp.Arguments))
+
+	case *ast.IndexExpression:
+		p.printOperand(exp.Left, precedence(exp.Left) < parser.CALL)
+		p.write("[")
+		p.printExpression(exp.Index)
+		p.inlineComments(exp.Rbracket.Pos, true)
+		p.write("]")
+
+	case *ast.ArrayLiteral:
+		p.printList("[", "]", exp.Token, exp.Rbracket, p.expressionItems(exp.Elements))
+
+	case *ast.HashLiteral:
+		items := []listItem{}
+		for _, key := range exp.Keys() {
+			key, value := key, exp.Pairs[key]
+			items = append(items, listItem{
+				pos: key.Pos(),
+				end: value.End(),
+				print: func() {
+					p.printExpression(key)
+					p.write(": ")
+					p.printExpression(value)
+				},
+			})
+		}
+		p.printList("{", "}", exp.Token, exp.Rbrace, items)
+	}
+}
+
+// Turn expressions into list items
+func (p *printer) expressionItems(expressions []ast.Expression) []listItem {
+	items := []listItem{}
+	for _, exp := range expressions {
+		exp := exp
+		items = append(items, listItem{
+			pos:   exp.Pos(),
+			end:   exp.End(),
+			print: func() { p.printExpression(exp) },
+		})
+	}
+	return items
+}
+
+// Print a comma separated list between brackets. If the source starts an
+// item on a new line, each item is printed on a line of its own
+func (p *printer) printList(open, close string, openTok, closeTok token.Token, items []listItem) {
+	if !isMultiLine(openTok, closeTok, items) {
+		p.write(open)
+		for i, item := range items {
+			if i > 0 {
+				p.write(", ")
+			}
+			item.print()
+		}
+		p.inlineComments(closeTok.Pos, true)
+		p.write(close)
+		return
+	}
+
+	p.write(open)
+	p.newline()
+	p.indent++
+	p.lastLine = openTok.Pos.Line
+
+	for i, item := range items {
+		p.printCommentLines(p.commentsBefore(item.pos))
+		item.print()
+		if i < len(items)-1 {
+			p.write(",")
+		}
+		p.lastLine = item.end.Line
+		p.trailingComments(item.end.Line)
+		p.newline()
+	}
+	p.printCommentLines(p.commentsBefore(closeTok.Pos))
+
+	p.indent--
+	p.write(close)
+	p.lastLine = closeTok.Pos.Line
+}
+
+// Report whether a list is written over multiple lines: an item starts on
+// a later line than the end of the opening bracket or of the item before
+// it, or the closing bracket is on a line after the last item
+func isMultiLine(openTok, closeTok token.Token, items []listItem) bool {
+	if len(items) == 0 || !openTok.Pos.IsValid() {
+		return false
+	}
+
+	line := openTok.Pos.Line
+	for _, item := range items {
+		if !item.pos.IsValid() || !item.end.IsValid() {
+			return false
+		}
+		if item.pos.Line != line {
+			return true
+		}
+		line = item.end.Line
+	}
+
+	return closeTok.Pos.IsValid() && closeTok.Pos.Line != line
+}
+
+// Return the source text of a literal token, or a fallback for literals
+// without one
+func literal(tok token.Token, fallback string) string {
+	if tok.Literal != "" {
+		return tok.Literal
+	}
+	return fallback
+}
+
+// Quote a string value, escaping characters that can't appear as they are
+func quote(s string) string {
+	var out strings.Builder
+
+	out.WriteByte('"')
+	for _, ch := range s {
+		switch ch {
+		case '"':
+			out.WriteString(`\"`)
+		case '\\':
+			out.WriteString(`\\`)
+		case '\n':
+			out.WriteString(`\n`)
+		case '\t':
+			out.WriteString(`\t`)
+		default:
+			if unicode.IsPrint(ch) {
+				out.WriteRune(ch)
+			} else {
+				fmt.Fprintf(&out, `\u{%x}`, ch)
+			}
+		}
+	}
+	out.WriteByte('"')
+
+	return out.String()
+}
@@ -1 +1,3 @@
-module github.com/pwbrown/go-monkey
\ No newline at end of file
+module github.com/pwbrown/go-monkey
+
+go 1.16
@@ -0,0 +1,60 @@
+package framing
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestWriteAndReadMessage(t *testing.T) {
+	var buf bytes.Buffer
+	messages := []interface{}{
+		map[string]string{"method": "initialize"},
+		[]int{1, 2, 3},
+	}
+	for _, msg := range messages {
+		if err := WriteMessage(&buf, msg); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	expected := "Content-Length: 23\r\n\r\n{\"method\":\"initialize\"}Content-Length: 7\r\n\r\n[1,2,3]"
+	if buf.String() != expected {
+		t.Errorf("wrong output. want=%q, got=%q", expected, buf.String())
+	}
+
+	r := bufio.NewReader(&buf)
+	for _, want := range []string{`{"method":"initialize"}`, `[1,2,3]`} {
+		content, err := ReadMessage(r)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if string(content) != want {
+			t.Errorf("wrong content. want=%q, got=%q", want, content)
+		}
+	}
+
+	if _, err := ReadMessage(r); err != io.EOF {
+		t.Errorf("expected io.EOF at the end of the input, got %v", err)
+	}
+}
+
+func TestReadMessageErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"Content-Type: text\r\n\r\n{}", `invalid Content-Length header ""`},
+		{"Content-Length: -1\r\n\r\n", `invalid Content-Length header "-1"`},
+		{"Content-Length: 10\r\n\r\n{}", "unexpected EOF"},
+	}
+
+	for _, tt := range tests {
+		_, err := ReadMessage(bufio.NewReader(strings.NewReader(tt.input)))
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong error for %q. want=%q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+}
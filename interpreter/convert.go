@@ -0,0 +1,260 @@
+package interpreter
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/pwbrown/go-monkey/evaluator"
+	"github.com/pwbrown/go-monkey/object"
+)
+
+var (
+	objectType = reflect.TypeOf((*object.Object)(nil)).Elem()
+	errorType  = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// Convert a Go value to a Monkey object. Supported are nil, booleans,
+// integers, floats, strings, slices, maps with hashable keys, functions (see
+// Interpreter.RegisterFunc) and values that already are objects
+func ToObject(value interface{}) (object.Object, error) {
+	if value == nil {
+		return evaluator.NULL, nil
+	}
+	if obj, ok := value.(object.Object); ok {
+		return obj, nil
+	}
+
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			return evaluator.TRUE, nil
+		}
+		return evaluator.FALSE, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &object.Integer{Value: v.Int()}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &object.Integer{Value: int64(v.Uint())}, nil
+	case reflect.Float32, reflect.Float64:
+		return &object.Float{Value: v.Float()}, nil
+	case reflect.String:
+		return &object.String{Value: v.String()}, nil
+	case reflect.Slice, reflect.Array:
+		elements := make([]object.Object, v.Len())
+		for i := range elements {
+			el, err := ToObject(v.Index(i).Interface())
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = el
+		}
+		return &object.Array{Elements: elements}, nil
+	case reflect.Map:
+		pairs := make(map[object.HashKey]object.HashPair)
+		iter := v.MapRange()
+		for iter.Next() {
+			key, err := ToObject(iter.Key().Interface())
+			if err != nil {
+				return nil, err
+			}
+			hashKey, ok := key.(object.Hashable)
+			if !ok {
+				return nil, fmt.Errorf("unusable as hash key: %s", key.Type())
+			}
+			val, err := ToObject(iter.Value().Interface())
+			if err != nil {
+				return nil, err
+			}
+			pairs[hashKey.HashKey()] = object.HashPair{Key: key, Value: val}
+		}
+		return &object.Hash{Pairs: pairs}, nil
+	case reflect.Func:
+		return wrapFunc("function", value)
+	}
+
+	return nil, fmt.Errorf("cannot convert %T to a Monkey value", value)
+}
+
+// Convert a Monkey object to a Go value. Integers become int64, floats
+// float64, arrays []interface{} and hashes map[interface{}]interface{}.
+// Objects without a Go equivalent (e.g. functions) are returned unchanged
+func ToGo(obj object.Object) interface{} {
+	switch obj := obj.(type) {
+	case nil, *object.Null:
+		return nil
+	case *object.Integer:
+		return obj.Value
+	case *object.Float:
+		return obj.Value
+	case *object.String:
+		return obj.Value
+	case *object.Boolean:
+		return obj.Value
+	case *object.Array:
+		elements := make([]interface{}, len(obj.Elements))
+		for i, el := range obj.Elements {
+			elements[i] = ToGo(el)
+		}
+		return elements
+	case *object.Hash:
+		pairs := make(map[interface{}]interface{}, len(obj.Pairs))
+		for _, pair := range obj.Pairs {
+			pairs[ToGo(pair.Key)] = ToGo(pair.Value)
+		}
+		return pairs
+	default:
+		return obj
+	}
+}
+
+// Adapt a Go function to a builtin, converting arguments and results
+func wrapFunc(name string, fn interface{}) (*object.Builtin, error) {
+	fnValue := reflect.ValueOf(fn)
+	fnType := fnValue.Type()
+	if fnType.Kind() != reflect.Func {
+		return nil, fmt.Errorf("cannot register %T as a function", fn)
+	}
+
+	numOut := fnType.NumOut()
+	returnsError := numOut > 0 && fnType.Out(numOut-1) == errorType
+	if numOut > 2 || numOut == 2 && !returnsError {
+		return nil, fmt.Errorf("function %s must return at most a value and an error", name)
+	}
+
+	builtin := func(args ...object.Object) object.Object {
+		numIn := fnType.NumIn()
+		if !fnType.IsVariadic() && len(args) != numIn {
+			return newError("wrong number of arguments. got=%d, want=%d", len(args), numIn)
+		}
+		if fnType.IsVariadic() && len(args) < numIn-1 {
+			return newError("wrong number of arguments. got=%d, want at least %d", len(args), numIn-1)
+		}
+
+		in := make([]reflect.Value, len(args))
+		for i, arg := range args {
+			var paramType reflect.Type
+			if fnType.IsVariadic() && i >= numIn-1 {
+				paramType = fnType.In(numIn - 1).Elem()
+			} else {
+				paramType = fnType.In(i)
+			}
+
+			v, err := fromObject(arg, paramType)
+			if err != nil {
+				return newError("argument %d to `%s`: %s", i+1, name, err)
+			}
+			in[i] = v
+		}
+
+		out := fnValue.Call(in)
+
+		if returnsError {
+			if err, _ := out[len(out)-1].Interface().(error); err != nil {
+				return newError("%s", err)
+			}
+			out = out[:len(out)-1]
+		}
+		if len(out) == 0 {
+			return nil
+		}
+
+		result, err := ToObject(out[0].Interface())
+		if err != nil {
+			return newError("result of `%s`: %s", name, err)
+		}
+		return result
+	}
+
+	return &object.Builtin{Fn: builtin}, nil
+}
+
+// Convert a Monkey object to a Go value of a specific type
+func fromObject(obj object.Object, t reflect.Type) (reflect.Value, error) {
+	if t == objectType {
+		return reflect.ValueOf(&obj).Elem(), nil
+	}
+
+	mismatch := func(want string) (reflect.Value, error) {
+		return reflect.Value{}, fmt.Errorf("must be %s, got %s", want, obj.Type())
+	}
+
+	switch t.Kind() {
+	case reflect.Interface:
+		value := ToGo(obj)
+		if value == nil {
+			return reflect.Zero(t), nil
+		}
+		v := reflect.ValueOf(value)
+		if !v.Type().AssignableTo(t) {
+			return mismatch(t.String())
+		}
+		return v, nil
+	case reflect.Bool:
+		b, ok := obj.(*object.Boolean)
+		if !ok {
+			return mismatch(object.BOOLEAN_OBJ)
+		}
+		return reflect.ValueOf(b.Value).Convert(t), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		i, ok := obj.(*object.Integer)
+		if !ok {
+			return mismatch(object.INTEGER_OBJ)
+		}
+		return reflect.ValueOf(i.Value).Convert(t), nil
+	case reflect.Float32, reflect.Float64:
+		// Integers are promoted the same way arithmetic promotes them
+		switch n := obj.(type) {
+		case *object.Float:
+			return reflect.ValueOf(n.Value).Convert(t), nil
+		case *object.Integer:
+			return reflect.ValueOf(float64(n.Value)).Convert(t), nil
+		}
+		return mismatch(object.FLOAT_OBJ)
+	case reflect.String:
+		s, ok := obj.(*object.String)
+		if !ok {
+			return mismatch(object.STRING_OBJ)
+		}
+		return reflect.ValueOf(s.Value).Convert(t), nil
+	case reflect.Slice:
+		arr, ok := obj.(*object.Array)
+		if !ok {
+			return mismatch(object.ARRAY_OBJ)
+		}
+		slice := reflect.MakeSlice(t, len(arr.Elements), len(arr.Elements))
+		for i, el := range arr.Elements {
+			v, err := fromObject(el, t.Elem())
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			slice.Index(i).Set(v)
+		}
+		return slice, nil
+	case reflect.Map:
+		hash, ok := obj.(*object.Hash)
+		if !ok {
+			return mismatch(object.HASH_OBJ)
+		}
+		m := reflect.MakeMapWithSize(t, len(hash.Pairs))
+		for _, pair := range hash.Pairs {
+			key, err := fromObject(pair.Key, t.Key())
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			val, err := fromObject(pair.Value, t.Elem())
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			m.SetMapIndex(key, val)
+		}
+		return m, nil
+	}
+
+	return reflect.Value{}, fmt.Errorf("unsupported parameter type %s", t)
+}
+
+// Format and return a new error object
+func newError(format string, a ...interface{}) *object.Error {
+	return &object.Error{Message: fmt.Sprintf(format, a...)}
+}
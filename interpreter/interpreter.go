@@ -0,0 +1,206 @@
+package interpreter
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/pwbrown/go-monkey/evaluator"
+	"github.com/pwbrown/go-monkey/lexer"
+	"github.com/pwbrown/go-monkey/object"
+	"github.com/pwbrown/go-monkey/parser"
+)
+
+// An Interpreter is an isolated Monkey runtime that can be embedded in a Go
+// program. Each interpreter owns its globals, macros and builtin table, so
+// several of them can be used side by side
+type Interpreter struct {
+	builtins *object.Environment // host builtins, the outermost scope
+	globals  *object.Environment // top-level bindings of evaluated programs
+	macros   *object.Environment
+	limits   object.Limits
+}
+
+// A ParseError is returned when source code could not be parsed, or its
+// macros could not be defined or expanded
+type ParseError struct {
+	Errors      []string
+	Diagnostics []parser.Diagnostic
+}
+
+func (e *ParseError) Error() string {
+	return strings.Join(e.Errors, "\n")
+}
+
+// A RuntimeError is returned when a program evaluates to an error object.
+// Errors caused by cancellation or exceeded limits have a non-empty Err.Kind
+type RuntimeError struct {
+	Err *object.Error
+}
+
+func (e *RuntimeError) Error() string {
+	return e.Err.Inspect()
+}
+
+// Create a new interpreter with the default builtins
+func New() *Interpreter {
+	builtins := object.NewEnvironment()
+
+	return &Interpreter{
+		builtins: builtins,
+		globals:  object.NewEnclosedEnvironment(builtins),
+		macros:   object.NewEnvironment(),
+	}
+}
+
+// Limit the resources used by each later evaluation or call
+func (i *Interpreter) SetLimits(limits object.Limits) {
+	i.limits = limits
+}
+
+// Register a builtin function. Host builtins take precedence over the
+// default builtins of the same name, but can be shadowed by script bindings
+func (i *Interpreter) Register(name string, fn object.BuiltinFunction) {
+	i.builtins.Set(name, &object.Builtin{Fn: fn})
+}
+
+// Register an ordinary Go function as a builtin, converting arguments and
+// results with ToObject and ToGo. The function may return a second (or
+// only) result of type error, which is raised as a Monkey error
+func (i *Interpreter) RegisterFunc(name string, fn interface{}) error {
+	builtin, err := wrapFunc(name, fn)
+	if err != nil {
+		return err
+	}
+
+	i.builtins.Set(name, builtin)
+	return nil
+}
+
+// Redirect the output of `puts` for this interpreter
+func (i *Interpreter) SetOutput(w io.Writer) {
+	i.Register("puts", func(args ...object.Object) object.Object {
+		for _, arg := range args {
+			fmt.Fprintln(w, arg.Inspect())
+		}
+
+		return nil
+	})
+}
+
+// Bind a global variable to a Go value (see ToObject for supported types)
+func (i *Interpreter) Set(name string, value interface{}) error {
+	obj, err := ToObject(value)
+	if err != nil {
+		return err
+	}
+
+	i.globals.Set(name, obj)
+	return nil
+}
+
+// Look up a global variable or builtin by name
+func (i *Interpreter) Get(name string) (object.Object, bool) {
+	return i.globals.Get(name)
+}
+
+// Evaluate source code and return the value of its last statement
+func (i *Interpreter) Eval(source string) (object.Object, error) {
+	return i.EvalContext(context.Background(), source)
+}
+
+// Evaluate source code, stopping with a RuntimeError when ctx is done
+func (i *Interpreter) EvalContext(ctx context.Context, source string) (object.Object, error) {
+	return i.eval(ctx, lexer.New(source))
+}
+
+// Evaluate a source file and return the value of its last statement
+func (i *Interpreter) EvalFile(filename string) (object.Object, error) {
+	source, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	return i.eval(context.Background(), lexer.NewFile(filename, string(source)))
+}
+
+// Call a function bound in the interpreter with Go arguments
+func (i *Interpreter) Call(name string, args ...interface{}) (object.Object, error) {
+	return i.CallContext(context.Background(), name, args...)
+}
+
+// Call a function bound in the interpreter, stopping with a RuntimeError
+// when ctx is done
+func (i *Interpreter) CallContext(ctx context.Context, name string, args ...interface{}) (object.Object, error) {
+	fn, ok := i.Get(name)
+	if !ok {
+		return nil, fmt.Errorf("identifier not found: %s", name)
+	}
+
+	objects := make([]object.Object, len(args))
+	for idx, arg := range args {
+		obj, err := ToObject(arg)
+		if err != nil {
+			return nil, err
+		}
+		objects[idx] = obj
+	}
+
+	return result(evaluator.ApplyContext(ctx, fn, objects, i.limits))
+}
+
+// Parse, expand macros and evaluate a program in the interpreter's scope.
+// Macro expansion and evaluation share one budget
+func (i *Interpreter) eval(ctx context.Context, l *lexer.Lexer) (object.Object, error) {
+	p := parser.New(l)
+
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, &ParseError{Errors: p.Errors(), Diagnostics: p.Diagnostics()}
+	}
+
+	budget := object.NewBudget(ctx, i.limits)
+	i.macros.SetBudget(budget)
+	i.globals.SetBudget(budget)
+	defer i.macros.SetBudget(nil)
+	defer i.globals.SetBudget(nil)
+
+	macroErrors := evaluator.DefineMacros(program, i.macros)
+	expanded, expandErrors := evaluator.ExpandMacros(program, i.macros)
+	macroErrors = append(macroErrors, expandErrors...)
+	if len(macroErrors) != 0 {
+		return nil, newMacroError(macroErrors)
+	}
+
+	return result(evaluator.Eval(expanded, i.globals))
+}
+
+// Turn failed macro definitions and expansions into an error. Macros
+// stopped by cancellation or a limit report it as a runtime error of that
+// kind, other failures are reported like parser errors
+func newMacroError(macroErrors []*evaluator.MacroError) error {
+	err := &ParseError{Errors: []string{}, Diagnostics: []parser.Diagnostic{}}
+
+	for _, macroErr := range macroErrors {
+		if macroErr.Err != nil && !macroErr.Err.Catchable() {
+			return &RuntimeError{Err: macroErr.Err}
+		}
+		err.Errors = append(err.Errors, macroErr.Error())
+		err.Diagnostics = append(err.Diagnostics, macroErr.Diagnostic())
+	}
+
+	return err
+}
+
+// Turn an evaluated object into a result, separating out errors
+func result(obj object.Object) (object.Object, error) {
+	if err, ok := obj.(*object.Error); ok {
+		return nil, &RuntimeError{Err: err}
+	}
+	if obj == nil {
+		return evaluator.NULL, nil
+	}
+	return obj, nil
+}
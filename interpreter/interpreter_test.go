@@ -0,0 +1,293 @@
+package interpreter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pwbrown/go-monkey/object"
+)
+
+func TestEval(t *testing.T) {
+	interp := New()
+
+	if _, err := interp.Eval("let add = fn(a, b) { a + b };"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	result, err := interp.Eval("add(1, 2)")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if ToGo(result) != int64(3) {
+		t.Errorf("wrong result. want=3, got=%s", result.Inspect())
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	interp := New()
+
+	_, err := interp.Eval("let x 5;")
+	if _, ok := err.(*ParseError); !ok {
+		t.Errorf("expected ParseError, got=%T (%v)", err, err)
+	}
+
+	_, err = interp.Eval("let m = macro(x) { quote(unquote(x)) };\nm(1, 2)")
+	parseErr, ok := err.(*ParseError)
+	if !ok {
+		t.Fatalf("expected ParseError, got=%T (%v)", err, err)
+	}
+	if parseErr.Error() != "2:1: wrong number of arguments to macro m. got=2, want=1" {
+		t.Errorf("wrong macro error. got=%q", parseErr.Error())
+	}
+	if len(parseErr.Diagnostics) != 1 || parseErr.Diagnostics[0].Pos.Line != 2 {
+		t.Errorf("wrong macro diagnostics. got=%v", parseErr.Diagnostics)
+	}
+
+	_, err = interp.Eval("5 + true")
+	runtimeErr, ok := err.(*RuntimeError)
+	if !ok {
+		t.Fatalf("expected RuntimeError, got=%T (%v)", err, err)
+	}
+	if runtimeErr.Err.Message != "type mismatch: INTEGER + BOOLEAN" {
+		t.Errorf("wrong error message. got=%q", runtimeErr.Err.Message)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	interp := New()
+	interp.SetLimits(object.Limits{MaxSteps: 1000, MaxDepth: 20})
+
+	// Functions defined in an earlier evaluation count against the budget
+	// of the evaluation that calls them
+	if _, err := interp.Eval("let loop = fn() { 1 + loop() };"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	tests := []struct {
+		run  func() (object.Object, error)
+		kind object.ErrorKind
+	}{
+		{func() (object.Object, error) { return interp.Eval("loop()") }, object.DEPTH_LIMIT_ERR},
+		{func() (object.Object, error) { return interp.Call("loop") }, object.DEPTH_LIMIT_ERR},
+		{func() (object.Object, error) { return interp.Eval("while (true) { }") }, object.STEP_LIMIT_ERR},
+		{func() (object.Object, error) {
+			return interp.Eval("let spin = macro() { while (true) { } };\nspin()")
+		}, object.STEP_LIMIT_ERR},
+	}
+
+	for i, tt := range tests {
+		_, err := tt.run()
+		runtimeErr, ok := err.(*RuntimeError)
+		if !ok {
+			t.Fatalf("test %d: expected RuntimeError, got=%T (%v)", i, err, err)
+		}
+		if runtimeErr.Err.Kind != tt.kind {
+			t.Errorf("test %d: wrong error kind. want=%s, got=%s", i, tt.kind, runtimeErr.Err.Kind)
+		}
+	}
+
+	// Each evaluation gets a fresh budget
+	if _, err := interp.Eval("let x = 1;"); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+}
+
+func TestEvalContext(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err := New().EvalContext(ctx, "while (true) { }")
+	runtimeErr, ok := err.(*RuntimeError)
+	if !ok {
+		t.Fatalf("expected RuntimeError, got=%T (%v)", err, err)
+	}
+	if runtimeErr.Err.Kind != object.CANCELED_ERR {
+		t.Errorf("wrong error kind. want=%s, got=%s", object.CANCELED_ERR, runtimeErr.Err.Kind)
+	}
+}
+
+func TestEvalFile(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "script.mk")
+	if err := os.WriteFile(filename, []byte("let x = 2;\nx * -true"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := New().EvalFile(filename)
+	if err == nil || !strings.Contains(err.Error(), filename+":2:5") {
+		t.Errorf("expected error located in %s, got=%v", filename, err)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	interp := New()
+
+	interp.Register("answer", func(args ...object.Object) object.Object {
+		return &object.Integer{Value: 42}
+	})
+
+	err := interp.RegisterFunc("repeat", func(s string, n int) (string, error) {
+		if n < 0 {
+			return "", errors.New("count must not be negative")
+		}
+		return strings.Repeat(s, n), nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	err = interp.RegisterFunc("sum", func(nums ...int64) int64 {
+		var total int64
+		for _, n := range nums {
+			total += n
+		}
+		return total
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	err = interp.RegisterFunc("half", func(f float64) float64 { return f / 2 })
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`answer()`, int64(42)},
+		{`half(3.0)`, 1.5},
+		{`half(5)`, 2.5},
+		{`half("a")`, "ERROR: 1:1: argument 1 to `half`: must be FLOAT, got STRING"},
+		{`repeat("ab", 3)`, "ababab"},
+		{`sum()`, int64(0)},
+		{`sum(1, 2, 3)`, int64(6)},
+		{`repeat("ab", -1)`, "ERROR: 1:1: count must not be negative"},
+		{`repeat(1, 2)`, "ERROR: 1:1: argument 1 to `repeat`: must be STRING, got INTEGER"},
+		{`repeat("ab")`, "ERROR: 1:1: wrong number of arguments. got=1, want=2"},
+		{`let answer = fn() { 1 }; answer()`, int64(1)},
+	}
+
+	for _, tt := range tests {
+		result, err := interp.Eval(tt.input)
+
+		var got interface{}
+		if err != nil {
+			got = err.Error()
+		} else {
+			got = ToGo(result)
+		}
+
+		if got != tt.expected {
+			t.Errorf("wrong result for %q. want=%v, got=%v", tt.input, tt.expected, got)
+		}
+	}
+
+	if err := interp.RegisterFunc("bad", 5); err == nil {
+		t.Errorf("expected error registering a non-function")
+	}
+}
+
+func TestSetAndCall(t *testing.T) {
+	interp := New()
+
+	values := map[string]interface{}{
+		"numbers": []int{1, 2, 3},
+		"config":  map[string]interface{}{"debug": true, "name": "monkey"},
+		"nothing": nil,
+	}
+	for name, value := range values {
+		if err := interp.Set(name, value); err != nil {
+			t.Fatalf("unexpected error setting %s: %s", name, err)
+		}
+	}
+
+	result, err := interp.Eval(`[len(numbers), config["name"], config["debug"], nothing]`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := []interface{}{int64(3), "monkey", true, nil}
+	if !reflect.DeepEqual(ToGo(result), expected) {
+		t.Errorf("wrong result. want=%v, got=%v", expected, ToGo(result))
+	}
+
+	if _, err := interp.Eval("let double = fn(x) { x * 2 };"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	result, err = interp.Call("double", 21)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if ToGo(result) != int64(42) {
+		t.Errorf("wrong result. want=42, got=%s", result.Inspect())
+	}
+
+	if _, err := interp.Call("double"); err == nil {
+		t.Errorf("expected arity error calling double without arguments")
+	}
+
+	if _, err := interp.Eval("let add = fn(a, b = 2) { a + b }; let sum = fn(...xs) { let s = 0; for (x in xs) { s += x }; s };"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	calls := []struct {
+		name     string
+		args     []interface{}
+		expected int64
+	}{
+		{"add", []interface{}{1}, 3},
+		{"add", []interface{}{1, 5}, 6},
+		{"sum", []interface{}{}, 0},
+		{"sum", []interface{}{1, 2, 3}, 6},
+	}
+	for _, tt := range calls {
+		result, err := interp.Call(tt.name, tt.args...)
+		if err != nil {
+			t.Errorf("unexpected error calling %s%v: %s", tt.name, tt.args, err)
+			continue
+		}
+		if ToGo(result) != tt.expected {
+			t.Errorf("wrong result of %s%v. want=%d, got=%s", tt.name, tt.args, tt.expected, result.Inspect())
+		}
+	}
+
+	if _, err := interp.Call("add", 1, 2, 3); err == nil {
+		t.Errorf("expected arity error calling add with too many arguments")
+	}
+	if _, err := interp.Call("missing"); err == nil {
+		t.Errorf("expected error calling an unknown function")
+	}
+}
+
+func TestIsolation(t *testing.T) {
+	var out1, out2 bytes.Buffer
+
+	first := New()
+	first.SetOutput(&out1)
+	first.Set("name", "first")
+
+	second := New()
+	second.SetOutput(&out2)
+
+	if _, err := first.Eval(`puts(name)`); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if _, err := second.Eval(`puts(name)`); err == nil {
+		t.Errorf("expected name to be undefined in the second interpreter")
+	}
+
+	if out1.String() != "first\n" || out2.Len() != 0 {
+		t.Errorf("output not isolated. first=%q, second=%q", out1.String(), out2.String())
+	}
+}
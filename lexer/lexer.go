@@ -1,24 +1,117 @@
 package lexer
 
-import "github.com/pwbrown/go-monkey/token"
+import (
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pwbrown/go-monkey/token"
+)
+
+// An Error is a problem found while scanning, e.g. an unterminated comment
+type Error struct {
+	Pos token.Position
+	End token.Position
+	Msg string
+}
+
+func (e Error) Error() string {
+	return e.Pos.String() + ": " + e.Msg
+}
 
 type Lexer struct {
+	errors       []Error
 	input        string
-	position     int // current position in input (current character)
-	readPosition int // current reading position (after current character)
-	ch           byte
+	filename     string
+	position     int  // current position in input (current character)
+	readPosition int  // current reading position (after current character)
+	ch           rune // current character, 0 at the end of input
+	line         int  // line of the current character
+	column       int  // column of the current character
 }
 
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	return NewFile("", input)
+}
+
+// Create a new lexer that records the filename in token positions
+func NewFile(filename, input string) *Lexer {
+	l := &Lexer{input: input, filename: filename, line: 1}
 	l.readChar()
+	l.skipShebang()
 	return l
 }
 
 func (l *Lexer) NextToken() token.Token {
-	var tok token.Token
+	comments := l.skipWhitespaceAndComments()
+
+	pos := l.currentPosition()
+	tok := l.scanToken()
+	tok.Pos = pos
+	tok.End = l.currentPosition()
+	tok.Comments = comments
+
+	return tok
+}
+
+// Return the errors found so far
+func (l *Lexer) Errors() []Error {
+	return l.errors
+}
+
+// Skip whitespace and comments, returning the comments in source order
+func (l *Lexer) skipWhitespaceAndComments() []token.Comment {
+	var comments []token.Comment
 
-	l.skipWhitepace()
+	for {
+		l.skipWhitepace()
+
+		if l.ch != '/' || (l.peekChar() != '/' && l.peekChar() != '*') {
+			return comments
+		}
+
+		comments = append(comments, l.readComment())
+	}
+}
+
+// Read a "//" comment up to the end of the line or a "/* */" comment up to
+// the closing marker
+func (l *Lexer) readComment() token.Comment {
+	pos := l.currentPosition()
+	block := l.peekChar() == '*'
+
+	l.readChar()
+	l.readChar()
+
+	if block {
+		for !(l.ch == '*' && l.peekChar() == '/') {
+			if l.ch == 0 {
+				l.addError(pos, "comment not terminated")
+				break
+			}
+			l.readChar()
+		}
+		if l.ch != 0 {
+			l.readChar()
+			l.readChar()
+		}
+	} else {
+		for l.ch != '\n' && l.ch != 0 {
+			l.readChar()
+		}
+	}
+
+	return token.Comment{
+		Text: l.input[pos.Offset:l.position],
+		Pos:  pos,
+		End:  l.currentPosition(),
+	}
+}
+
+// Scan the token starting at the current character
+func (l *Lexer) scanToken() token.Token {
+	var tok token.Token
 
 	switch l.ch {
 	case '=':
@@ -31,9 +124,9 @@ func (l *Lexer) NextToken() token.Token {
 			tok = newToken(token.ASSIGN, l.ch)
 		}
 	case '+':
-		tok = newToken(token.PLUS, l.ch)
+		tok = l.newTwoCharToken('=', token.PLUS_ASSIGN, token.PLUS)
 	case '-':
-		tok = newToken(token.MINUS, l.ch)
+		tok = l.newTwoCharToken('=', token.MINUS_ASSIGN, token.MINUS)
 	case '!':
 		if l.peekChar() == '=' {
 			ch := l.ch
@@ -44,19 +137,33 @@ func (l *Lexer) NextToken() token.Token {
 			tok = newToken(token.BANG, l.ch)
 		}
 	case '/':
-		tok = newToken(token.SLASH, l.ch)
+		tok = l.newTwoCharToken('=', token.SLASH_ASSIGN, token.SLASH)
 	case '*':
-		tok = newToken(token.ASTERISK, l.ch)
+		tok = l.newTwoCharToken('=', token.ASTERISK_ASSIGN, token.ASTERISK)
+	case '%':
+		tok = newToken(token.PERCENT, l.ch)
 	case '<':
-		tok = newToken(token.LT, l.ch)
+		tok = l.newTwoCharToken('=', token.LT_EQ, token.LT)
 	case '>':
-		tok = newToken(token.GT, l.ch)
+		tok = l.newTwoCharToken('=', token.GT_EQ, token.GT)
+	case '&':
+		tok = l.newTwoCharToken('&', token.AND, token.ILLEGAL)
+	case '|':
+		tok = l.newTwoCharToken('|', token.OR, token.ILLEGAL)
 	case ';':
 		tok = newToken(token.SEMICOLON, l.ch)
 	case ':':
 		tok = newToken(token.COLON, l.ch)
 	case ',':
 		tok = newToken(token.COMMA, l.ch)
+	case '.':
+		if l.peekChar() == '.' && l.peekCharAt(1) == '.' {
+			l.readChar()
+			l.readChar()
+			tok = token.Token{Type: token.ELLIPSIS, Literal: "..."}
+		} else {
+			tok = newToken(token.ILLEGAL, l.ch)
+		}
 	case '(':
 		tok = newToken(token.LPAREN, l.ch)
 	case ')':
@@ -72,6 +179,7 @@ func (l *Lexer) NextToken() token.Token {
 	case '"':
 		tok.Type = token.STRING
 		tok.Literal = l.readString()
+		return tok
 	case 0:
 		tok.Literal = ""
 		tok.Type = token.EOF
@@ -81,8 +189,7 @@ func (l *Lexer) NextToken() token.Token {
 			tok.Type = token.LookupIdent(tok.Literal)
 			return tok
 		} else if isDigit(l.ch) {
-			tok.Type = token.INT
-			tok.Literal = l.readNumber()
+			tok.Literal, tok.Type = l.readNumber()
 			return tok
 		} else {
 			tok = newToken(token.ILLEGAL, l.ch)
@@ -93,21 +200,59 @@ func (l *Lexer) NextToken() token.Token {
 }
 
 func (l *Lexer) readChar() {
+	// Already past the end of input
+	if l.readPosition > len(l.input) {
+		return
+	}
+
+	if l.ch == '\n' {
+		l.line += 1
+		l.column = 0
+	}
+	l.column += 1
+
+	width := 1
 	if l.readPosition >= len(l.input) {
 		l.ch = 0
 	} else {
-		l.ch = l.input[l.readPosition]
+		l.ch, width = utf8.DecodeRuneInString(l.input[l.readPosition:])
 	}
 	l.position = l.readPosition
-	l.readPosition += 1
+	l.readPosition += width
 }
 
-func (l *Lexer) peekChar() byte {
-	if l.readPosition >= len(l.input) {
+// Record an error for the source from pos up to the current character
+func (l *Lexer) addError(pos token.Position, msg string) {
+	l.errors = append(l.errors, Error{Pos: pos, End: l.currentPosition(), Msg: msg})
+}
+
+// Return the position of the current character
+func (l *Lexer) currentPosition() token.Position {
+	return token.Position{
+		Filename: l.filename,
+		Offset:   l.position,
+		Line:     l.line,
+		Column:   l.column,
+	}
+}
+
+func (l *Lexer) peekChar() rune {
+	return l.peekCharAt(0)
+}
+
+// Return the character a number of places after the peek character
+func (l *Lexer) peekCharAt(offset int) rune {
+	position := l.readPosition
+	for ; offset > 0 && position < len(l.input); offset-- {
+		_, width := utf8.DecodeRuneInString(l.input[position:])
+		position += width
+	}
+
+	if position >= len(l.input) {
 		return 0
-	} else {
-		return l.input[l.readPosition]
 	}
+	ch, _ := utf8.DecodeRuneInString(l.input[position:])
+	return ch
 }
 
 func (l *Lexer) readIdentifier() string {
@@ -118,23 +263,131 @@ func (l *Lexer) readIdentifier() string {
 	return l.input[position:l.position]
 }
 
-func (l *Lexer) readNumber() string {
+// Read an integer, or a float with a fraction and/or an exponent (3.14, 1e-9)
+func (l *Lexer) readNumber() (string, token.TokenType) {
 	position := l.position
+	tokenType := token.TokenType(token.INT)
+
 	for isDigit(l.ch) {
 		l.readChar()
 	}
-	return l.input[position:l.position]
+
+	if l.ch == '.' && isDigit(l.peekChar()) {
+		tokenType = token.FLOAT
+		l.readChar()
+		for isDigit(l.ch) {
+			l.readChar()
+		}
+	}
+
+	if l.ch == 'e' || l.ch == 'E' {
+		next := l.peekChar()
+		if next == '+' || next == '-' {
+			next = l.peekCharAt(1)
+		}
+
+		if isDigit(next) {
+			tokenType = token.FLOAT
+			l.readChar()
+			if l.ch == '+' || l.ch == '-' {
+				l.readChar()
+			}
+			for isDigit(l.ch) {
+				l.readChar()
+			}
+		}
+	}
+
+	return l.input[position:l.position], tokenType
 }
 
+// Read a string literal and return its value with escape sequences replaced
 func (l *Lexer) readString() string {
-	position := l.position + 1
-	for {
-		l.readChar()
-		if l.ch == '"' || l.ch == 0 {
-			break
+	pos := l.currentPosition()
+	var out strings.Builder
+
+	l.readChar()
+	for l.ch != '"' {
+		switch l.ch {
+		case 0:
+			l.addError(pos, "string literal not terminated")
+			return out.String()
+		case '\\':
+			l.readEscape(&out)
+		default:
+			out.WriteRune(l.ch)
+			l.readChar()
 		}
 	}
-	return l.input[position:l.position]
+	l.readChar()
+
+	return out.String()
+}
+
+// Read an escape sequence starting at a backslash and write the character
+// it stands for
+func (l *Lexer) readEscape(out *strings.Builder) {
+	pos := l.currentPosition()
+	l.readChar()
+
+	switch l.ch {
+	case 'n':
+		out.WriteByte('\n')
+	case 't':
+		out.WriteByte('\t')
+	case '"', '\\':
+		out.WriteRune(l.ch)
+	case 'u':
+		l.readUnicodeEscape(pos, out)
+		return
+	case 0:
+		// Reported as an unterminated string
+		return
+	default:
+		l.readChar()
+		l.addError(pos, "unknown escape sequence")
+		return
+	}
+	l.readChar()
+}
+
+// Read the "{XXXX}" part of a \u{XXXX} escape, with 1 to 6 hex digits
+func (l *Lexer) readUnicodeEscape(pos token.Position, out *strings.Builder) {
+	l.readChar()
+	if l.ch != '{' {
+		l.addError(pos, "invalid Unicode escape, expected \\u{XXXX}")
+		return
+	}
+	l.readChar()
+
+	position := l.position
+	for isHexDigit(l.ch) {
+		l.readChar()
+	}
+	digits := l.input[position:l.position]
+
+	if l.ch != '}' || len(digits) == 0 || len(digits) > 6 {
+		l.addError(pos, "invalid Unicode escape, expected \\u{XXXX}")
+		return
+	}
+	l.readChar()
+
+	value, _ := strconv.ParseUint(digits, 16, 32)
+	if !utf8.ValidRune(rune(value)) {
+		l.addError(pos, "escape sequence is not a valid Unicode code point")
+		return
+	}
+	out.WriteRune(rune(value))
+}
+
+// Skip a "#!" interpreter line at the very start of the input
+func (l *Lexer) skipShebang() {
+	if l.ch != '#' || l.peekChar() != '!' {
+		return
+	}
+	for l.ch != '\n' && l.ch != 0 {
+		l.readChar()
+	}
 }
 
 func (l *Lexer) skipWhitepace() {
@@ -143,14 +396,32 @@ func (l *Lexer) skipWhitepace() {
 	}
 }
 
-func isLetter(ch byte) bool {
-	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_'
+// Letters are any Unicode letters and the underscore
+func isLetter(ch rune) bool {
+	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_' ||
+		ch >= utf8.RuneSelf && unicode.IsLetter(ch)
 }
 
-func isDigit(ch byte) bool {
+func isDigit(ch rune) bool {
 	return '0' <= ch && ch <= '9'
 }
 
-func newToken(tokenType token.TokenType, ch byte) token.Token {
+func isHexDigit(ch rune) bool {
+	return isDigit(ch) || 'a' <= ch && ch <= 'f' || 'A' <= ch && ch <= 'F'
+}
+
+// Create a two character token if the peek character is next, otherwise a
+// single character token of type single
+func (l *Lexer) newTwoCharToken(next rune, double, single token.TokenType) token.Token {
+	if l.peekChar() != next {
+		return newToken(single, l.ch)
+	}
+
+	ch := l.ch
+	l.readChar()
+	return token.Token{Type: double, Literal: string(ch) + string(l.ch)}
+}
+
+func newToken(tokenType token.TokenType, ch rune) token.Token {
 	return token.Token{Type: tokenType, Literal: string(ch)}
 }
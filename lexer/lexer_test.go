@@ -16,7 +16,7 @@ func TestNextToken(t *testing.T) {
 		};
 		
 		let result = add(five, ten);
-		!-/*5;
+		!-/ *5;
 		5 < 10 > 5;
 
 		if (5 < 10) {
@@ -157,3 +157,326 @@ func TestNextToken(t *testing.T) {
 		}
 	}
 }
+
+func TestNumbers(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []token.Token
+	}{
+		{"42", []token.Token{{Type: token.INT, Literal: "42"}}},
+		{"3.14", []token.Token{{Type: token.FLOAT, Literal: "3.14"}}},
+		{"1e-9", []token.Token{{Type: token.FLOAT, Literal: "1e-9"}}},
+		{"2.5E+10", []token.Token{{Type: token.FLOAT, Literal: "2.5E+10"}}},
+		{"7e3", []token.Token{{Type: token.FLOAT, Literal: "7e3"}}},
+		{"1.", []token.Token{
+			{Type: token.INT, Literal: "1"},
+			{Type: token.ILLEGAL, Literal: "."},
+		}},
+		{"2else", []token.Token{
+			{Type: token.INT, Literal: "2"},
+			{Type: token.ELSE, Literal: "else"},
+		}},
+		{"3e+", []token.Token{
+			{Type: token.INT, Literal: "3"},
+			{Type: token.IDENT, Literal: "e"},
+			{Type: token.PLUS, Literal: "+"},
+		}},
+	}
+
+	for _, tt := range tests {
+		l := New(tt.input)
+
+		for i, expected := range tt.expected {
+			tok := l.NextToken()
+
+			if tok.Type != expected.Type || tok.Literal != expected.Literal {
+				t.Fatalf("%q: tokens[%d] wrong. expected=%s(%q), got=%s(%q)",
+					tt.input, i, expected.Type, expected.Literal, tok.Type, tok.Literal)
+			}
+		}
+
+		if tok := l.NextToken(); tok.Type != token.EOF {
+			t.Fatalf("%q: expected EOF. got=%s(%q)", tt.input, tok.Type, tok.Literal)
+		}
+	}
+}
+
+func TestStrings(t *testing.T) {
+	tests := []struct {
+		input         string
+		expected      string
+		expectedError string
+	}{
+		{`"hello"`, "hello", ""},
+		{`"a\nb\tc"`, "a\nb\tc", ""},
+		{`"say \"hi\""`, `say "hi"`, ""},
+		{`"back\\slash"`, `back\slash`, ""},
+		{`"\u{48}\u{1F600}"`, "H\U0001F600", ""},
+		{`"héllo wörld"`, "héllo wörld", ""},
+		{`"two
+lines"`, "two\nlines", ""},
+		{`"bad \q escape"`, "bad  escape", "1:6: unknown escape sequence"},
+		{`"\u48"`, "48", "1:2: invalid Unicode escape, expected \\u{XXXX}"},
+		{`"\u{D800}"`, "", "1:2: escape sequence is not a valid Unicode code point"},
+		{`"\u{1234567}"`, "}", "1:2: invalid Unicode escape, expected \\u{XXXX}"},
+		{`"never closed`, "never closed", "1:1: string literal not terminated"},
+		{`"ends in \`, "ends in ", "1:1: string literal not terminated"},
+	}
+
+	for _, tt := range tests {
+		l := New(tt.input)
+		tok := l.NextToken()
+
+		if tok.Type != token.STRING {
+			t.Fatalf("%s: tokentype wrong. expected=STRING, got=%q", tt.input, tok.Type)
+		}
+
+		if tok.Literal != tt.expected {
+			t.Errorf("%s: literal wrong. expected=%q, got=%q", tt.input, tt.expected, tok.Literal)
+		}
+
+		errors := l.Errors()
+		if tt.expectedError == "" {
+			if len(errors) != 0 {
+				t.Errorf("%s: unexpected errors: %v", tt.input, errors)
+			}
+			continue
+		}
+
+		if len(errors) != 1 || errors[0].Error() != tt.expectedError {
+			t.Errorf("%s: wrong errors. expected=%q, got=%v", tt.input, tt.expectedError, errors)
+		}
+	}
+}
+
+func TestUnicode(t *testing.T) {
+	input := `let größe = "äö"; größe_2 π`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+		expectedColumn  int
+	}{
+		{token.LET, "let", 1},
+		{token.IDENT, "größe", 5},
+		{token.ASSIGN, "=", 11},
+		{token.STRING, "äö", 13},
+		{token.SEMICOLON, ";", 17},
+		{token.IDENT, "größe_", 19},
+		{token.INT, "2", 25},
+		{token.IDENT, "π", 27},
+		{token.EOF, "", 28},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - token wrong. expected=%s(%q), got=%s(%q)",
+				i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+
+		if tok.Pos.Column != tt.expectedColumn {
+			t.Fatalf("tests[%d] - column wrong. expected=%d, got=%d",
+				i, tt.expectedColumn, tok.Pos.Column)
+		}
+	}
+}
+
+func TestOperators(t *testing.T) {
+	input := "a <= b >= c < d > e % f && g || h & | ...i .."
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.IDENT, "a"},
+		{token.LT_EQ, "<="},
+		{token.IDENT, "b"},
+		{token.GT_EQ, ">="},
+		{token.IDENT, "c"},
+		{token.LT, "<"},
+		{token.IDENT, "d"},
+		{token.GT, ">"},
+		{token.IDENT, "e"},
+		{token.PERCENT, "%"},
+		{token.IDENT, "f"},
+		{token.AND, "&&"},
+		{token.IDENT, "g"},
+		{token.OR, "||"},
+		{token.IDENT, "h"},
+		{token.ILLEGAL, "&"},
+		{token.ILLEGAL, "|"},
+		{token.ELLIPSIS, "..."},
+		{token.IDENT, "i"},
+		{token.ILLEGAL, "."},
+		{token.ILLEGAL, "."},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - token wrong. expected=%s(%q), got=%s(%q)",
+				i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+	}
+}
+
+func TestControlKeywords(t *testing.T) {
+	input := "while for in break continue inside try catch"
+
+	expected := []token.TokenType{
+		token.WHILE, token.FOR, token.IN, token.BREAK, token.CONTINUE, token.IDENT,
+		token.TRY, token.CATCH, token.EOF,
+	}
+
+	l := New(input)
+
+	for i, tokenType := range expected {
+		tok := l.NextToken()
+
+		if tok.Type != tokenType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tokenType, tok.Type)
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := `// leading comment
+let x = 1; // trailing comment
+/* block
+   comment */ x / 2;
+/* unterminated`
+
+	tests := []struct {
+		expectedType     token.TokenType
+		expectedComments []string
+	}{
+		{token.LET, []string{"// leading comment"}},
+		{token.IDENT, nil},
+		{token.ASSIGN, nil},
+		{token.INT, nil},
+		{token.SEMICOLON, nil},
+		{token.IDENT, []string{"// trailing comment", "/* block\n   comment */"}},
+		{token.SLASH, nil},
+		{token.INT, nil},
+		{token.SEMICOLON, nil},
+		{token.EOF, []string{"/* unterminated"}},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if len(tok.Comments) != len(tt.expectedComments) {
+			t.Fatalf("tests[%d] - wrong number of comments. expected=%d, got=%d",
+				i, len(tt.expectedComments), len(tok.Comments))
+		}
+
+		for j, comment := range tok.Comments {
+			if comment.Text != tt.expectedComments[j] {
+				t.Errorf("tests[%d] - comment %d wrong. expected=%q, got=%q",
+					i, j, tt.expectedComments[j], comment.Text)
+			}
+		}
+	}
+
+	errors := l.Errors()
+	if len(errors) != 1 {
+		t.Fatalf("expected 1 error, got=%d", len(errors))
+	}
+	if errors[0].Error() != "5:1: comment not terminated" {
+		t.Errorf("wrong error. got=%q", errors[0].Error())
+	}
+}
+
+func TestCommentPositions(t *testing.T) {
+	l := New("x // note\n/* a */ y")
+
+	l.NextToken()
+	tok := l.NextToken()
+
+	expected := []struct{ pos, end string }{
+		{"1:3", "1:10"},
+		{"2:1", "2:8"},
+	}
+
+	if len(tok.Comments) != len(expected) {
+		t.Fatalf("wrong number of comments. expected=%d, got=%d", len(expected), len(tok.Comments))
+	}
+
+	for i, comment := range tok.Comments {
+		if comment.Pos.String() != expected[i].pos || comment.End.String() != expected[i].end {
+			t.Errorf("comment %d at %s-%s, expected %s-%s",
+				i, comment.Pos, comment.End, expected[i].pos, expected[i].end)
+		}
+	}
+}
+
+func TestTokenPositions(t *testing.T) {
+	input := "let x = 5;\n  \"ab\" != y\n"
+
+	tests := []struct {
+		expectedType   token.TokenType
+		expectedPos    token.Position
+		expectedEndCol int
+	}{
+		{token.LET, token.Position{Filename: "test.mk", Offset: 0, Line: 1, Column: 1}, 4},
+		{token.IDENT, token.Position{Filename: "test.mk", Offset: 4, Line: 1, Column: 5}, 6},
+		{token.ASSIGN, token.Position{Filename: "test.mk", Offset: 6, Line: 1, Column: 7}, 8},
+		{token.INT, token.Position{Filename: "test.mk", Offset: 8, Line: 1, Column: 9}, 10},
+		{token.SEMICOLON, token.Position{Filename: "test.mk", Offset: 9, Line: 1, Column: 10}, 11},
+		{token.STRING, token.Position{Filename: "test.mk", Offset: 13, Line: 2, Column: 3}, 7},
+		{token.NOT_EQ, token.Position{Filename: "test.mk", Offset: 18, Line: 2, Column: 8}, 10},
+		{token.IDENT, token.Position{Filename: "test.mk", Offset: 21, Line: 2, Column: 11}, 12},
+		{token.EOF, token.Position{Filename: "test.mk", Offset: 23, Line: 3, Column: 1}, 1},
+		{token.EOF, token.Position{Filename: "test.mk", Offset: 23, Line: 3, Column: 1}, 1},
+	}
+
+	l := NewFile("test.mk", input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Pos != tt.expectedPos {
+			t.Fatalf("tests[%d] - position wrong. expected=%+v, got=%+v",
+				i, tt.expectedPos, tok.Pos)
+		}
+
+		if tok.End.Line != tt.expectedPos.Line || tok.End.Column != tt.expectedEndCol {
+			t.Fatalf("tests[%d] - end wrong. expected=%d:%d, got=%s",
+				i, tt.expectedPos.Line, tt.expectedEndCol, tok.End)
+		}
+	}
+}
+
+func TestShebangLine(t *testing.T) {
+	input := "#!/usr/bin/env monkey run\nlet x = 1;"
+
+	l := New(input)
+
+	tok := l.NextToken()
+	if tok.Type != token.LET {
+		t.Fatalf("tokentype wrong. expected=%q, got=%q", token.LET, tok.Type)
+	}
+	if tok.Pos.Line != 2 || tok.Pos.Column != 1 {
+		t.Fatalf("position wrong. expected=2:1, got=%s", tok.Pos)
+	}
+}
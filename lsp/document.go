@@ -0,0 +1,309 @@
+package lsp
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/pwbrown/go-monkey/ast"
+	"github.com/pwbrown/go-monkey/lexer"
+	"github.com/pwbrown/go-monkey/parser"
+	"github.com/pwbrown/go-monkey/token"
+)
+
+type bindingKind int
+
+const (
+	variableBinding bindingKind = iota
+	functionBinding
+	macroBinding
+	parameterBinding
+)
+
+// A binding is a name introduced by a let statement, a function or macro
+// parameter, a for loop or a catch clause
+type binding struct {
+	name    string
+	kind    bindingKind
+	decl    *ast.Identifier
+	let     *ast.LetStatement // nil unless bound by a let statement
+	visible int               // offset from which the binding can be used
+}
+
+// A scope holds the bindings of the program or of a function body. Blocks
+// don't start a new scope, their bindings belong to the enclosing function
+type scope struct {
+	parent   *scope
+	node     ast.Node
+	bindings []*binding
+}
+
+// Find the binding a name refers to at an offset: the last one visible
+// there, or one declared later in the scope, as functions may refer to
+// bindings defined after them
+func (s *scope) lookup(name string, offset int) *binding {
+	for ; s != nil; s = s.parent {
+		var found *binding
+		for _, b := range s.bindings {
+			if b.name != name {
+				continue
+			}
+			if b.visible <= offset || found == nil {
+				found = b
+			}
+			if b.visible > offset {
+				break
+			}
+		}
+		if found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// A document is an open source file with the result of its analysis
+type document struct {
+	uri         string
+	text        string
+	lineStarts  []int // byte offset of the start of each line
+	program     *ast.Program
+	diagnostics []parser.Diagnostic
+	scopes      []*scope
+	idents      []*ast.Identifier // every identifier, in source order
+	refs        map[*ast.Identifier]*binding
+}
+
+// Parse and analyse a source file
+func newDocument(uri, text string) *document {
+	doc := &document{
+		uri:        uri,
+		text:       text,
+		lineStarts: []int{0},
+		refs:       map[*ast.Identifier]*binding{},
+	}
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\n' {
+			doc.lineStarts = append(doc.lineStarts, i+1)
+		}
+	}
+
+	p := parser.New(lexer.New(text))
+	doc.program = p.ParseProgram()
+	doc.diagnostics = p.Diagnostics()
+
+	doc.resolve()
+	return doc
+}
+
+// Declare the bindings of every scope, then resolve each use of a name
+func (doc *document) resolve() {
+	global := &scope{node: doc.program}
+	doc.scopes = append(doc.scopes, global)
+
+	decls := map[*ast.Identifier]*binding{}
+	uses := map[*ast.Identifier]*scope{}
+
+	declare := func(s *scope, ident *ast.Identifier, kind bindingKind, visible int) *binding {
+		if ident == nil {
+			return nil
+		}
+		b := &binding{name: ident.Value, kind: kind, decl: ident, visible: visible}
+		s.bindings = append(s.bindings, b)
+		decls[ident] = b
+		return b
+	}
+
+	var visit func(s *scope) func(ast.Node) bool
+	visit = func(s *scope) func(ast.Node) bool {
+		return func(node ast.Node) bool {
+			switch node := node.(type) {
+			case *ast.LetStatement:
+				kind := variableBinding
+				switch node.Value.(type) {
+				case *ast.FunctionLiteral:
+					kind = functionBinding
+				case *ast.MacroLiteral:
+					kind = macroBinding
+				}
+				if b := declare(s, node.Name, kind, node.End().Offset); b != nil {
+					b.let = node
+				}
+
+			case *ast.ForStatement:
+				declare(s, node.Key, variableBinding, node.Pos().Offset)
+				declare(s, node.Value, variableBinding, node.Pos().Offset)
+
+			case *ast.TryExpression:
+				if node.Catch != nil {
+					declare(s, node.Param, variableBinding, node.Catch.Pos().Offset)
+				}
+
+			case *ast.FunctionLiteral:
+				inner := &scope{parent: s, node: node}
+				doc.scopes = append(doc.scopes, inner)
+				for _, param := range node.Parameters {
+					declare(inner, param, parameterBinding, node.Pos().Offset)
+				}
+				declare(inner, node.Rest, parameterBinding, node.Pos().Offset)
+				for i, param := range node.Parameters {
+					ast.Inspect(param, visit(inner))
+					if def := node.Default(i); def != nil {
+						ast.Inspect(def, visit(inner))
+					}
+				}
+				if node.Rest != nil {
+					ast.Inspect(node.Rest, visit(inner))
+				}
+				if node.Body != nil {
+					ast.Inspect(node.Body, visit(inner))
+				}
+				return false
+
+			case *ast.MacroLiteral:
+				inner := &scope{parent: s, node: node}
+				doc.scopes = append(doc.scopes, inner)
+				for _, param := range node.Parameters {
+					declare(inner, param, parameterBinding, node.Pos().Offset)
+					ast.Inspect(param, visit(inner))
+				}
+				if node.Body != nil {
+					ast.Inspect(node.Body, visit(inner))
+				}
+				return false
+
+			case *ast.Identifier:
+				doc.idents = append(doc.idents, node)
+				if _, ok := decls[node]; !ok {
+					uses[node] = s
+				}
+			}
+			return true
+		}
+	}
+	ast.Inspect(doc.program, visit(global))
+
+	for _, ident := range doc.idents {
+		if b, ok := decls[ident]; ok {
+			doc.refs[ident] = b
+		} else if b := uses[ident].lookup(ident.Value, ident.Pos().Offset); b != nil {
+			doc.refs[ident] = b
+		}
+	}
+
+	// Function literals are inspected before the identifiers after them
+	sort.SliceStable(doc.idents, func(i, j int) bool {
+		return doc.idents[i].Pos().Offset < doc.idents[j].Pos().Offset
+	})
+}
+
+// Return the identifier at an offset, including an offset just after it
+func (doc *document) identifierAt(offset int) *ast.Identifier {
+	for _, ident := range doc.idents {
+		if ident.Pos().IsValid() && ident.Pos().Offset <= offset && offset <= ident.End().Offset {
+			return ident
+		}
+	}
+	return nil
+}
+
+// Return the identifiers that refer to a binding, in source order
+func (doc *document) references(b *binding) []*ast.Identifier {
+	refs := []*ast.Identifier{}
+	for _, ident := range doc.idents {
+		if doc.refs[ident] == b {
+			refs = append(refs, ident)
+		}
+	}
+	return refs
+}
+
+// Return the innermost scope around an offset
+func (doc *document) scopeAt(offset int) *scope {
+	innermost := doc.scopes[0]
+	for _, s := range doc.scopes[1:] {
+		pos, end := s.node.Pos(), s.node.End()
+		if pos.IsValid() && pos.Offset <= offset && (offset < end.Offset || !end.IsValid()) {
+			innermost = s
+		}
+	}
+	return innermost
+}
+
+// Return the bindings visible at an offset, the innermost one of each name
+func (doc *document) visibleBindings(offset int) []*binding {
+	seen := map[string]bool{}
+	visible := []*binding{}
+	for s := doc.scopeAt(offset); s != nil; s = s.parent {
+		for i := len(s.bindings) - 1; i >= 0; i-- {
+			b := s.bindings[i]
+			if seen[b.name] || b.visible > offset && b.kind != functionBinding {
+				continue
+			}
+			seen[b.name] = true
+			visible = append(visible, b)
+		}
+	}
+
+	sort.Slice(visible, func(i, j int) bool { return visible[i].name < visible[j].name })
+	return visible
+}
+
+// Convert a byte offset to an LSP position
+func (doc *document) position(offset int) Position {
+	if offset > len(doc.text) {
+		offset = len(doc.text)
+	}
+
+	line := sort.Search(len(doc.lineStarts), func(i int) bool { return doc.lineStarts[i] > offset }) - 1
+	character := 0
+	for _, r := range doc.text[doc.lineStarts[line]:offset] {
+		character += len(utf16.Encode([]rune{r}))
+	}
+	return Position{Line: line, Character: character}
+}
+
+// Convert an LSP position to a byte offset, clamped to its line
+func (doc *document) offset(pos Position) int {
+	if pos.Line < 0 {
+		return 0
+	}
+	if pos.Line >= len(doc.lineStarts) {
+		return len(doc.text)
+	}
+
+	offset := doc.lineStarts[pos.Line]
+	for character := 0; character < pos.Character && offset < len(doc.text); {
+		r, size := utf8.DecodeRuneInString(doc.text[offset:])
+		if r == '\n' {
+			break
+		}
+		character += len(utf16.Encode([]rune{r}))
+		offset += size
+	}
+	return offset
+}
+
+// Return the range between two source positions. An unknown end is taken
+// to be the end of the start position's line
+func (doc *document) rangeOf(pos, end token.Position) Range {
+	offset := pos.Offset
+	if offset > len(doc.text) {
+		offset = len(doc.text)
+	}
+
+	start := doc.position(offset)
+	if !end.IsValid() || end.Offset < offset {
+		line := doc.text[offset:]
+		if i := strings.IndexByte(line, '\n'); i >= 0 {
+			line = line[:i]
+		}
+		return Range{Start: start, End: doc.position(offset + len(line))}
+	}
+	return Range{Start: start, End: doc.position(end.Offset)}
+}
+
+func (doc *document) location(node ast.Node) Location {
+	return Location{URI: doc.uri, Range: doc.rangeOf(node.Pos(), node.End())}
+}
@@ -0,0 +1,37 @@
+package lsp
+
+import "testing"
+
+func TestPositions(t *testing.T) {
+	doc := newDocument("file:///a.mk", "let s = \"é😀\";\nlet t = s;\n")
+
+	tests := []struct {
+		offset   int
+		position Position
+	}{
+		{0, Position{0, 0}},
+		{9, Position{0, 9}},   // é
+		{11, Position{0, 10}}, // 😀, one UTF-16 unit after é
+		{15, Position{0, 12}}, // closing quote, two units after 😀
+		{18, Position{1, 0}},
+		{26, Position{1, 8}},
+	}
+
+	for _, tt := range tests {
+		if got := doc.position(tt.offset); got != tt.position {
+			t.Errorf("position(%d) wrong. want=%+v, got=%+v", tt.offset, tt.position, got)
+		}
+		if got := doc.offset(tt.position); got != tt.offset {
+			t.Errorf("offset(%+v) wrong. want=%d, got=%d", tt.position, tt.offset, got)
+		}
+	}
+
+	// Positions past the end of a line are clamped to it
+	if got := doc.offset(Position{0, 100}); got != 17 {
+		t.Errorf("offset past the end of the line wrong. got=%d", got)
+	}
+
+	if b := doc.refs[doc.identifierAt(26)]; b == nil || b.decl.Value != "s" || b.decl.Pos().Offset != 4 {
+		t.Errorf("wrong binding for s: %+v", b)
+	}
+}
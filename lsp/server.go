@@ -0,0 +1,404 @@
+// Package lsp implements a Language Server Protocol server for Monkey over
+// JSON-RPC, so that editors can show diagnostics, navigate between bindings
+// and complete names
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/pwbrown/go-monkey/ast"
+	"github.com/pwbrown/go-monkey/internal/framing"
+	"github.com/pwbrown/go-monkey/object"
+	"github.com/pwbrown/go-monkey/parser"
+)
+
+// A Server answers the requests of one client
+type Server struct {
+	in          *bufio.Reader
+	out         io.Writer
+	docs        map[string]*document
+	initialized bool
+	shutdown    bool
+	err         error // first failure to write a notification
+}
+
+// Create a server reading messages from in and writing to out
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{
+		in:   bufio.NewReader(in),
+		out:  out,
+		docs: map[string]*document{},
+	}
+}
+
+// Serve requests until the client sends the exit notification or closes
+// the input. It is an error to stop without a shutdown request first
+func (s *Server) Serve() error {
+	for {
+		content, err := framing.ReadMessage(s.in)
+		if err == io.EOF {
+			return s.exit()
+		}
+		if err != nil {
+			return err
+		}
+
+		var req request
+		if err := json.Unmarshal(content, &req); err != nil {
+			if err := s.replyError(nil, &responseError{Code: codeParseError, Message: err.Error()}); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if req.Method == "exit" {
+			return s.exit()
+		}
+		if err := s.handle(&req); err != nil {
+			return err
+		}
+		if s.err != nil {
+			return s.err
+		}
+	}
+}
+
+// Serve a client on a pair of streams, such as stdin and stdout
+func Serve(in io.Reader, out io.Writer) error {
+	return NewServer(in, out).Serve()
+}
+
+func (s *Server) exit() error {
+	if !s.shutdown {
+		return errors.New("exit without a shutdown request")
+	}
+	return nil
+}
+
+// Handle a request or a notification, replying to requests. Only failures
+// to write are returned
+func (s *Server) handle(req *request) error {
+	result, rerr := s.dispatch(req)
+	if req.ID == nil {
+		return nil
+	}
+	if rerr != nil {
+		return s.replyError(req.ID, rerr)
+	}
+	return framing.WriteMessage(s.out, response{JSONRPC: "2.0", ID: req.ID, Result: result})
+}
+
+func (s *Server) replyError(id *json.RawMessage, rerr *responseError) error {
+	return framing.WriteMessage(s.out, errorResponse{JSONRPC: "2.0", ID: id, Error: rerr})
+}
+
+func (s *Server) notify(method string, params interface{}) {
+	if err := framing.WriteMessage(s.out, notification{JSONRPC: "2.0", Method: method, Params: params}); err != nil && s.err == nil {
+		s.err = err
+	}
+}
+
+func (s *Server) dispatch(req *request) (interface{}, *responseError) {
+	switch {
+	case req.Method == "initialize":
+		s.initialized = true
+		return s.initialize(), nil
+	case !s.initialized:
+		return nil, &responseError{Code: codeServerNotInitialized, Message: "server not initialized"}
+	case s.shutdown:
+		return nil, &responseError{Code: codeInvalidRequest, Message: "server is shut down"}
+	}
+
+	switch req.Method {
+	case "initialized", "$/cancelRequest":
+		return nil, nil
+
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+
+	case "textDocument/didOpen":
+		var params DidOpenTextDocumentParams
+		if rerr := decodeParams(req, &params); rerr != nil {
+			return nil, rerr
+		}
+		s.update(params.TextDocument.URI, params.TextDocument.Text)
+		return nil, nil
+
+	case "textDocument/didChange":
+		var params DidChangeTextDocumentParams
+		if rerr := decodeParams(req, &params); rerr != nil {
+			return nil, rerr
+		}
+		if len(params.ContentChanges) == 0 {
+			return nil, nil
+		}
+		text := params.ContentChanges[len(params.ContentChanges)-1].Text
+		s.update(params.TextDocument.URI, text)
+		return nil, nil
+
+	case "textDocument/didClose":
+		var params DidCloseTextDocumentParams
+		if rerr := decodeParams(req, &params); rerr != nil {
+			return nil, rerr
+		}
+		delete(s.docs, params.TextDocument.URI)
+		s.publishDiagnostics(&document{uri: params.TextDocument.URI})
+		return nil, nil
+
+	case "textDocument/definition":
+		var params TextDocumentPositionParams
+		if rerr := decodeParams(req, &params); rerr != nil {
+			return nil, rerr
+		}
+		return s.definition(params)
+
+	case "textDocument/references":
+		var params ReferenceParams
+		if rerr := decodeParams(req, &params); rerr != nil {
+			return nil, rerr
+		}
+		return s.references(params)
+
+	case "textDocument/hover":
+		var params TextDocumentPositionParams
+		if rerr := decodeParams(req, &params); rerr != nil {
+			return nil, rerr
+		}
+		return s.hover(params)
+
+	case "textDocument/documentSymbol":
+		var params DocumentSymbolParams
+		if rerr := decodeParams(req, &params); rerr != nil {
+			return nil, rerr
+		}
+		return s.documentSymbols(params)
+
+	case "textDocument/completion":
+		var params TextDocumentPositionParams
+		if rerr := decodeParams(req, &params); rerr != nil {
+			return nil, rerr
+		}
+		return s.completion(params)
+	}
+
+	return nil, &responseError{Code: codeMethodNotFound, Message: "method not found: " + req.Method}
+}
+
+func decodeParams(req *request, params interface{}) *responseError {
+	if err := json.Unmarshal(req.Params, params); err != nil {
+		return &responseError{Code: codeInvalidParams, Message: err.Error()}
+	}
+	return nil
+}
+
+func (s *Server) initialize() InitializeResult {
+	return InitializeResult{
+		Capabilities: ServerCapabilities{
+			TextDocumentSync:       1, // full
+			DefinitionProvider:     true,
+			ReferencesProvider:     true,
+			HoverProvider:          true,
+			DocumentSymbolProvider: true,
+			CompletionProvider:     &CompletionOptions{},
+		},
+		ServerInfo: ServerInfo{Name: "monkey"},
+	}
+}
+
+// Analyse the new text of a document and publish its diagnostics
+func (s *Server) update(uri, text string) {
+	doc := newDocument(uri, text)
+	s.docs[uri] = doc
+	s.publishDiagnostics(doc)
+}
+
+func (s *Server) publishDiagnostics(doc *document) {
+	diagnostics := []Diagnostic{}
+	for _, d := range doc.diagnostics {
+		severity := SeverityError
+		if d.Severity == parser.SeverityWarning {
+			severity = SeverityWarning
+		}
+		diagnostics = append(diagnostics, Diagnostic{
+			Range:    doc.rangeOf(d.Pos, d.End),
+			Severity: severity,
+			Source:   "monkey",
+			Message:  d.Message,
+		})
+	}
+
+	s.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{
+		URI:         doc.uri,
+		Diagnostics: diagnostics,
+	})
+}
+
+// Return an open document, or an error for unknown documents
+func (s *Server) document(uri string) (*document, *responseError) {
+	doc, ok := s.docs[uri]
+	if !ok {
+		return nil, &responseError{Code: codeInvalidParams, Message: "unknown document " + uri}
+	}
+	return doc, nil
+}
+
+// Find the binding of the identifier at a position, or nil
+func (s *Server) bindingAt(params TextDocumentPositionParams) (*document, *ast.Identifier, *binding, *responseError) {
+	doc, rerr := s.document(params.TextDocument.URI)
+	if rerr != nil {
+		return nil, nil, nil, rerr
+	}
+
+	ident := doc.identifierAt(doc.offset(params.Position))
+	if ident == nil {
+		return doc, nil, nil, nil
+	}
+	return doc, ident, doc.refs[ident], nil
+}
+
+func (s *Server) definition(params TextDocumentPositionParams) (interface{}, *responseError) {
+	doc, _, b, rerr := s.bindingAt(params)
+	if rerr != nil || b == nil {
+		return nil, rerr
+	}
+	return doc.location(b.decl), nil
+}
+
+func (s *Server) references(params ReferenceParams) (interface{}, *responseError) {
+	doc, _, b, rerr := s.bindingAt(params.TextDocumentPositionParams)
+	if rerr != nil || b == nil {
+		return nil, rerr
+	}
+
+	locations := []Location{}
+	for _, ident := range doc.references(b) {
+		if ident != b.decl || params.Context.IncludeDeclaration {
+			locations = append(locations, doc.location(ident))
+		}
+	}
+	return locations, nil
+}
+
+func (s *Server) hover(params TextDocumentPositionParams) (interface{}, *responseError) {
+	doc, ident, b, rerr := s.bindingAt(params)
+	if rerr != nil || ident == nil {
+		return nil, rerr
+	}
+
+	var text string
+	switch {
+	case b != nil:
+		text = signature(b)
+	case object.GetBuiltinByName(ident.Value) != nil:
+		text = "builtin " + ident.Value
+	default:
+		return nil, nil
+	}
+
+	r := doc.rangeOf(ident.Pos(), ident.End())
+	return Hover{
+		Contents: MarkupContent{Kind: "markdown", Value: "```monkey\n" + text + "\n```"},
+		Range:    &r,
+	}, nil
+}
+
+func (s *Server) documentSymbols(params DocumentSymbolParams) (interface{}, *responseError) {
+	doc, rerr := s.document(params.TextDocument.URI)
+	if rerr != nil {
+		return nil, rerr
+	}
+	return doc.symbols(doc.scopes[0]), nil
+}
+
+// Return the let bindings of a scope as symbols, with the bindings of
+// function bodies as their children
+func (doc *document) symbols(s *scope) []DocumentSymbol {
+	symbols := []DocumentSymbol{}
+	for _, b := range s.bindings {
+		if b.let == nil {
+			continue
+		}
+
+		symbol := DocumentSymbol{
+			Name:           b.name,
+			Detail:         signature(b),
+			Kind:           SymbolVariable,
+			Range:          doc.location(b.let).Range,
+			SelectionRange: doc.location(b.decl).Range,
+		}
+		if b.kind == functionBinding || b.kind == macroBinding {
+			symbol.Kind = SymbolFunction
+			for _, inner := range doc.scopes {
+				if inner.node == b.let.Value {
+					symbol.Children = doc.symbols(inner)
+				}
+			}
+		}
+		symbols = append(symbols, symbol)
+	}
+	return symbols
+}
+
+func (s *Server) completion(params TextDocumentPositionParams) (interface{}, *responseError) {
+	doc, rerr := s.document(params.TextDocument.URI)
+	if rerr != nil {
+		return nil, rerr
+	}
+
+	items := []CompletionItem{}
+	seen := map[string]bool{}
+	for _, b := range doc.visibleBindings(doc.offset(params.Position)) {
+		kind := CompletionVariable
+		if b.kind == functionBinding || b.kind == macroBinding {
+			kind = CompletionFunction
+		}
+		items = append(items, CompletionItem{Label: b.name, Kind: kind, Detail: signature(b)})
+		seen[b.name] = true
+	}
+	for _, def := range object.Builtins {
+		if !seen[def.Name] {
+			items = append(items, CompletionItem{Label: def.Name, Kind: CompletionFunction, Detail: "builtin"})
+		}
+	}
+	return items, nil
+}
+
+// Describe a binding. Functions and macros show their parameters
+func signature(b *binding) string {
+	switch b.kind {
+	case functionBinding:
+		fn := b.let.Value.(*ast.FunctionLiteral)
+		params := []string{}
+		for i, param := range fn.Parameters {
+			if def := fn.Default(i); def != nil {
+				params = append(params, param.String()+" = "+def.String())
+			} else {
+				params = append(params, param.String())
+			}
+		}
+		if fn.Rest != nil {
+			params = append(params, "..."+fn.Rest.String())
+		}
+		return fmt.Sprintf("fn %s(%s)", b.name, strings.Join(params, ", "))
+
+	case macroBinding:
+		macro := b.let.Value.(*ast.MacroLiteral)
+		params := []string{}
+		for _, param := range macro.Parameters {
+			params = append(params, param.String())
+		}
+		return fmt.Sprintf("macro %s(%s)", b.name, strings.Join(params, ", "))
+
+	case parameterBinding:
+		return "parameter " + b.name
+
+	default:
+		return "let " + b.name
+	}
+}
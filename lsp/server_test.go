@@ -0,0 +1,493 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pwbrown/go-monkey/internal/framing"
+)
+
+// A message received by the test client
+type testMessage struct {
+	ID     *json.RawMessage `json:"id"`
+	Method string           `json:"method"`
+	Params json.RawMessage  `json:"params"`
+	Result json.RawMessage  `json:"result"`
+	Error  *responseError   `json:"error"`
+}
+
+// A scripted JSON-RPC client talking to a server over pipes
+type testClient struct {
+	t             *testing.T
+	w             *io.PipeWriter
+	messages      chan testMessage
+	notifications []testMessage
+	done          chan error
+	nextID        int
+}
+
+func newTestClient(t *testing.T) *testClient {
+	clientIn, serverOut := io.Pipe()
+	serverIn, clientOut := io.Pipe()
+
+	c := &testClient{
+		t:        t,
+		w:        clientOut,
+		messages: make(chan testMessage, 100),
+		done:     make(chan error, 1),
+	}
+
+	go func() {
+		c.done <- Serve(serverIn, serverOut)
+		serverOut.Close()
+	}()
+
+	go func() {
+		r := bufio.NewReader(clientIn)
+		for {
+			content, err := framing.ReadMessage(r)
+			if err != nil {
+				close(c.messages)
+				return
+			}
+			var msg testMessage
+			if err := json.Unmarshal(content, &msg); err != nil {
+				t.Errorf("invalid message from server: %s", content)
+			}
+			c.messages <- msg
+		}
+	}()
+
+	return c
+}
+
+func (c *testClient) send(msg interface{}) {
+	if err := framing.WriteMessage(c.w, msg); err != nil {
+		c.t.Fatalf("cannot write to server: %v", err)
+	}
+}
+
+// Wait for the next message from the server
+func (c *testClient) receive() testMessage {
+	select {
+	case msg, ok := <-c.messages:
+		if !ok {
+			c.t.Fatalf("server closed the connection")
+		}
+		return msg
+	case <-time.After(5 * time.Second):
+		c.t.Fatalf("timed out waiting for the server")
+	}
+	return testMessage{}
+}
+
+// Send a request and decode the result of its response into result
+func (c *testClient) request(method string, params interface{}, result interface{}) *responseError {
+	c.nextID++
+	id := json.RawMessage(strings.TrimSpace(string(mustMarshal(c.t, c.nextID))))
+	c.send(map[string]interface{}{"jsonrpc": "2.0", "id": &id, "method": method, "params": params})
+
+	for {
+		msg := c.receive()
+		if msg.ID == nil {
+			c.notifications = append(c.notifications, msg)
+			continue
+		}
+		if string(*msg.ID) != string(id) {
+			c.t.Fatalf("response to the wrong request. want id=%s, got=%s", id, *msg.ID)
+		}
+		if msg.Error != nil {
+			return msg.Error
+		}
+		if result != nil {
+			if err := json.Unmarshal(msg.Result, result); err != nil {
+				c.t.Fatalf("cannot decode result %s: %v", msg.Result, err)
+			}
+		}
+		return nil
+	}
+}
+
+func (c *testClient) notify(method string, params interface{}) {
+	c.send(map[string]interface{}{"jsonrpc": "2.0", "method": method, "params": params})
+}
+
+// Wait for a notification from the server and decode its parameters
+func (c *testClient) notification(method string, params interface{}) {
+	var msg testMessage
+	if len(c.notifications) > 0 {
+		msg, c.notifications = c.notifications[0], c.notifications[1:]
+	} else {
+		msg = c.receive()
+	}
+
+	if msg.Method != method {
+		c.t.Fatalf("wrong notification. want=%s, got=%s", method, msg.Method)
+	}
+	if err := json.Unmarshal(msg.Params, params); err != nil {
+		c.t.Fatalf("cannot decode params %s: %v", msg.Params, err)
+	}
+}
+
+// Open a document and return its diagnostics
+func (c *testClient) open(uri, text string) []Diagnostic {
+	c.notify("textDocument/didOpen", DidOpenTextDocumentParams{
+		TextDocument: TextDocumentItem{URI: uri, LanguageID: "monkey", Version: 1, Text: text},
+	})
+
+	var params PublishDiagnosticsParams
+	c.notification("textDocument/publishDiagnostics", &params)
+	if params.URI != uri {
+		c.t.Fatalf("diagnostics for the wrong document. want=%s, got=%s", uri, params.URI)
+	}
+	return params.Diagnostics
+}
+
+// Shut the server down and wait for it to stop
+func (c *testClient) close() error {
+	if rerr := c.request("shutdown", nil, nil); rerr != nil {
+		c.t.Fatalf("shutdown failed: %v", rerr)
+	}
+	c.notify("exit", nil)
+
+	select {
+	case err := <-c.done:
+		return err
+	case <-time.After(5 * time.Second):
+		c.t.Fatalf("timed out waiting for the server to exit")
+	}
+	return nil
+}
+
+func mustMarshal(t *testing.T, v interface{}) []byte {
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+const testURI = "file:///test.mk"
+
+const testSource = `let add = fn(a, b = 2) { a + b };
+let twice = fn(f, x) {
+    let y = f(x);
+    f(y)
+};
+twice(add, 1);
+let m = macro(e) { quote(unquote(e)) };
+puts(len(m));
+`
+
+func pos(line, character int) TextDocumentPositionParams {
+	return TextDocumentPositionParams{
+		TextDocument: TextDocumentIdentifier{URI: testURI},
+		Position:     Position{Line: line, Character: character},
+	}
+}
+
+func rng(line, start, end int) Range {
+	return Range{Start: Position{Line: line, Character: start}, End: Position{Line: line, Character: end}}
+}
+
+func initializedClient(t *testing.T) *testClient {
+	c := newTestClient(t)
+
+	var result InitializeResult
+	if rerr := c.request("initialize", map[string]interface{}{"capabilities": map[string]interface{}{}}, &result); rerr != nil {
+		t.Fatalf("initialize failed: %v", rerr)
+	}
+	c.notify("initialized", map[string]interface{}{})
+
+	if diagnostics := c.open(testURI, testSource); len(diagnostics) != 0 {
+		t.Fatalf("unexpected diagnostics: %+v", diagnostics)
+	}
+	return c
+}
+
+func TestInitialize(t *testing.T) {
+	c := newTestClient(t)
+
+	if rerr := c.request("textDocument/hover", pos(0, 0), nil); rerr == nil || rerr.Code != codeServerNotInitialized {
+		t.Errorf("expected a server not initialized error, got=%v", rerr)
+	}
+
+	var result InitializeResult
+	if rerr := c.request("initialize", map[string]interface{}{}, &result); rerr != nil {
+		t.Fatalf("initialize failed: %v", rerr)
+	}
+
+	caps := result.Capabilities
+	if caps.TextDocumentSync != 1 || !caps.DefinitionProvider || !caps.ReferencesProvider ||
+		!caps.HoverProvider || !caps.DocumentSymbolProvider || caps.CompletionProvider == nil {
+		t.Errorf("wrong capabilities: %+v", caps)
+	}
+
+	if rerr := c.request("workspace/symbol", map[string]interface{}{}, nil); rerr == nil || rerr.Code != codeMethodNotFound {
+		t.Errorf("expected a method not found error, got=%v", rerr)
+	}
+
+	if err := c.close(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestExitWithoutShutdown(t *testing.T) {
+	c := newTestClient(t)
+	c.notify("exit", nil)
+
+	if err := <-c.done; err == nil {
+		t.Errorf("expected an error")
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	c := initializedClient(t)
+
+	diagnostics := c.open("file:///broken.mk", "let x = 1;\nlet y 2;\n")
+	expected := []Diagnostic{{
+		Range:    rng(1, 6, 7),
+		Severity: SeverityError,
+		Source:   "monkey",
+		Message:  "expected next token to be =, got INT instead",
+	}}
+	if !reflect.DeepEqual(diagnostics, expected) {
+		t.Errorf("wrong diagnostics.\nwant=%+v\ngot =%+v", expected, diagnostics)
+	}
+
+	c.notify("textDocument/didChange", DidChangeTextDocumentParams{
+		TextDocument:   TextDocumentIdentifier{URI: "file:///broken.mk"},
+		ContentChanges: []TextDocumentContentChangeEvent{{Text: "let x = 1;\nlet y = 2;\n"}},
+	})
+	var params PublishDiagnosticsParams
+	c.notification("textDocument/publishDiagnostics", &params)
+	if len(params.Diagnostics) != 0 {
+		t.Errorf("unexpected diagnostics after the fix: %+v", params.Diagnostics)
+	}
+
+	c.notify("textDocument/didClose", DidCloseTextDocumentParams{
+		TextDocument: TextDocumentIdentifier{URI: "file:///broken.mk"},
+	})
+	c.notification("textDocument/publishDiagnostics", &params)
+	if params.URI != "file:///broken.mk" || len(params.Diagnostics) != 0 {
+		t.Errorf("diagnostics not cleared on close: %+v", params)
+	}
+
+	if err := c.close(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestDefinition(t *testing.T) {
+	c := initializedClient(t)
+
+	tests := []struct {
+		position TextDocumentPositionParams
+		expected *Location
+	}{
+		{pos(5, 7), &Location{URI: testURI, Range: rng(0, 4, 7)}},    // add
+		{pos(5, 2), &Location{URI: testURI, Range: rng(1, 4, 9)}},    // twice
+		{pos(0, 25), &Location{URI: testURI, Range: rng(0, 13, 14)}}, // a
+		{pos(3, 6), &Location{URI: testURI, Range: rng(2, 8, 9)}},    // y
+		{pos(3, 4), &Location{URI: testURI, Range: rng(1, 15, 16)}},  // f
+		{pos(0, 4), &Location{URI: testURI, Range: rng(0, 4, 7)}},    // a declaration
+		{pos(6, 33), &Location{URI: testURI, Range: rng(6, 14, 15)}}, // macro parameter
+		{pos(5, 0), &Location{URI: testURI, Range: rng(1, 4, 9)}},    // start of a name
+		{pos(0, 0), nil}, // keyword
+	}
+
+	for _, tt := range tests {
+		var location *Location
+		if rerr := c.request("textDocument/definition", tt.position, &location); rerr != nil {
+			t.Fatalf("definition failed: %v", rerr)
+		}
+		if !reflect.DeepEqual(location, tt.expected) {
+			t.Errorf("%+v: wrong definition. want=%+v, got=%+v", tt.position.Position, tt.expected, location)
+		}
+	}
+
+	if err := c.close(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestReferences(t *testing.T) {
+	c := initializedClient(t)
+
+	tests := []struct {
+		position           TextDocumentPositionParams
+		includeDeclaration bool
+		expected           []Range
+	}{
+		{pos(1, 15), true, []Range{rng(1, 15, 16), rng(2, 12, 13), rng(3, 4, 5)}},
+		{pos(1, 15), false, []Range{rng(2, 12, 13), rng(3, 4, 5)}},
+		{pos(5, 7), true, []Range{rng(0, 4, 7), rng(5, 6, 9)}},
+		{pos(0, 25), false, []Range{rng(0, 25, 26)}},
+	}
+
+	for _, tt := range tests {
+		params := ReferenceParams{TextDocumentPositionParams: tt.position}
+		params.Context.IncludeDeclaration = tt.includeDeclaration
+
+		var locations []Location
+		if rerr := c.request("textDocument/references", params, &locations); rerr != nil {
+			t.Fatalf("references failed: %v", rerr)
+		}
+
+		ranges := []Range{}
+		for _, location := range locations {
+			if location.URI != testURI {
+				t.Errorf("wrong URI %s", location.URI)
+			}
+			ranges = append(ranges, location.Range)
+		}
+		if !reflect.DeepEqual(ranges, tt.expected) {
+			t.Errorf("%+v: wrong references.\nwant=%+v\ngot =%+v", tt.position.Position, tt.expected, ranges)
+		}
+	}
+
+	if err := c.close(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestHover(t *testing.T) {
+	c := initializedClient(t)
+
+	tests := []struct {
+		position TextDocumentPositionParams
+		expected string
+	}{
+		{pos(5, 7), "fn add(a, b = 2)"},
+		{pos(5, 0), "fn twice(f, x)"},
+		{pos(1, 15), "parameter f"},
+		{pos(3, 6), "let y"},
+		{pos(6, 5), "macro m(e)"},
+		{pos(7, 6), "builtin len"},
+		{pos(1, 0), ""},
+	}
+
+	for _, tt := range tests {
+		var hover *Hover
+		if rerr := c.request("textDocument/hover", tt.position, &hover); rerr != nil {
+			t.Fatalf("hover failed: %v", rerr)
+		}
+
+		if tt.expected == "" {
+			if hover != nil {
+				t.Errorf("%+v: expected no hover, got=%+v", tt.position.Position, hover)
+			}
+			continue
+		}
+
+		expected := "```monkey\n" + tt.expected + "\n```"
+		if hover == nil || hover.Contents.Value != expected {
+			t.Errorf("%+v: wrong hover. want=%q, got=%+v", tt.position.Position, expected, hover)
+		}
+	}
+
+	if err := c.close(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestDocumentSymbols(t *testing.T) {
+	c := initializedClient(t)
+
+	var symbols []DocumentSymbol
+	params := DocumentSymbolParams{TextDocument: TextDocumentIdentifier{URI: testURI}}
+	if rerr := c.request("textDocument/documentSymbol", params, &symbols); rerr != nil {
+		t.Fatalf("documentSymbol failed: %v", rerr)
+	}
+
+	expected := []DocumentSymbol{
+		{
+			Name:           "add",
+			Detail:         "fn add(a, b = 2)",
+			Kind:           SymbolFunction,
+			Range:          Range{Start: Position{0, 0}, End: Position{0, 32}},
+			SelectionRange: rng(0, 4, 7),
+		},
+		{
+			Name:   "twice",
+			Detail: "fn twice(f, x)",
+			Kind:   SymbolFunction,
+			Range:  Range{Start: Position{1, 0}, End: Position{4, 1}},
+			Children: []DocumentSymbol{{
+				Name:           "y",
+				Detail:         "let y",
+				Kind:           SymbolVariable,
+				Range:          rng(2, 4, 16),
+				SelectionRange: rng(2, 8, 9),
+			}},
+			SelectionRange: rng(1, 4, 9),
+		},
+		{
+			Name:           "m",
+			Detail:         "macro m(e)",
+			Kind:           SymbolFunction,
+			Range:          Range{Start: Position{6, 0}, End: Position{6, 38}},
+			SelectionRange: rng(6, 4, 5),
+		},
+	}
+	if !reflect.DeepEqual(symbols, expected) {
+		t.Errorf("wrong symbols.\nwant=%+v\ngot =%+v", expected, symbols)
+	}
+
+	if err := c.close(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestCompletion(t *testing.T) {
+	c := initializedClient(t)
+
+	tests := []struct {
+		position TextDocumentPositionParams
+		expected []string
+	}{
+		// Inside twice, after y is bound
+		{pos(3, 4), []string{"add", "f", "twice", "x", "y"}},
+		// Inside twice, before y is bound
+		{pos(2, 4), []string{"add", "f", "twice", "x"}},
+		// At the top level, before m is bound
+		{pos(6, 0), []string{"add", "twice"}},
+		// At the end
+		{pos(8, 0), []string{"add", "m", "twice"}},
+	}
+
+	for _, tt := range tests {
+		var items []CompletionItem
+		if rerr := c.request("textDocument/completion", tt.position, &items); rerr != nil {
+			t.Fatalf("completion failed: %v", rerr)
+		}
+
+		names := []string{}
+		builtins := map[string]bool{}
+		for _, item := range items {
+			if item.Detail == "builtin" {
+				builtins[item.Label] = true
+			} else {
+				names = append(names, item.Label)
+			}
+		}
+		sort.Strings(names)
+
+		if !reflect.DeepEqual(names, tt.expected) {
+			t.Errorf("%+v: wrong names. want=%v, got=%v", tt.position.Position, tt.expected, names)
+		}
+		if !builtins["len"] || !builtins["puts"] {
+			t.Errorf("%+v: builtins missing: %v", tt.position.Position, builtins)
+		}
+	}
+
+	if err := c.close(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
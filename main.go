@@ -1,20 +1,269 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
+	"flag"
 	"fmt"
+	"io"
 	"os"
 	"os/user"
 
+	"github.com/pwbrown/go-monkey/compiler"
+	"github.com/pwbrown/go-monkey/dap"
+	"github.com/pwbrown/go-monkey/evaluator"
+	"github.com/pwbrown/go-monkey/format"
+	"github.com/pwbrown/go-monkey/lexer"
+	"github.com/pwbrown/go-monkey/lsp"
+	"github.com/pwbrown/go-monkey/object"
+	"github.com/pwbrown/go-monkey/parser"
 	"github.com/pwbrown/go-monkey/repl"
+	"github.com/pwbrown/go-monkey/vm"
 )
 
+const usage = `Usage:
+  monkey [flags]              start the interactive REPL
+  monkey [flags] run <file>   run a script file
+  monkey [flags] -e <code>    run a snippet of code
+  monkey fmt [-w] [files]     format files, or stdin when no files are given
+  monkey parse [-json] [file] print the syntax tree of a file, or of stdin
+  monkey lsp                  start a language server on stdin and stdout
+  monkey debug                start a debug adapter on stdin and stdout
+
+Flags:
+`
+
 func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// Run the command line and return the process exit code
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("monkey", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprint(stderr, usage)
+		flags.PrintDefaults()
+	}
+
+	code := flags.String("e", "", "run `code` instead of a file")
+	engine := flags.String("engine", "eval", "execution engine: eval (tree-walking) or vm (bytecode)")
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *engine != "eval" && *engine != "vm" {
+		fmt.Fprintf(stderr, "unknown engine %q\n", *engine)
+		return 2
+	}
+
+	switch {
+	case *code != "":
+		return runSource("-e", *code, *engine, stderr)
+	case flags.Arg(0) == "fmt":
+		return formatFiles(flags.Args()[1:], stdin, stdout, stderr)
+	case flags.Arg(0) == "parse":
+		return parseFile(flags.Args()[1:], stdin, stdout, stderr)
+	case flags.Arg(0) == "lsp" && flags.NArg() == 1:
+		if err := lsp.Serve(stdin, stdout); err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		return 0
+	case flags.Arg(0) == "debug" && flags.NArg() == 1:
+		if err := dap.Serve(stdin, stdout); err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		return 0
+	case flags.NArg() == 0:
+		return startRepl(stdin, stdout)
+	case flags.Arg(0) == "run" && flags.NArg() == 2:
+		filename := flags.Arg(1)
+		source, err := os.ReadFile(filename)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		return runSource(filename, string(source), *engine, stderr)
+	default:
+		flags.Usage()
+		return 2
+	}
+}
+
+// Format files, printing the result or rewriting them with -w. Without
+// files, stdin is formatted to stdout
+func formatFiles(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("fmt", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	write := flags.Bool("w", false, "write the result to the files instead of stdout")
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if flags.NArg() == 0 {
+		if *write {
+			fmt.Fprintln(stderr, "cannot use -w with stdin")
+			return 2
+		}
+
+		source, err := io.ReadAll(stdin)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		formatted, err := format.Source("<stdin>", source)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		stdout.Write(formatted)
+		return 0
+	}
+
+	code := 0
+	for _, filename := range flags.Args() {
+		source, err := os.ReadFile(filename)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			code = 1
+			continue
+		}
+
+		formatted, err := format.Source(filename, source)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			code = 1
+			continue
+		}
+
+		if !*write {
+			stdout.Write(formatted)
+		} else if !bytes.Equal(source, formatted) {
+			if err := os.WriteFile(filename, formatted, 0644); err != nil {
+				fmt.Fprintln(stderr, err)
+				code = 1
+			}
+		}
+	}
+	return code
+}
+
+// Parse a file, or stdin, and print its syntax tree in the canonical
+// String form or as JSON
+func parseFile(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("parse", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	asJSON := flags.Bool("json", false, "print the tree as JSON")
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() > 1 {
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+
+	filename := "<stdin>"
+	var source []byte
+	var err error
+	if flags.NArg() == 1 {
+		filename = flags.Arg(0)
+		source, err = os.ReadFile(filename)
+	} else {
+		source, err = io.ReadAll(stdin)
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	p := parser.New(lexer.NewFile(filename, string(source)))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		for _, msg := range p.Errors() {
+			fmt.Fprintln(stderr, msg)
+		}
+		return 1
+	}
+
+	if !*asJSON {
+		fmt.Fprintln(stdout, program.String())
+		return 0
+	}
+
+	enc := json.NewEncoder(stdout)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(program); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// Greet the current user and start the REPL
+func startRepl(stdin io.Reader, stdout io.Writer) int {
 	user, err := user.Current()
 	if err != nil {
 		panic(err)
 	}
-	fmt.Printf("Hello %s! This is the Monkey Pprogramming language!\n",
+	fmt.Fprintf(stdout, "Hello %s! This is the Monkey Pprogramming language!\n",
 		user.Username)
-	fmt.Printf("Feel free to type in commands\n")
-	repl.Start(os.Stdin, os.Stdout)
+	fmt.Fprintf(stdout, "Feel free to type in commands\n")
+	repl.Start(stdin, stdout)
+	return 0
+}
+
+// Parse, expand and execute a program. Errors are reported on stderr
+func runSource(filename, source, engine string, stderr io.Writer) int {
+	l := lexer.NewFile(filename, source)
+	p := parser.New(l)
+
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		for _, msg := range p.Errors() {
+			fmt.Fprintln(stderr, msg)
+		}
+		return 1
+	}
+
+	macroEnv := object.NewEnvironment()
+	macroErrors := evaluator.DefineMacros(program, macroEnv)
+	expanded, expandErrors := evaluator.ExpandMacros(program, macroEnv)
+	macroErrors = append(macroErrors, expandErrors...)
+	if len(macroErrors) != 0 {
+		for _, err := range macroErrors {
+			fmt.Fprintln(stderr, err)
+		}
+		return 1
+	}
+
+	var result object.Object
+	if engine == "vm" {
+		comp := compiler.New()
+		if err := comp.Compile(expanded); err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+
+		machine := vm.New(comp.Bytecode())
+		if err := machine.Run(); err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		result = machine.LastPoppedStackElem()
+	} else {
+		result = evaluator.Eval(expanded, object.NewEnvironment())
+	}
+
+	if err, ok := result.(*object.Error); ok {
+		fmt.Fprintln(stderr, err.Inspect())
+		fmt.Fprint(stderr, err.StackTrace())
+		return 1
+	}
+
+	return 0
 }
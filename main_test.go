@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+
+	script := filepath.Join(dir, "script.mk")
+	source := "#!/usr/bin/env monkey run\nlet add = fn(a, b) { a + b };\nadd(1, true);\n"
+	if err := os.WriteFile(script, []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		args           []string
+		expectedCode   int
+		expectedStderr string
+	}{
+		{[]string{"-e", "let x = 1; x + 1"}, 0, ""},
+		{[]string{"-engine", "vm", "-e", "let x = 1; x + 1"}, 0, ""},
+		{[]string{"-e", "let x 1"}, 1, "-e:1:7: expected next token to be =, got INT instead\n"},
+		{[]string{"-e", "let m = macro(a) { quote(unquote(a)) }; m()"}, 1, "-e:1:41: wrong number of arguments to macro m. got=0, want=1\n"},
+		{[]string{"-e", "-true"}, 1, "ERROR: -e:1:1: unknown operator: -BOOLEAN\n"},
+		{[]string{"-engine", "vm", "-e", "-true"}, 1, "ERROR: unknown operator: -BOOLEAN\n"},
+		{
+			[]string{"run", script},
+			1,
+			"ERROR: " + script + ":2:22: type mismatch: INTEGER + BOOLEAN\n  in add, called at " + script + ":3:1\n",
+		},
+		{[]string{"run", filepath.Join(dir, "missing.mk")}, 1, "no such file"},
+		{[]string{"-engine", "jit", "-e", "1"}, 2, "unknown engine"},
+		{[]string{"run"}, 2, "Usage:"},
+		{[]string{"lsp"}, 1, "exit without a shutdown request"},
+		{[]string{"lsp", "x"}, 2, "Usage:"},
+		{[]string{"debug"}, 0, ""},
+		{[]string{"debug", "x"}, 2, "Usage:"},
+	}
+
+	for _, tt := range tests {
+		var stdout, stderr bytes.Buffer
+		code := run(tt.args, strings.NewReader(""), &stdout, &stderr)
+
+		if code != tt.expectedCode {
+			t.Errorf("%v: wrong exit code. want=%d, got=%d (stderr=%q)",
+				tt.args, tt.expectedCode, code, stderr.String())
+		}
+
+		if tt.expectedStderr == "" && stderr.Len() != 0 ||
+			!strings.Contains(stderr.String(), tt.expectedStderr) {
+			t.Errorf("%v: wrong stderr. want=%q, got=%q",
+				tt.args, tt.expectedStderr, stderr.String())
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	dir := t.TempDir()
+
+	script := filepath.Join(dir, "script.mk")
+	if err := os.WriteFile(script, []byte("let x=1+2\nputs( x )"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	broken := filepath.Join(dir, "broken.mk")
+	if err := os.WriteFile(broken, []byte("let x 1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	formatted := "let x = 1 + 2;\nputs(x);\n"
+
+	tests := []struct {
+		args           []string
+		stdin          string
+		expectedCode   int
+		expectedStdout string
+		expectedStderr string
+	}{
+		{[]string{"fmt"}, "if(a){b}else{c}", 0, "if (a) { b } else { c }\n", ""},
+		{[]string{"fmt", script}, "", 0, formatted, ""},
+		{[]string{"fmt", broken}, "", 1, "", broken + ":1:7: expected next token to be =, got INT instead\n"},
+		{[]string{"fmt", "-w"}, "", 2, "", "cannot use -w with stdin"},
+		{[]string{"fmt", "-w", script}, "", 0, "", ""},
+	}
+
+	for _, tt := range tests {
+		var stdout, stderr bytes.Buffer
+		code := run(tt.args, strings.NewReader(tt.stdin), &stdout, &stderr)
+
+		if code != tt.expectedCode {
+			t.Errorf("%v: wrong exit code. want=%d, got=%d (stderr=%q)",
+				tt.args, tt.expectedCode, code, stderr.String())
+		}
+
+		if stdout.String() != tt.expectedStdout {
+			t.Errorf("%v: wrong stdout. want=%q, got=%q",
+				tt.args, tt.expectedStdout, stdout.String())
+		}
+
+		if tt.expectedStderr == "" && stderr.Len() != 0 ||
+			!strings.Contains(stderr.String(), tt.expectedStderr) {
+			t.Errorf("%v: wrong stderr. want=%q, got=%q",
+				tt.args, tt.expectedStderr, stderr.String())
+		}
+	}
+
+	source, err := os.ReadFile(script)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(source) != formatted {
+		t.Errorf("fmt -w did not rewrite the file. got=%q", source)
+	}
+}
+
+func TestParse(t *testing.T) {
+	dir := t.TempDir()
+
+	script := filepath.Join(dir, "script.mk")
+	if err := os.WriteFile(script, []byte("let x = 1 + 2 * 3;"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		args           []string
+		stdin          string
+		expectedCode   int
+		expectedStdout string
+		expectedStderr string
+	}{
+		{[]string{"parse", script}, "", 0, "let x = (1 + (2 * 3));\n", ""},
+		{[]string{"parse"}, "-a", 0, "(-a)\n", ""},
+		{[]string{"parse", "--json", script}, "", 0, `"type": "LetStatement"`, ""},
+		{[]string{"parse", "-json"}, "x", 0, `"filename": "<stdin>"`, ""},
+		{[]string{"parse", "-json"}, "let x 1", 1, "", "<stdin>:1:7: expected next token to be =, got INT instead\n"},
+		{[]string{"parse", filepath.Join(dir, "missing.mk")}, "", 1, "", "no such file"},
+		{[]string{"parse", "a.mk", "b.mk"}, "", 2, "", "Usage:"},
+	}
+
+	for _, tt := range tests {
+		var stdout, stderr bytes.Buffer
+		code := run(tt.args, strings.NewReader(tt.stdin), &stdout, &stderr)
+
+		if code != tt.expectedCode {
+			t.Errorf("%v: wrong exit code. want=%d, got=%d (stderr=%q)",
+				tt.args, tt.expectedCode, code, stderr.String())
+		}
+
+		if !strings.Contains(stdout.String(), tt.expectedStdout) {
+			t.Errorf("%v: wrong stdout. want=%q, got=%q",
+				tt.args, tt.expectedStdout, stdout.String())
+		}
+
+		if tt.expectedStderr == "" && stderr.Len() != 0 ||
+			!strings.Contains(stderr.String(), tt.expectedStderr) {
+			t.Errorf("%v: wrong stderr. want=%q, got=%q",
+				tt.args, tt.expectedStderr, stderr.String())
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package object
+
+import (
+	"context"
+	"fmt"
+)
+
+// Number of steps between checks for a cancelled context
+const cancelCheckInterval = 1024
+
+// Limits bound the resources used by an evaluation. Zero fields are unlimited
+type Limits struct {
+	MaxSteps       int // evaluated nodes
+	MaxDepth       int // nested function calls
+	MaxAllocations int // elements of new arrays and hashes plus bytes of new strings
+}
+
+// A Budget tracks the resources used by one evaluation against its limits.
+// The methods of a nil budget never fail
+type Budget struct {
+	ctx         context.Context
+	limits      Limits
+	steps       int
+	depth       int
+	allocations int
+}
+
+// Create a budget for an evaluation that stops when ctx is done
+func NewBudget(ctx context.Context, limits Limits) *Budget {
+	return &Budget{ctx: ctx, limits: limits}
+}
+
+// Return the context of the evaluation, nil for a nil budget
+func (b *Budget) Context() context.Context {
+	if b == nil {
+		return nil
+	}
+	return b.ctx
+}
+
+// Count an evaluation step, periodically checking for cancellation
+func (b *Budget) Step() *Error {
+	if b == nil {
+		return nil
+	}
+
+	if b.steps%cancelCheckInterval == 0 {
+		if err := b.ctx.Err(); err != nil {
+			return &Error{Message: fmt.Sprintf("evaluation canceled: %s", err), Kind: CANCELED_ERR}
+		}
+	}
+
+	b.steps++
+	if b.limits.MaxSteps > 0 && b.steps > b.limits.MaxSteps {
+		return &Error{
+			Message: fmt.Sprintf("step limit exceeded: %d steps", b.limits.MaxSteps),
+			Kind:    STEP_LIMIT_ERR,
+		}
+	}
+
+	return nil
+}
+
+// Enter a function call, which must be matched by Leave unless it fails
+func (b *Budget) Enter() *Error {
+	if b == nil {
+		return nil
+	}
+
+	if b.limits.MaxDepth > 0 && b.depth >= b.limits.MaxDepth {
+		return &Error{
+			Message: fmt.Sprintf("call depth limit exceeded: %d nested calls", b.limits.MaxDepth),
+			Kind:    DEPTH_LIMIT_ERR,
+		}
+	}
+
+	b.depth++
+	return nil
+}
+
+// Leave a function call
+func (b *Budget) Leave() {
+	if b != nil {
+		b.depth--
+	}
+}
+
+// Count the size of a newly allocated value (see Limits)
+func (b *Budget) Allocate(obj Object) *Error {
+	if b == nil {
+		return nil
+	}
+
+	switch obj := obj.(type) {
+	case *Array:
+		b.allocations += len(obj.Elements)
+	case *Hash:
+		b.allocations += len(obj.Pairs)
+	case *String:
+		b.allocations += len(obj.Value)
+	}
+
+	if b.limits.MaxAllocations > 0 && b.allocations > b.limits.MaxAllocations {
+		return &Error{
+			Message: fmt.Sprintf("allocation limit exceeded: %d values", b.limits.MaxAllocations),
+			Kind:    ALLOCATION_LIMIT_ERR,
+		}
+	}
+
+	return nil
+}
@@ -1,22 +1,26 @@
 package object
 
+import "sort"
+
 // Create a new environment
 func NewEnvironment() *Environment {
 	s := make(map[string]Object)
 	return &Environment{store: s}
 }
 
-// Create an enclosed environment
+// Create an enclosed environment, sharing the budget of the outer one
 func NewEnclosedEnvironment(outer *Environment) *Environment {
 	env := NewEnvironment()
 	env.outer = outer
+	env.budget = outer.budget
 	return env
 }
 
 // Environment
 type Environment struct {
-	store map[string]Object
-	outer *Environment
+	store  map[string]Object
+	outer  *Environment
+	budget *Budget // resources left to evaluations in this environment
 }
 
 // Get a value from the environment by name
@@ -33,3 +37,41 @@ func (e *Environment) Set(name string, val Object) Object {
 	e.store[name] = val
 	return val
 }
+
+// Get the enclosing environment, nil for the outermost one
+func (e *Environment) Outer() *Environment {
+	return e.outer
+}
+
+// Get the budget of evaluations in this environment, nil if unlimited
+func (e *Environment) Budget() *Budget {
+	return e.budget
+}
+
+// Set the budget of evaluations in this environment. Environments enclosed
+// later share it
+func (e *Environment) SetBudget(b *Budget) {
+	e.budget = b
+}
+
+// Update the nearest binding of a name, in this or an outer environment.
+// Returns false if the name is not bound
+func (e *Environment) Assign(name string, val Object) bool {
+	for env := e; env != nil; env = env.outer {
+		if _, ok := env.store[name]; ok {
+			env.store[name] = val
+			return true
+		}
+	}
+	return false
+}
+
+// Return the sorted names bound directly in this environment (not in outer ones)
+func (e *Environment) Names() []string {
+	names := make([]string, 0, len(e.store))
+	for name := range e.store {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
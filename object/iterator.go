@@ -0,0 +1,64 @@
+package object
+
+// An Iterator steps through the items of an array (index and element), a
+// string (index and character) or a hash (key and value, ordered by key)
+type Iterator struct {
+	items    []HashPair
+	keyValue bool
+	next     int
+}
+
+func (it *Iterator) Type() ObjectType { return ITERATOR_OBJ }
+func (it *Iterator) Inspect() string  { return "iterator" }
+
+// Create an iterator over an array, string or hash. Unless keyValue is set
+// for a loop with two names, the value of a hash item is its [key, value]
+// pair. Returns false if the object cannot be iterated over
+func NewIterator(obj Object, keyValue bool) (*Iterator, bool) {
+	var items []HashPair
+
+	switch obj := obj.(type) {
+	case *Array:
+		for i, el := range obj.Elements {
+			items = append(items, HashPair{Key: &Integer{Value: int64(i)}, Value: el})
+		}
+	case *String:
+		i := 0
+		for _, ch := range obj.Value {
+			items = append(items, HashPair{
+				Key:   &Integer{Value: int64(i)},
+				Value: &String{Value: string(ch)},
+			})
+			i++
+		}
+	case *Hash:
+		items = obj.SortedPairs()
+		if !keyValue {
+			for i, pair := range items {
+				items[i].Value = &Array{Elements: []Object{pair.Key, pair.Value}}
+			}
+		}
+	default:
+		return nil, false
+	}
+
+	return &Iterator{items: items, keyValue: keyValue}, true
+}
+
+// Advance to the next item and return its key and value, or false when the
+// iterator is exhausted
+func (it *Iterator) Next() (Object, Object, bool) {
+	if it.next >= len(it.items) {
+		return nil, nil, false
+	}
+
+	item := it.items[it.next]
+	it.next++
+
+	return item.Key, item.Value, true
+}
+
+// Check if the iterator was created for a loop with two names
+func (it *Iterator) KeyValue() bool {
+	return it.keyValue
+}
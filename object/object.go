@@ -4,9 +4,14 @@ import (
 	"bytes"
 	"fmt"
 	"hash/fnv"
+	"math"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/pwbrown/go-monkey/ast"
+	"github.com/pwbrown/go-monkey/code"
+	"github.com/pwbrown/go-monkey/token"
 )
 
 type ObjectType string
@@ -18,8 +23,13 @@ type Hashable interface {
 
 const (
 	INTEGER_OBJ      = "INTEGER"
+	FLOAT_OBJ        = "FLOAT"
 	BOOLEAN_OBJ      = "BOOLEAN"
 	RETURN_VALUE_OBJ = "RETURN_VALUE"
+	BREAK_OBJ        = "BREAK"
+	CONTINUE_OBJ     = "CONTINUE"
+	TAIL_CALL_OBJ    = "TAIL_CALL"
+	ITERATOR_OBJ     = "ITERATOR"
 	FUNCTION_OBJ     = "FUNCTION"
 	STRING_OBJ       = "STRING"
 	ARRAY_OBJ        = "ARRAY"
@@ -27,8 +37,12 @@ const (
 	HASH_OBJ         = "HASH"
 	QUOTE_OBJ        = "QUOTE"
 	MACRO_OBJ        = "MACRO"
-	ERROR_OBJ        = "ERROR"
-	NULL_OBJ         = "NULL"
+
+	COMPILED_FUNCTION_OBJ = "COMPILED_FUNCTION"
+	CLOSURE_OBJ           = "CLOSURE"
+	CELL_OBJ              = "CELL"
+	ERROR_OBJ             = "ERROR"
+	NULL_OBJ              = "NULL"
 )
 
 type Object interface {
@@ -44,6 +58,23 @@ type Integer struct {
 func (i *Integer) Type() ObjectType { return INTEGER_OBJ }
 func (i *Integer) Inspect() string  { return fmt.Sprintf("%d", i.Value) }
 
+// Float
+type Float struct {
+	Value float64
+}
+
+func (f *Float) Type() ObjectType { return FLOAT_OBJ }
+func (f *Float) Inspect() string  { return FormatFloat(f.Value) }
+
+// Format a float so that it always reads back as a float (3 -> 3.0)
+func FormatFloat(value float64) string {
+	s := strconv.FormatFloat(value, 'g', -1, 64)
+	if strings.ContainsAny(s, ".eIN") {
+		return s
+	}
+	return s + ".0"
+}
+
 // String
 type String struct {
 	Value string
@@ -63,8 +94,11 @@ func (b *Boolean) Inspect() string  { return fmt.Sprintf("%t", b.Value) }
 // Function
 type Function struct {
 	Parameters []*ast.Identifier
+	Defaults   []ast.Expression // default value of each parameter, nil where there is none
+	Rest       *ast.Identifier  // bound to an array of the remaining arguments, may be nil
 	Body       *ast.BlockStatement
 	Env        *Environment
+	Name       string // name of the let binding the function was defined by
 }
 
 func (f *Function) Type() ObjectType { return FUNCTION_OBJ }
@@ -72,8 +106,15 @@ func (f *Function) Inspect() string {
 	var out bytes.Buffer
 
 	params := []string{}
-	for _, p := range f.Parameters {
-		params = append(params, p.String())
+	for i, p := range f.Parameters {
+		if i < len(f.Defaults) && f.Defaults[i] != nil {
+			params = append(params, p.String()+" = "+f.Defaults[i].String())
+		} else {
+			params = append(params, p.String())
+		}
+	}
+	if f.Rest != nil {
+		params = append(params, "..."+f.Rest.String())
 	}
 
 	out.WriteString("fn")
@@ -131,7 +172,7 @@ func (h *Hash) Inspect() string {
 	var out bytes.Buffer
 
 	pairs := []string{}
-	for _, pair := range h.Pairs {
+	for _, pair := range h.SortedPairs() {
 		pairs = append(pairs, fmt.Sprintf("%s: %s",
 			pair.Key.Inspect(), pair.Value.Inspect()))
 	}
@@ -143,6 +184,40 @@ func (h *Hash) Inspect() string {
 	return out.String()
 }
 
+// Return the pairs ordered by key: first by key type, then by key value
+func (h *Hash) SortedPairs() []HashPair {
+	pairs := make([]HashPair, 0, len(h.Pairs))
+	for _, pair := range h.Pairs {
+		pairs = append(pairs, pair)
+	}
+
+	sort.Slice(pairs, func(i, j int) bool {
+		return lessKey(pairs[i].Key, pairs[j].Key)
+	})
+
+	return pairs
+}
+
+// Order two hash keys
+func lessKey(a, b Object) bool {
+	if a.Type() != b.Type() {
+		return a.Type() < b.Type()
+	}
+
+	switch a := a.(type) {
+	case *Integer:
+		return a.Value < b.(*Integer).Value
+	case *Float:
+		return a.Value < b.(*Float).Value
+	case *String:
+		return a.Value < b.(*String).Value
+	case *Boolean:
+		return !a.Value && b.(*Boolean).Value
+	default:
+		return false
+	}
+}
+
 // Quote
 type Quote struct {
 	Node ast.Node
@@ -179,6 +254,40 @@ func (m *Macro) Inspect() string {
 	return out.String()
 }
 
+// Compiled Function (bytecode for the virtual machine)
+type CompiledFunction struct {
+	Instructions  code.Instructions
+	NumLocals     int
+	NumParameters int
+}
+
+func (cf *CompiledFunction) Type() ObjectType { return COMPILED_FUNCTION_OBJ }
+func (cf *CompiledFunction) Inspect() string {
+	return fmt.Sprintf("CompiledFunction[%p]", cf)
+}
+
+// Closure (compiled function with its captured free variables)
+type Closure struct {
+	Fn   *CompiledFunction
+	Free []Object
+}
+
+func (c *Closure) Type() ObjectType { return CLOSURE_OBJ }
+func (c *Closure) Inspect() string {
+	return fmt.Sprintf("Closure[%p]", c)
+}
+
+// Cell (a compiled variable shared by a function and the closures capturing
+// it, so that an assignment in one is seen by the others)
+type Cell struct {
+	Value Object
+}
+
+func (c *Cell) Type() ObjectType { return CELL_OBJ }
+func (c *Cell) Inspect() string {
+	return fmt.Sprintf("Cell[%p]", c)
+}
+
 // Return Value
 type ReturnValue struct {
 	Value Object
@@ -187,13 +296,132 @@ type ReturnValue struct {
 func (rv *ReturnValue) Type() ObjectType { return RETURN_VALUE_OBJ }
 func (rv *ReturnValue) Inspect() string  { return rv.Value.Inspect() }
 
+// Break and Continue carry a break or continue statement up to the
+// enclosing loop
+type Break struct{}
+
+func (b *Break) Type() ObjectType { return BREAK_OBJ }
+func (b *Break) Inspect() string  { return "break" }
+
+type Continue struct{}
+
+func (c *Continue) Type() ObjectType { return CONTINUE_OBJ }
+func (c *Continue) Inspect() string  { return "continue" }
+
+// A function call in tail position, which the evaluator applies after the
+// calling function returns
+type TailCall struct {
+	Function  *Function
+	Arguments []Object
+	Pos       token.Position // position of the call
+}
+
+func (tc *TailCall) Type() ObjectType { return TAIL_CALL_OBJ }
+func (tc *TailCall) Inspect() string  { return "tail call" }
+
+// Kinds of errors that stop an evaluation from outside of the program, so
+// a host can tell them apart from errors raised by the program itself
+type ErrorKind string
+
+const (
+	CANCELED_ERR         ErrorKind = "CANCELED"
+	STEP_LIMIT_ERR       ErrorKind = "STEP_LIMIT"
+	DEPTH_LIMIT_ERR      ErrorKind = "DEPTH_LIMIT"
+	ALLOCATION_LIMIT_ERR ErrorKind = "ALLOCATION_LIMIT"
+)
+
+// Number of calls printed in a stack trace, the rest are summarized
+const maxStackTraceFrames = 20
+
+// A StackFrame is a function call that an error propagated through
+type StackFrame struct {
+	Function  string         // name of the function, empty if anonymous
+	Pos       token.Position // position of the call, invalid for calls from the host
+	TailCalls int            // calls made in tail position since, whose frames were replaced
+}
+
+func (f StackFrame) String() string {
+	name := f.Function
+	if name == "" {
+		name = "<anonymous>"
+	}
+
+	if f.Pos.IsValid() {
+		return "in " + name + ", called at " + f.Pos.String()
+	}
+	return "in " + name
+}
+
 // Error
 type Error struct {
 	Message string
+	Pos     token.Position // where the error was raised, if known
+	Kind    ErrorKind      // empty for errors raised by the program
+	Stack   []StackFrame   // calls active when the error was raised, innermost first
+	Value   Object         // value passed to throw, nil for errors raised by the runtime
 }
 
 func (e *Error) Type() ObjectType { return ERROR_OBJ }
-func (e *Error) Inspect() string  { return "ERROR: " + e.Message }
+func (e *Error) Inspect() string {
+	if e.Pos.IsValid() {
+		return "ERROR: " + e.Pos.String() + ": " + e.Message
+	}
+	return "ERROR: " + e.Message
+}
+
+// Report whether a program may catch the error. Errors that stop an
+// evaluation from outside of the program cannot be caught
+func (e *Error) Catchable() bool {
+	return e.Kind == ""
+}
+
+// Convert an error to the hash bound by a catch block. It holds the message
+// and the thrown value (the message for runtime errors), and the file, line
+// and column where the error was raised if they are known
+func (e *Error) ToHash() *Hash {
+	value := e.Value
+	if value == nil {
+		value = &String{Value: e.Message}
+	}
+
+	hash := &Hash{Pairs: make(map[HashKey]HashPair)}
+	set := func(key string, value Object) {
+		k := &String{Value: key}
+		hash.Pairs[k.HashKey()] = HashPair{Key: k, Value: value}
+	}
+
+	set("message", &String{Value: e.Message})
+	set("value", value)
+	if e.Pos.IsValid() {
+		if e.Pos.Filename != "" {
+			set("file", &String{Value: e.Pos.Filename})
+		}
+		set("line", &Integer{Value: int64(e.Pos.Line)})
+		set("column", &Integer{Value: int64(e.Pos.Column)})
+	}
+
+	return hash
+}
+
+// Format the stack of an error, one indented call per line
+func (e *Error) StackTrace() string {
+	var out bytes.Buffer
+
+	for i, frame := range e.Stack {
+		if i == maxStackTraceFrames {
+			fmt.Fprintf(&out, "  ... %d more calls\n", len(e.Stack)-i)
+			break
+		}
+		if frame.TailCalls == 1 {
+			out.WriteString("  ... 1 tail call\n")
+		} else if frame.TailCalls > 1 {
+			fmt.Fprintf(&out, "  ... %d tail calls\n", frame.TailCalls)
+		}
+		out.WriteString("  " + frame.String() + "\n")
+	}
+
+	return out.String()
+}
 
 // Null
 type Null struct{}
@@ -222,6 +450,14 @@ func (i *Integer) HashKey() HashKey {
 	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
 }
 
+func (f *Float) HashKey() HashKey {
+	// -0.0 and 0.0 are equal, so they must share a key
+	if f.Value == 0 {
+		return HashKey{Type: f.Type(), Value: 0}
+	}
+	return HashKey{Type: f.Type(), Value: math.Float64bits(f.Value)}
+}
+
 func (s *String) HashKey() HashKey {
 	h := fnv.New64a()
 	h.Write([]byte(s.Value))
@@ -1,6 +1,12 @@
 package object
 
-import "testing"
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/pwbrown/go-monkey/token"
+)
 
 func TestStringHashKey(t *testing.T) {
 	hello1 := &String{Value: "Hello World"}
@@ -58,3 +64,155 @@ func TestIntegerHashKey(t *testing.T) {
 		t.Errorf("integers with twoerent content have same hash keys")
 	}
 }
+
+func TestFloatHashKey(t *testing.T) {
+	pi1 := &Float{Value: 3.14}
+	pi2 := &Float{Value: 3.14}
+	e1 := &Float{Value: 2.71}
+
+	if pi1.HashKey() != pi2.HashKey() {
+		t.Errorf("floats with same value have different hash keys")
+	}
+
+	if pi1.HashKey() == e1.HashKey() {
+		t.Errorf("floats with different values have same hash keys")
+	}
+
+	if (&Float{Value: 0}).HashKey() != (&Float{Value: math.Copysign(0, -1)}).HashKey() {
+		t.Errorf("zero and negative zero have different hash keys")
+	}
+}
+
+func TestFloatInspect(t *testing.T) {
+	tests := []struct {
+		input    float64
+		expected string
+	}{
+		{3.14, "3.14"},
+		{3, "3.0"},
+		{-2, "-2.0"},
+		{1e-9, "1e-09"},
+		{1e21, "1e+21"},
+	}
+
+	for _, tt := range tests {
+		if got := (&Float{Value: tt.input}).Inspect(); got != tt.expected {
+			t.Errorf("Inspect() wrong. want=%q, got=%q", tt.expected, got)
+		}
+	}
+}
+
+func TestHashSortedPairs(t *testing.T) {
+	hash := &Hash{Pairs: map[HashKey]HashPair{}}
+	for _, key := range []Object{
+		&String{Value: "b"}, &Integer{Value: 10}, &String{Value: "a"},
+		&Boolean{Value: true}, &Integer{Value: -1}, &Boolean{Value: false},
+	} {
+		hash.Pairs[key.(Hashable).HashKey()] = HashPair{Key: key, Value: key}
+	}
+
+	expected := `{false: false, true: true, -1: -1, 10: 10, a: a, b: b}`
+	if hash.Inspect() != expected {
+		t.Errorf("pairs in wrong order. want=%q, got=%q", expected, hash.Inspect())
+	}
+}
+
+func TestIterator(t *testing.T) {
+	hash := &Hash{Pairs: map[HashKey]HashPair{}}
+	for _, s := range []string{"y", "x"} {
+		key := &String{Value: s}
+		hash.Pairs[key.HashKey()] = HashPair{Key: key, Value: &Integer{Value: 1}}
+	}
+
+	tests := []struct {
+		iterable Object
+		keyValue bool
+		expected []string
+	}{
+		{&Array{Elements: []Object{&Integer{Value: 5}, &Integer{Value: 6}}}, false, []string{"0 5", "1 6"}},
+		{&String{Value: "hé"}, true, []string{"0 h", "1 é"}},
+		{hash, true, []string{"x 1", "y 1"}},
+		{hash, false, []string{"x [x, 1]", "y [y, 1]"}},
+	}
+
+	for _, tt := range tests {
+		iter, ok := NewIterator(tt.iterable, tt.keyValue)
+		if !ok {
+			t.Fatalf("cannot iterate over %s", tt.iterable.Type())
+		}
+
+		var got []string
+		for key, value, ok := iter.Next(); ok; key, value, ok = iter.Next() {
+			got = append(got, key.Inspect()+" "+value.Inspect())
+		}
+
+		if strings.Join(got, ", ") != strings.Join(tt.expected, ", ") {
+			t.Errorf("wrong items. want=%v, got=%v", tt.expected, got)
+		}
+	}
+
+	if _, ok := NewIterator(&Integer{Value: 1}, false); ok {
+		t.Errorf("expected integer not to be iterable")
+	}
+}
+
+func TestStackTrace(t *testing.T) {
+	err := &Error{Message: "boom"}
+	for i := 0; i < 25; i++ {
+		err.Stack = append(err.Stack, StackFrame{Function: "f", Pos: token.Position{Line: 1, Column: i + 1}})
+	}
+	err.Stack[0].Function = ""
+
+	lines := strings.Split(strings.TrimSuffix(err.StackTrace(), "\n"), "\n")
+	if len(lines) != maxStackTraceFrames+1 {
+		t.Fatalf("wrong number of lines. want=%d, got=%d", maxStackTraceFrames+1, len(lines))
+	}
+
+	expected := map[int]string{
+		0:  "  in <anonymous>, called at 1:1",
+		1:  "  in f, called at 1:2",
+		20: "  ... 5 more calls",
+	}
+	for i, line := range expected {
+		if lines[i] != line {
+			t.Errorf("wrong line %d. want=%q, got=%q", i, line, lines[i])
+		}
+	}
+
+	tail := &Error{Stack: []StackFrame{{Function: "f", TailCalls: 1}, {Function: "g", TailCalls: 2}}}
+	if tail.StackTrace() != "  ... 1 tail call\n  in f\n  ... 2 tail calls\n  in g\n" {
+		t.Errorf("wrong trace with tail calls. got=%q", tail.StackTrace())
+	}
+
+	host := StackFrame{Function: "main"}
+	if host.String() != "in main" {
+		t.Errorf("wrong frame without position. got=%q", host.String())
+	}
+}
+
+func TestErrorToHash(t *testing.T) {
+	tests := []struct {
+		err      *Error
+		expected string
+	}{
+		{&Error{Message: "boom"}, "{message: boom, value: boom}"},
+		{
+			&Error{Message: "[1]", Value: &Array{Elements: []Object{&Integer{Value: 1}}}},
+			"{message: [1], value: [1]}",
+		},
+		{
+			&Error{Message: "boom", Pos: token.Position{Line: 2, Column: 3}},
+			"{column: 3, line: 2, message: boom, value: boom}",
+		},
+		{
+			&Error{Message: "boom", Pos: token.Position{Filename: "a.mk", Line: 2, Column: 3}},
+			"{column: 3, file: a.mk, line: 2, message: boom, value: boom}",
+		},
+	}
+
+	for _, tt := range tests {
+		if got := tt.err.ToHash().Inspect(); got != tt.expected {
+			t.Errorf("wrong hash. want=%q, got=%q", tt.expected, got)
+		}
+	}
+}
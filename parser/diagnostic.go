@@ -0,0 +1,38 @@
+package parser
+
+import "github.com/pwbrown/go-monkey/token"
+
+type Severity int
+
+const (
+	SeverityError Severity = iota
+	SeverityWarning
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityError:
+		return "error"
+	case SeverityWarning:
+		return "warning"
+	default:
+		return "unknown"
+	}
+}
+
+// A Diagnostic is a problem found in the source code
+type Diagnostic struct {
+	Pos      token.Position
+	End      token.Position
+	Severity Severity
+	Message  string
+
+	// Token types of a mismatch, empty when not applicable
+	Expected token.TokenType
+	Actual   token.TokenType
+}
+
+// Format the diagnostic as "position: message"
+func (d Diagnostic) String() string {
+	return d.Pos.String() + ": " + d.Message
+}
@@ -18,35 +18,65 @@ type (
 const (
 	_ int = iota
 	LOWEST
+	ASSIGN      // =, +=, -=, *= or /=
+	LOGICAL_OR  // ||
+	LOGICAL_AND // &&
 	EQUALS      // ==
 	LESSGREATER // > or <
 	SUM         // + or -
-	PRODUCT     // * or /
+	PRODUCT     // *, / or %
 	PREFIX      // -X or !X
 	CALL        // myFunction(x)
 	INDEX       // array[index]
 )
 
 var precedences = map[token.TokenType]int{
-	token.EQ:       EQUALS,
-	token.NOT_EQ:   EQUALS,
-	token.LT:       LESSGREATER,
-	token.GT:       LESSGREATER,
-	token.PLUS:     SUM,
-	token.MINUS:    SUM,
-	token.SLASH:    PRODUCT,
-	token.ASTERISK: PRODUCT,
-	token.LPAREN:   CALL,
-	token.LBRACKET: INDEX,
+	token.ASSIGN:          ASSIGN,
+	token.PLUS_ASSIGN:     ASSIGN,
+	token.MINUS_ASSIGN:    ASSIGN,
+	token.ASTERISK_ASSIGN: ASSIGN,
+	token.SLASH_ASSIGN:    ASSIGN,
+	token.OR:              LOGICAL_OR,
+	token.AND:             LOGICAL_AND,
+	token.EQ:              EQUALS,
+	token.NOT_EQ:          EQUALS,
+	token.LT:              LESSGREATER,
+	token.GT:              LESSGREATER,
+	token.LT_EQ:           LESSGREATER,
+	token.GT_EQ:           LESSGREATER,
+	token.PLUS:            SUM,
+	token.MINUS:           SUM,
+	token.SLASH:           PRODUCT,
+	token.ASTERISK:        PRODUCT,
+	token.PERCENT:         PRODUCT,
+	token.LPAREN:          CALL,
+	token.LBRACKET:        INDEX,
 }
 
 type Parser struct {
-	l      *lexer.Lexer
-	errors []string
+	l           *lexer.Lexer
+	diagnostics []Diagnostic
+	comments    []token.Comment
 
 	curToken  token.Token
 	peekToken token.Token
 
+	// Number of '{' passed but not yet closed
+	braceDepth int
+
+	// Set after an error until the parser resynchronizes at the next statement
+	panicking bool
+
+	// Number of lexer errors already reported as diagnostics
+	lexerErrors int
+
+	// Number of loops enclosing the current token within the current function
+	loopDepth int
+
+	// Set when resynchronizing stopped on the first token of the next
+	// statement (or the end of the block), which must not be skipped
+	resumeAtCur bool
+
 	prefixParseFns map[token.TokenType]prefixParseFn
 	infixParseFns  map[token.TokenType]infixParseFn
 }
@@ -54,8 +84,8 @@ type Parser struct {
 // Create a new parser with a lexer and initialize first 2 tokens
 func New(l *lexer.Lexer) *Parser {
 	p := &Parser{
-		l:      l,
-		errors: []string{},
+		l:           l,
+		diagnostics: []Diagnostic{},
 	}
 
 	// Read two tokens, so curToken and peekToken are set
@@ -65,12 +95,14 @@ func New(l *lexer.Lexer) *Parser {
 	p.prefixParseFns = make(map[token.TokenType]prefixParseFn)
 	p.registerPrefix(token.IDENT, p.parseIdentifier)
 	p.registerPrefix(token.INT, p.parseIntegerLiteral)
+	p.registerPrefix(token.FLOAT, p.parseFloatLiteral)
 	p.registerPrefix(token.BANG, p.parsePrefixExpression)
 	p.registerPrefix(token.MINUS, p.parsePrefixExpression)
 	p.registerPrefix(token.TRUE, p.parseBoolean)
 	p.registerPrefix(token.FALSE, p.parseBoolean)
 	p.registerPrefix(token.LPAREN, p.parseGroupedExpression)
 	p.registerPrefix(token.IF, p.parseIfExpression)
+	p.registerPrefix(token.TRY, p.parseTryExpression)
 	p.registerPrefix(token.FUNCTION, p.parseFunctionLiteral)
 	p.registerPrefix(token.STRING, p.parseStringLiteral)
 	p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)
@@ -82,10 +114,20 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfix(token.MINUS, p.parseInfixExpression)
 	p.registerInfix(token.SLASH, p.parseInfixExpression)
 	p.registerInfix(token.ASTERISK, p.parseInfixExpression)
+	p.registerInfix(token.PERCENT, p.parseInfixExpression)
 	p.registerInfix(token.EQ, p.parseInfixExpression)
 	p.registerInfix(token.NOT_EQ, p.parseInfixExpression)
 	p.registerInfix(token.LT, p.parseInfixExpression)
 	p.registerInfix(token.GT, p.parseInfixExpression)
+	p.registerInfix(token.LT_EQ, p.parseInfixExpression)
+	p.registerInfix(token.GT_EQ, p.parseInfixExpression)
+	p.registerInfix(token.AND, p.parseInfixExpression)
+	p.registerInfix(token.OR, p.parseInfixExpression)
+	p.registerInfix(token.ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.PLUS_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.MINUS_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.ASTERISK_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.SLASH_ASSIGN, p.parseAssignExpression)
 	p.registerInfix(token.LPAREN, p.parseCallExpression)
 	p.registerInfix(token.LBRACKET, p.parseIndexExpression)
 
@@ -98,19 +140,87 @@ func (p *Parser) ParseProgram() *ast.Program {
 	program.Statements = []ast.Statement{}
 
 	for p.curToken.Type != token.EOF {
-		stmt := p.parseStatement()
+		stmt := p.parseStatementOrRecover()
 		if stmt != nil {
 			program.Statements = append(program.Statements, stmt)
 		}
-		p.nextToken()
+		p.nextStatement()
 	}
 
+	program.Comments = p.comments
+
 	return program
 }
 
-// Return parser errors
+// Return parser error messages, each prefixed with its position
 func (p *Parser) Errors() []string {
-	return p.errors
+	errors := []string{}
+	for _, d := range p.diagnostics {
+		if d.Severity == SeverityError {
+			errors = append(errors, d.String())
+		}
+	}
+	return errors
+}
+
+// Return all diagnostics found while parsing
+func (p *Parser) Diagnostics() []Diagnostic {
+	return p.diagnostics
+}
+
+// Parse a statement. If it fails, skip to the start of the next statement
+// so that one error is reported per bad statement, and return nil
+func (p *Parser) parseStatementOrRecover() ast.Statement {
+	depth := p.braceDepth
+	start := p.curToken
+
+	stmt := p.parseStatement()
+	if !p.panicking {
+		return stmt
+	}
+
+	p.synchronize(depth, start)
+	p.panicking = false
+
+	return nil
+}
+
+// Move past the last token of a statement, unless error recovery already did
+func (p *Parser) nextStatement() {
+	if p.resumeAtCur {
+		p.resumeAtCur = false
+		return
+	}
+	p.nextToken()
+}
+
+// Advance to the last token of the current statement: a ';', or the token
+// before a statement keyword or the '}' closing the enclosing block
+func (p *Parser) synchronize(depth int, start token.Token) {
+	for !p.curTokenIs(token.EOF) {
+		// The error was reported at the '}' closing the enclosing block
+		if p.braceDepth < depth {
+			p.resumeAtCur = depth > 0
+			return
+		}
+
+		if p.braceDepth == depth {
+			// The error was reported at the token starting the next statement
+			if isStatementKeyword(p.curToken.Type) && p.curToken.Pos != start.Pos {
+				p.resumeAtCur = true
+				return
+			}
+			if p.curTokenIs(token.SEMICOLON) {
+				return
+			}
+
+			if isStatementKeyword(p.peekToken.Type) || p.peekTokenIs(token.RBRACE) || p.peekTokenIs(token.EOF) {
+				return
+			}
+		}
+
+		p.nextToken()
+	}
 }
 
 // Parse a single statement
@@ -120,6 +230,12 @@ func (p *Parser) parseStatement() ast.Statement {
 		return p.parseLetStatement()
 	case token.RETURN:
 		return p.parseReturnStatement()
+	case token.WHILE:
+		return p.parseWhileStatement()
+	case token.FOR:
+		return p.parseForStatement()
+	case token.BREAK, token.CONTINUE:
+		return p.parseLoopControlStatement()
 	default:
 		return p.parseExpressionStatement()
 	}
@@ -143,6 +259,10 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 
 	stmt.Value = p.parseExpression(LOWEST)
 
+	if fl, ok := stmt.Value.(*ast.FunctionLiteral); ok {
+		fl.Name = stmt.Name.Value
+	}
+
 	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
 	}
@@ -165,6 +285,112 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	return stmt
 }
 
+// Parse a while loop
+func (p *Parser) parseWhileStatement() ast.Statement {
+	stmt := &ast.WhileStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	p.nextToken()
+	stmt.Condition = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	stmt.Body = p.parseLoopBody()
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+// Parse a for loop: for (value in iterable) { } or for (key, value in iterable) { }
+func (p *Parser) parseForStatement() ast.Statement {
+	stmt := &ast.ForStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	stmt.Value = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if p.peekTokenIs(token.COMMA) {
+		p.nextToken()
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		stmt.Key = stmt.Value
+		stmt.Value = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	}
+
+	if !p.expectPeek(token.IN) {
+		return nil
+	}
+
+	p.nextToken()
+	stmt.Iterable = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	stmt.Body = p.parseLoopBody()
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+// Parse the block of a loop, in which break and continue are allowed
+func (p *Parser) parseLoopBody() *ast.BlockStatement {
+	p.loopDepth++
+	defer func() { p.loopDepth-- }()
+
+	return p.parseBlockStatement()
+}
+
+// Parse a break or continue statement
+func (p *Parser) parseLoopControlStatement() ast.Statement {
+	tok := p.curToken
+
+	if p.loopDepth == 0 {
+		p.addError(Diagnostic{
+			Pos:     tok.Pos,
+			End:     tok.End,
+			Message: fmt.Sprintf("%s is not in a loop", tok.Literal),
+			Actual:  tok.Type,
+		})
+		return nil
+	}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	if tok.Type == token.BREAK {
+		return &ast.BreakStatement{Token: tok}
+	}
+	return &ast.ContinueStatement{Token: tok}
+}
+
 // Parse an standalone expression statement
 func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 	stmt := &ast.ExpressionStatement{Token: p.curToken}
@@ -186,11 +412,15 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	p.nextToken()
 
 	for !p.curTokenIs(token.RBRACE) && !p.curTokenIs(token.EOF) {
-		stmt := p.parseStatement()
+		stmt := p.parseStatementOrRecover()
 		if stmt != nil {
 			block.Statements = append(block.Statements, stmt)
 		}
-		p.nextToken()
+		p.nextStatement()
+	}
+
+	if p.curTokenIs(token.RBRACE) {
+		block.Rbrace = p.curToken
 	}
 
 	return block
@@ -259,6 +489,86 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	return exp
 }
 
+// Parse an assignment. Assignments are right associative, a = b = 1 assigns
+// 1 to b, then to a
+func (p *Parser) parseAssignExpression(target ast.Expression) ast.Expression {
+	exp := &ast.AssignExpression{
+		Token:    p.curToken,
+		Target:   target,
+		Operator: p.curToken.Literal,
+	}
+
+	// The target failed to parse and was already reported
+	if target == nil {
+		return nil
+	}
+
+	if !isAssignable(target) {
+		p.addError(Diagnostic{
+			Pos:     target.Pos(),
+			End:     target.End(),
+			Message: fmt.Sprintf("cannot assign to %s", target.String()),
+			Actual:  p.curToken.Type,
+		})
+		return nil
+	}
+
+	p.nextToken()
+	exp.Value = p.parseExpression(ASSIGN - 1)
+
+	return exp
+}
+
+// Report whether an expression can be the target of an assignment. An
+// unquote call is allowed in macros, where it is replaced by the node it
+// evaluates to
+func isAssignable(target ast.Expression) bool {
+	switch target := target.(type) {
+	case *ast.Identifier, *ast.IndexExpression:
+		return true
+	case *ast.CallExpression:
+		return target.Function.TokenLiteral() == "unquote"
+	default:
+		return false
+	}
+}
+
+// Parse a try/catch expression: try { } catch (e) { }
+func (p *Parser) parseTryExpression() ast.Expression {
+	exp := &ast.TryExpression{Token: p.curToken}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	exp.Block = p.parseBlockStatement()
+
+	if !p.expectPeek(token.CATCH) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	exp.Param = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	exp.Catch = p.parseBlockStatement()
+
+	return exp
+}
+
 // Parse an if/else expression
 func (p *Parser) parseIfExpression() ast.Expression {
 	exp := &ast.IfExpression{Token: p.curToken}
@@ -301,19 +611,117 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 		return nil
 	}
 
-	lit.Parameters = p.parseFunctionParameters()
+	if !p.parseFunctionParameters(lit) {
+		return nil
+	}
 
 	if !p.expectPeek(token.LBRACE) {
 		return nil
 	}
 
-	lit.Body = p.parseBlockStatement()
+	lit.Body = p.parseFunctionBody()
 
 	return lit
 }
 
+// Parse the block of a function or macro. Loops around the literal do not
+// allow break or continue inside of it
+func (p *Parser) parseFunctionBody() *ast.BlockStatement {
+	loopDepth := p.loopDepth
+	p.loopDepth = 0
+	defer func() { p.loopDepth = loopDepth }()
+
+	return p.parseBlockStatement()
+}
+
 // Parse a list of function parameters
-func (p *Parser) parseFunctionParameters() []*ast.Identifier {
+// Parse the parameters of a function literal: (a, b = 2, ...rest). Once a
+// parameter has a default value, the ones after it must have one too
+func (p *Parser) parseFunctionParameters(lit *ast.FunctionLiteral) bool {
+	lit.Parameters = []*ast.Identifier{}
+
+	// No parameters
+	if p.peekTokenIs(token.RPAREN) {
+		p.nextToken()
+		return true
+	}
+
+	for {
+		p.nextToken()
+
+		if p.curTokenIs(token.ELLIPSIS) {
+			if !p.expectPeek(token.IDENT) {
+				return false
+			}
+			lit.Rest = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+			if p.peekTokenIs(token.COMMA) {
+				p.addError(Diagnostic{
+					Pos:     lit.Rest.Pos(),
+					End:     lit.Rest.End(),
+					Message: fmt.Sprintf("rest parameter %s must be the last parameter", lit.Rest.Value),
+					Actual:  token.COMMA,
+				})
+				return false
+			}
+			break
+		}
+
+		if !p.curTokenIs(token.IDENT) {
+			p.addError(Diagnostic{
+				Pos: p.curToken.Pos,
+				End: p.curToken.End,
+				Message: fmt.Sprintf("expected next token to be %s, got %s instead",
+					token.IDENT, p.curToken.Type),
+				Expected: token.IDENT,
+				Actual:   p.curToken.Type,
+			})
+			return false
+		}
+
+		ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+		var def ast.Expression
+		if p.peekTokenIs(token.ASSIGN) {
+			p.nextToken()
+			p.nextToken()
+			def = p.parseExpression(LOWEST)
+			if def == nil {
+				return false
+			}
+		} else if len(lit.Defaults) > 0 && lit.Defaults[len(lit.Defaults)-1] != nil {
+			p.addError(Diagnostic{
+				Pos:     ident.Pos(),
+				End:     ident.End(),
+				Message: fmt.Sprintf("parameter %s without a default value follows one with a default", ident.Value),
+				Actual:  p.peekToken.Type,
+			})
+			return false
+		}
+
+		lit.Parameters = append(lit.Parameters, ident)
+		lit.Defaults = append(lit.Defaults, def)
+
+		if !p.peekTokenIs(token.COMMA) {
+			break
+		}
+		p.nextToken()
+	}
+
+	// Functions without default values leave Defaults empty
+	hasDefaults := false
+	for _, def := range lit.Defaults {
+		hasDefaults = hasDefaults || def != nil
+	}
+	if !hasDefaults {
+		lit.Defaults = nil
+	}
+
+	return p.expectPeek(token.RPAREN)
+}
+
+// Parse the parameters of a macro literal, which are plain identifiers
+func (p *Parser) parseMacroParameters() []*ast.Identifier {
 	idents := []*ast.Identifier{}
 
 	// No parameters
@@ -351,6 +759,9 @@ func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
 	exp := &ast.CallExpression{Token: p.curToken, Function: function}
 	exp.Arguments = p.parseExpressionList(token.RPAREN)
+	if p.curTokenIs(token.RPAREN) {
+		exp.Rparen = p.curToken
+	}
 	return exp
 }
 
@@ -359,6 +770,9 @@ func (p *Parser) parseArrayLiteral() ast.Expression {
 	array := &ast.ArrayLiteral{Token: p.curToken}
 
 	array.Elements = p.parseExpressionList(token.RBRACKET)
+	if p.curTokenIs(token.RBRACKET) {
+		array.Rbracket = p.curToken
+	}
 
 	return array
 }
@@ -398,6 +812,7 @@ func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
 	if !p.expectPeek(token.RBRACKET) {
 		return nil
 	}
+	exp.Rbracket = p.curToken
 
 	return exp
 }
@@ -427,6 +842,7 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 	if !p.expectPeek(token.RBRACE) {
 		return nil
 	}
+	hash.Rbrace = p.curToken
 
 	return hash
 }
@@ -439,13 +855,13 @@ func (p *Parser) parseMacroLiteral() ast.Expression {
 		return nil
 	}
 
-	lit.Parameters = p.parseFunctionParameters()
+	lit.Parameters = p.parseMacroParameters()
 
 	if !p.expectPeek(token.LBRACE) {
 		return nil
 	}
 
-	lit.Body = p.parseBlockStatement()
+	lit.Body = p.parseFunctionBody()
 
 	return lit
 }
@@ -461,8 +877,31 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 
 	value, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
 	if err != nil {
-		msg := fmt.Sprintf("could not parse %q as integer", p.curToken.Literal)
-		p.errors = append(p.errors, msg)
+		p.addError(Diagnostic{
+			Pos:     p.curToken.Pos,
+			End:     p.curToken.End,
+			Message: fmt.Sprintf("could not parse %q as integer", p.curToken.Literal),
+			Actual:  p.curToken.Type,
+		})
+		return nil
+	}
+
+	lit.Value = value
+	return lit
+}
+
+// Parse a float literal
+func (p *Parser) parseFloatLiteral() ast.Expression {
+	lit := &ast.FloatLiteral{Token: p.curToken}
+
+	value, err := strconv.ParseFloat(p.curToken.Literal, 64)
+	if err != nil {
+		p.addError(Diagnostic{
+			Pos:     p.curToken.Pos,
+			End:     p.curToken.End,
+			Message: fmt.Sprintf("could not parse %q as float", p.curToken.Literal),
+			Actual:  p.curToken.Type,
+		})
 		return nil
 	}
 
@@ -484,6 +923,25 @@ func (p *Parser) parseBoolean() ast.Expression {
 func (p *Parser) nextToken() {
 	p.curToken = p.peekToken
 	p.peekToken = p.l.NextToken()
+	p.comments = append(p.comments, p.peekToken.Comments...)
+
+	// Lexical errors are reported even while resynchronizing
+	for _, err := range p.l.Errors()[p.lexerErrors:] {
+		p.diagnostics = append(p.diagnostics, Diagnostic{
+			Pos:      err.Pos,
+			End:      err.End,
+			Severity: SeverityError,
+			Message:  err.Msg,
+		})
+	}
+	p.lexerErrors = len(p.l.Errors())
+
+	switch p.curToken.Type {
+	case token.LBRACE:
+		p.braceDepth++
+	case token.RBRACE:
+		p.braceDepth--
+	}
 }
 
 // Check if the current token matches a specific token type
@@ -505,6 +963,15 @@ func (p *Parser) curPrecedence() int {
 	return LOWEST
 }
 
+// Return the precedence of an infix operator, or LOWEST for other tokens
+func Precedence(t token.TokenType) int {
+	if p, ok := precedences[t]; ok {
+		return p
+	}
+
+	return LOWEST
+}
+
 // Return the precendence of the peek(next) token
 func (p *Parser) peekPrecedence() int {
 	if p, ok := precedences[p.peekToken.Type]; ok {
@@ -525,17 +992,38 @@ func (p *Parser) expectPeek(t token.TokenType) bool {
 	}
 }
 
-// Appends a peek error message to the errors slice
+// Appends an error diagnostic, unless the parser is still recovering from
+// an earlier error in the same statement
+func (p *Parser) addError(d Diagnostic) {
+	if p.panicking {
+		return
+	}
+
+	d.Severity = SeverityError
+	p.diagnostics = append(p.diagnostics, d)
+	p.panicking = true
+}
+
+// Appends an error for an unexpected peek token
 func (p *Parser) peekError(t token.TokenType) {
-	msg := fmt.Sprintf("expected next token to be %s, got %s instead",
-		t, p.peekToken.Type)
-	p.errors = append(p.errors, msg)
+	p.addError(Diagnostic{
+		Pos: p.peekToken.Pos,
+		End: p.peekToken.End,
+		Message: fmt.Sprintf("expected next token to be %s, got %s instead",
+			t, p.peekToken.Type),
+		Expected: t,
+		Actual:   p.peekToken.Type,
+	})
 }
 
 // Appends an error for a missing prefix parse function
 func (p *Parser) noPrefixParseFnError(t token.TokenType) {
-	msg := fmt.Sprintf("no prefix parse function for %s found", t)
-	p.errors = append(p.errors, msg)
+	p.addError(Diagnostic{
+		Pos:     p.curToken.Pos,
+		End:     p.curToken.End,
+		Message: fmt.Sprintf("no prefix parse function for %s found", t),
+		Actual:  t,
+	})
 }
 
 // Register a prefix parser function for a specific token type
@@ -547,3 +1035,12 @@ func (p *Parser) registerPrefix(tokenType token.TokenType, fn prefixParseFn) {
 func (p *Parser) registerInfix(tokenType token.TokenType, fn infixParseFn) {
 	p.infixParseFns[tokenType] = fn
 }
+
+// Check if a token type can only start a statement
+func isStatementKeyword(t token.TokenType) bool {
+	switch t {
+	case token.LET, token.RETURN, token.WHILE, token.FOR, token.BREAK, token.CONTINUE:
+		return true
+	}
+	return false
+}
@@ -1,12 +1,16 @@
 package parser
 
 import (
+	"encoding/json"
 	"fmt"
+	"reflect"
 	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/pwbrown/go-monkey/ast"
 	"github.com/pwbrown/go-monkey/lexer"
+	"github.com/pwbrown/go-monkey/token"
 )
 
 func TestLetStatements(t *testing.T) {
@@ -64,6 +68,23 @@ func TestIntegerLiteralExpression(t *testing.T) {
 	testIntegerLiteral(t, expStmt.Expression, 5)
 }
 
+func TestFloatLiteralExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"3.14;", 3.14},
+		{"1e-9;", 1e-9},
+		{"2.5E3;", 2500},
+	}
+
+	for _, tt := range tests {
+		program := parseInput(t, tt.input, 1)
+		expStmt := testExpressionStatement(t, program.Statements[0])
+		testFloatLiteral(t, expStmt.Expression, tt.expected)
+	}
+}
+
 func TestPrefixExpressions(t *testing.T) {
 	tests := []struct {
 		input      string
@@ -72,6 +93,7 @@ func TestPrefixExpressions(t *testing.T) {
 	}{
 		{"!5", "!", 5},
 		{"-15", "-", 15},
+		{"-1.5", "-", 1.5},
 		{"!foobar;", "!", "foobar"},
 		{"-foobar;", "-", "foobar"},
 		{"!true;", "!", true},
@@ -100,6 +122,13 @@ func TestInfixExpressions(t *testing.T) {
 		{"5 < 5;", 5, "<", 5},
 		{"5 == 5;", 5, "==", 5},
 		{"5 != 5;", 5, "!=", 5},
+		{"5 % 5;", 5, "%", 5},
+		{"5 <= 5;", 5, "<=", 5},
+		{"5 >= 5;", 5, ">=", 5},
+		{"true && false", true, "&&", false},
+		{"true || false", true, "||", false},
+		{"1.5 * 2;", 1.5, "*", 2},
+		{"2 < 0.5;", 2, "<", 0.5},
 		{"foobar + barfoo;", "foobar", "+", "barfoo"},
 		{"foobar - barfoo;", "foobar", "-", "barfoo"},
 		{"foobar * barfoo;", "foobar", "*", "barfoo"},
@@ -233,6 +262,22 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"add(a * b[2], b[1], 2 * [1, 2][1])",
 			"add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))",
 		},
+		{
+			"a || b && c",
+			"(a || (b && c))",
+		},
+		{
+			"a && b || c && d",
+			"((a && b) || (c && d))",
+		},
+		{
+			"a < b && c >= d == e",
+			"((a < b) && ((c >= d) == e))",
+		},
+		{
+			"!a || -b <= c % d * e",
+			"((!a) || ((-b) <= ((c % d) * e)))",
+		},
 	}
 
 	for _, tt := range tests {
@@ -244,6 +289,44 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 	}
 }
 
+func TestAssignExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"x = 5;", "(x = 5)"},
+		{"x += y * 2;", "(x += (y * 2))"},
+		{"x -= 1", "(x -= 1)"},
+		{"x *= 1", "(x *= 1)"},
+		{"x /= 1", "(x /= 1)"},
+		{"a = b = c", "(a = (b = c))"},
+		{"a = b || c", "(a = (b || c))"},
+		{"f(x = 1)", "f((x = 1))"},
+		{"arr[0] = 1", "((arr[0]) = 1)"},
+		{"h[\"a\"][i + 1] += 2", "(((h[a])[(i + 1)]) += 2)"},
+		{"unquote(a) = unquote(b)", "(unquote(a) = unquote(b))"},
+	}
+
+	for _, tt := range tests {
+		program := parseInput(t, tt.input, 1)
+
+		if program.String() != tt.expected {
+			t.Errorf("wrong program for %q. want=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+
+	p := New(lexer.New("1 = 2; a + b = c; f(x) = 1;"))
+	p.ParseProgram()
+	expected := []string{
+		"1:1: cannot assign to 1",
+		"1:8: cannot assign to (a + b)",
+		"1:19: cannot assign to f(x)",
+	}
+	if strings.Join(p.Errors(), "\n") != strings.Join(expected, "\n") {
+		t.Errorf("wrong errors. want=%q, got=%q", expected, p.Errors())
+	}
+}
+
 func TestBooleanExpression(t *testing.T) {
 	tests := []struct {
 		input           string
@@ -293,6 +376,152 @@ func TestIfElseExpression(t *testing.T) {
 	testLiteralExpression(t, altStmtExp.Expression, "y")
 }
 
+func TestWhileStatement(t *testing.T) {
+	program := parseInput(t, "while (x < y) { x; break; continue; }", 1)
+
+	stmt, ok := program.Statements[0].(*ast.WhileStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not *ast.WhileStatement. got=%T", program.Statements[0])
+	}
+
+	testInfixExpression(t, stmt.Condition, "x", "<", "y")
+
+	if len(stmt.Body.Statements) != 3 {
+		t.Fatalf("body does not contain 3 statements. got=%d", len(stmt.Body.Statements))
+	}
+	if _, ok := stmt.Body.Statements[1].(*ast.BreakStatement); !ok {
+		t.Errorf("body.Statements[1] is not *ast.BreakStatement. got=%T", stmt.Body.Statements[1])
+	}
+	if _, ok := stmt.Body.Statements[2].(*ast.ContinueStatement); !ok {
+		t.Errorf("body.Statements[2] is not *ast.ContinueStatement. got=%T", stmt.Body.Statements[2])
+	}
+}
+
+func TestForStatement(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedKey   string
+		expectedValue string
+		expected      string
+	}{
+		{"for (x in xs) { x }", "", "x", "for (x in xs) x"},
+		{"for (k, v in h) { v }", "k", "v", "for (k, v in h) v"},
+		{"for (x in [1, 2]) { }", "", "x", "for (x in [1, 2]) "},
+	}
+
+	for _, tt := range tests {
+		program := parseInput(t, tt.input, 1)
+
+		stmt, ok := program.Statements[0].(*ast.ForStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not *ast.ForStatement. got=%T", program.Statements[0])
+		}
+
+		if tt.expectedKey == "" {
+			if stmt.Key != nil {
+				t.Errorf("stmt.Key is not nil. got=%s", stmt.Key)
+			}
+		} else {
+			testIdentifier(t, stmt.Key, tt.expectedKey)
+		}
+		testIdentifier(t, stmt.Value, tt.expectedValue)
+
+		if stmt.String() != tt.expected {
+			t.Errorf("stmt.String() wrong. want=%q, got=%q", tt.expected, stmt.String())
+		}
+	}
+}
+
+func TestLoopTrailingSemicolon(t *testing.T) {
+	tests := []struct {
+		input      string
+		statements int
+		expected   string
+	}{
+		{"while (x < 3) { x += 1 }; puts(x)", 2, "while ((x < 3)) (x += 1)puts(x)"},
+		{`for (c in "ab") { puts(c) }; 1`, 2, "for (c in ab) puts(c)1"},
+		{"while (x) { break; };", 1, "while (x) break;"},
+	}
+
+	for _, tt := range tests {
+		program := parseInput(t, tt.input, tt.statements)
+
+		if program.String() != tt.expected {
+			t.Errorf("program.String() wrong. want=%q, got=%q", tt.expected, program.String())
+		}
+	}
+}
+
+func TestTryExpression(t *testing.T) {
+	program := parseInput(t, "try { risky(); } catch (err) { err }", 1)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	exp, ok := stmt.Expression.(*ast.TryExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not *ast.TryExpression. got=%T", stmt.Expression)
+	}
+
+	if len(exp.Block.Statements) != 1 {
+		t.Errorf("block has wrong number of statements. got=%d", len(exp.Block.Statements))
+	}
+	testIdentifier(t, exp.Param, "err")
+	if len(exp.Catch.Statements) != 1 {
+		t.Errorf("catch block has wrong number of statements. got=%d", len(exp.Catch.Statements))
+	}
+
+	if exp.String() != "try risky() catch (err) err" {
+		t.Errorf("exp.String() wrong. got=%q", exp.String())
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"try { 1 }", "1:10: expected next token to be CATCH, got EOF instead"},
+		{"try { 1 } catch { 2 }", "1:17: expected next token to be (, got { instead"},
+		{"try { 1 } catch (1) { 2 }", "1:18: expected next token to be IDENT, got INT instead"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		if len(p.Errors()) == 0 || p.Errors()[0] != tt.expected {
+			t.Errorf("wrong errors for %q. want first=%q, got=%q", tt.input, tt.expected, p.Errors())
+		}
+	}
+}
+
+func TestLoopErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"break;", []string{"1:1: break is not in a loop"}},
+		{"if (x) { continue }", []string{"1:10: continue is not in a loop"}},
+		{"while (x) { fn() { break; } }", []string{"1:20: break is not in a loop"}},
+		{"for (x xs) { }", []string{"1:8: expected next token to be IN, got IDENT instead"}},
+		{"for (1 in xs) { }", []string{"1:6: expected next token to be IDENT, got INT instead"}},
+		{"while x { }", []string{"1:7: expected next token to be (, got IDENT instead"}},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != len(tt.expected) {
+			t.Errorf("%q: wrong number of errors. want=%v, got=%v", tt.input, tt.expected, errors)
+			continue
+		}
+		for i, msg := range tt.expected {
+			if errors[i] != msg {
+				t.Errorf("%q: wrong error. want=%q, got=%q", tt.input, msg, errors[i])
+			}
+		}
+	}
+}
+
 func TestFunctionLiteralParsing(t *testing.T) {
 	input := `fn(x, y) { x + y; }`
 
@@ -308,6 +537,18 @@ func TestFunctionLiteralParsing(t *testing.T) {
 	testInfixExpression(t, blockStmt.Expression, "x", "+", "y")
 }
 
+func TestFunctionLiteralWithName(t *testing.T) {
+	input := "let myFunction = fn() { };"
+
+	program := parseInput(t, input, 1)
+	letStmt := testLetStatement(t, program.Statements[0], "myFunction")
+	fn := testFunctionLiteral(t, letStmt.Value, 0)
+
+	if fn.Name != "myFunction" {
+		t.Fatalf("function literal name wrong. want=%q, got=%q", "myFunction", fn.Name)
+	}
+}
+
 func TestFunctionParameterParsing(t *testing.T) {
 	tests := []struct {
 		input          string
@@ -328,6 +569,43 @@ func TestFunctionParameterParsing(t *testing.T) {
 	}
 }
 
+func TestDefaultAndRestParameters(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"fn(a, b = 2) { a + b }", "fn(a, b = 2) (a + b)"},
+		{"fn(a = 1, b = a * 2) { b }", "fn(a = 1, b = (a * 2)) b"},
+		{"fn(...rest) { rest }", "fn(...rest) rest"},
+		{"fn(first, second = 0, ...rest) { rest }", "fn(first, second = 0, ...rest) rest"},
+	}
+
+	for _, tt := range tests {
+		program := parseInput(t, tt.input, 1)
+
+		if program.String() != tt.expected {
+			t.Errorf("wrong program for %q. want=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+
+	lit := parseInput(t, "fn(a, b) {}", 1).Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+	if lit.Defaults != nil || lit.Rest != nil {
+		t.Errorf("function without defaults or rest has Defaults=%v, Rest=%v", lit.Defaults, lit.Rest)
+	}
+
+	p := New(lexer.New("fn(a = 1, b) {}; fn(...rest, a) {}; fn(...) {}; fn(a, ...b = 1) {};"))
+	p.ParseProgram()
+	expected := []string{
+		"1:11: parameter b without a default value follows one with a default",
+		"1:24: rest parameter rest must be the last parameter",
+		"1:43: expected next token to be IDENT, got ) instead",
+		"1:60: expected next token to be ), got = instead",
+	}
+	if strings.Join(p.Errors(), "\n") != strings.Join(expected, "\n") {
+		t.Errorf("wrong errors.\nwant=%q\ngot =%q", expected, p.Errors())
+	}
+}
+
 func TestCallExpressionParsing(t *testing.T) {
 	input := "add(1, 2 * 3, 4 + 5);"
 
@@ -526,6 +804,281 @@ func TestMacroLiteralParsing(t *testing.T) {
 	testInfixExpression(t, bodyStmt.Expression, "x", "+", "y")
 }
 
+func TestNodePositions(t *testing.T) {
+	input := `let add = fn(a, b) {
+  a + b
+};
+add(1, [2, 3])[0];`
+
+	program := parseInput(t, input, 2)
+	let := program.Statements[0].(*ast.LetStatement)
+	index := program.Statements[1].(*ast.ExpressionStatement).Expression.(*ast.IndexExpression)
+	call := index.Left.(*ast.CallExpression)
+
+	tests := []struct {
+		node     ast.Node
+		expected string
+	}{
+		{program, "1:1-4:18"},
+		{let, "1:1-3:2"},
+		{let.Value, "1:11-3:2"},
+		{program.Statements[1], "4:1-4:18"},
+		{call, "4:1-4:15"},
+		{call.Arguments[1], "4:8-4:14"},
+		{index.Index, "4:16-4:17"},
+	}
+
+	for i, tt := range tests {
+		span := tt.node.Pos().String() + "-" + tt.node.End().String()
+		if span != tt.expected {
+			t.Errorf("tests[%d] - span of %q wrong. expected=%s, got=%s",
+				i, tt.node.String(), tt.expected, span)
+		}
+	}
+}
+
+func TestErrorPositions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x 5;", "1:7: expected next token to be =, got INT instead"},
+		{"let x = 1;\n  add(1, 2;", "2:11: expected next token to be ), got ; instead"},
+		{"5 + ;", "1:5: no prefix parse function for ; found"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Fatalf("expected parser errors for %q, got none", tt.input)
+		}
+
+		if errors[0] != tt.expected {
+			t.Errorf("wrong error for %q. expected=%q, got=%q",
+				tt.input, tt.expected, errors[0])
+		}
+	}
+}
+
+func TestErrorRecovery(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedErrors []string
+		expectedStmts  []string
+	}{
+		{
+			"let x 5; let y = 10; y;",
+			[]string{"1:7: expected next token to be =, got INT instead"},
+			[]string{"let y = 10;", "y"},
+		},
+		{
+			"let a = add(1, 2; let b = 3;\nlet c = ; c",
+			[]string{
+				"1:17: expected next token to be ), got ; instead",
+				"2:9: no prefix parse function for ; found",
+			},
+			[]string{"let b = 3;", "c"},
+		},
+		{
+			"let x = 5 +\nlet y = 1;",
+			[]string{"2:1: no prefix parse function for LET found"},
+			[]string{"let y = 1;"},
+		},
+		{
+			"let f = fn(x) {\n  let y = ;\n  x + }\nf(1);",
+			[]string{
+				"2:11: no prefix parse function for ; found",
+				"3:7: no prefix parse function for } found",
+			},
+			[]string{"let f = fn(x) ;", "f(1)"},
+		},
+		{
+			"if (x { y } else { z }; let ok = true;",
+			[]string{"1:7: expected next token to be ), got { instead"},
+			[]string{"let ok = true;"},
+		},
+		{
+			"let h = {\"a\": 1, \"b\" 2}; h",
+			[]string{"1:22: expected next token to be :, got INT instead"},
+			[]string{"h"},
+		},
+		{
+			"let 5; return;",
+			[]string{
+				"1:5: expected next token to be IDENT, got INT instead",
+				"1:14: no prefix parse function for ; found",
+			},
+			[]string{},
+		},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != len(tt.expectedErrors) {
+			t.Errorf("wrong number of errors for %q. want=%q, got=%q",
+				tt.input, tt.expectedErrors, errors)
+			continue
+		}
+		for i, msg := range tt.expectedErrors {
+			if errors[i] != msg {
+				t.Errorf("wrong error %d for %q. want=%q, got=%q", i, tt.input, msg, errors[i])
+			}
+		}
+
+		if len(program.Statements) != len(tt.expectedStmts) {
+			t.Errorf("wrong number of statements for %q. want=%q, got=%q",
+				tt.input, tt.expectedStmts, program.String())
+			continue
+		}
+		for i, stmt := range tt.expectedStmts {
+			if program.Statements[i].String() != stmt {
+				t.Errorf("wrong statement %d for %q. want=%q, got=%q",
+					i, tt.input, stmt, program.Statements[i].String())
+			}
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := `// add two numbers
+let add = fn(a, b) { /* sum */ a + b }; // done
+add(1, /* two */ 2)`
+
+	program := parseInput(t, input, 2)
+
+	if program.String() != "let add = fn(a, b) (a + b);add(1, 2)" {
+		t.Errorf("program wrong. got=%q", program.String())
+	}
+
+	expected := []string{"// add two numbers", "/* sum */", "// done", "/* two */"}
+	if len(program.Comments) != len(expected) {
+		t.Fatalf("wrong number of comments. want=%d, got=%d", len(expected), len(program.Comments))
+	}
+	for i, comment := range program.Comments {
+		if comment.Text != expected[i] {
+			t.Errorf("comments[%d] wrong. want=%q, got=%q", i, expected[i], comment.Text)
+		}
+	}
+}
+
+func TestProgramJSON(t *testing.T) {
+	input := `// sum
+let add = fn(a, b = 2, ...rest) { a + b };
+let m = macro(x) { quote(unquote(x) * 2) };
+let h = {"one": 1, "two": [2.5, true]};
+while (h["one"] < 3) { h["one"] += 1; break; }
+for (k, v in h) { if (!v) { continue; } else { -k } }
+try { add(1)[0] } catch (e) { puts("error: " + e) };
+return add(1, 2);`
+
+	program := parseInput(t, input, 7)
+
+	data, err := json.Marshal(program)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var decoded ast.Program
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if decoded.String() != program.String() {
+		t.Errorf("wrong program. want=%q, got=%q", program.String(), decoded.String())
+	}
+	if !reflect.DeepEqual(decoded.Comments, program.Comments) {
+		t.Errorf("wrong comments. want=%+v, got=%+v", program.Comments, decoded.Comments)
+	}
+
+	// Compare the positions of all nodes in source order
+	positions := func(program *ast.Program) []string {
+		list := []string{}
+		ast.Inspect(program, func(node ast.Node) bool {
+			if node != nil {
+				list = append(list, fmt.Sprintf("%T %s-%s", node, node.Pos(), node.End()))
+			}
+			return true
+		})
+		return list
+	}
+	if want, got := positions(program), positions(&decoded); !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong positions.\nwant=%v\ngot =%v", want, got)
+	}
+}
+
+func TestUnterminatedComment(t *testing.T) {
+	p := New(lexer.New("let x = 1; /* never closed"))
+	p.ParseProgram()
+
+	errors := p.Errors()
+	if len(errors) != 1 {
+		t.Fatalf("wrong number of errors. want=1, got=%d (%v)", len(errors), errors)
+	}
+	if errors[0] != "1:12: comment not terminated" {
+		t.Errorf("wrong error. got=%q", errors[0])
+	}
+}
+
+func TestStringErrors(t *testing.T) {
+	p := New(lexer.New(`let x = "a\qb"; let y = "open`))
+	p.ParseProgram()
+
+	diagnostics := p.Diagnostics()
+	expected := []struct {
+		pos, end, message string
+	}{
+		{"1:11", "1:13", "unknown escape sequence"},
+		{"1:25", "1:30", "string literal not terminated"},
+	}
+
+	if len(diagnostics) != len(expected) {
+		t.Fatalf("wrong number of diagnostics. want=%d, got=%d (%v)",
+			len(expected), len(diagnostics), p.Errors())
+	}
+
+	for i, d := range diagnostics {
+		if d.Pos.String() != expected[i].pos || d.End.String() != expected[i].end ||
+			d.Message != expected[i].message {
+			t.Errorf("diagnostics[%d] wrong. want=%s-%s %q, got=%s-%s %q", i,
+				expected[i].pos, expected[i].end, expected[i].message, d.Pos, d.End, d.Message)
+		}
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	l := lexer.NewFile("test.mk", "let x = (1 + 2;")
+	p := New(l)
+	p.ParseProgram()
+
+	diagnostics := p.Diagnostics()
+	if len(diagnostics) != 1 {
+		t.Fatalf("wrong number of diagnostics. want=1, got=%d", len(diagnostics))
+	}
+
+	d := diagnostics[0]
+	if d.Severity != SeverityError {
+		t.Errorf("wrong severity. want=%s, got=%s", SeverityError, d.Severity)
+	}
+	if d.Expected != token.RPAREN || d.Actual != token.SEMICOLON {
+		t.Errorf("wrong tokens. want expected=) actual=;, got expected=%s actual=%s",
+			d.Expected, d.Actual)
+	}
+	if d.Pos.String() != "test.mk:1:15" || d.End.String() != "test.mk:1:16" {
+		t.Errorf("wrong span. want=test.mk:1:15-test.mk:1:16, got=%s-%s", d.Pos, d.End)
+	}
+	if d.String() != "test.mk:1:15: expected next token to be ), got ; instead" {
+		t.Errorf("wrong string. got=%q", d.String())
+	}
+}
+
 // Test an individual let statement with a given name
 func testLetStatement(t *testing.T, s ast.Statement, name string) *ast.LetStatement {
 	letStmt, ok := s.(*ast.LetStatement)
@@ -719,6 +1272,8 @@ func testLiteralExpression(t *testing.T, exp ast.Expression, expected interface{
 		return testIntegerLiteral(t, exp, int64(v))
 	case int64:
 		return testIntegerLiteral(t, exp, v)
+	case float64:
+		return testFloatLiteral(t, exp, v)
 	case string:
 		return testIdentifier(t, exp, v)
 	case bool:
@@ -765,6 +1320,20 @@ func testIntegerLiteral(t *testing.T, e ast.Expression, value int64) *ast.Intege
 	return intLit
 }
 
+// Test float literal expression
+func testFloatLiteral(t *testing.T, e ast.Expression, value float64) *ast.FloatLiteral {
+	floatLit, ok := e.(*ast.FloatLiteral)
+	if !ok {
+		t.Fatalf("e not *ast.FloatLiteral. got=%T", e)
+	}
+
+	if floatLit.Value != value {
+		t.Fatalf("floatLit.Value not %g. got=%g", value, floatLit.Value)
+	}
+
+	return floatLit
+}
+
 // Test boolean literal expression
 func testBoolean(t *testing.T, e ast.Expression, value bool) *ast.Boolean {
 	boolean, ok := e.(*ast.Boolean)
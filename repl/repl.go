@@ -4,45 +4,195 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"os"
+	"strings"
 
 	"github.com/pwbrown/go-monkey/evaluator"
 	"github.com/pwbrown/go-monkey/lexer"
 	"github.com/pwbrown/go-monkey/object"
 	"github.com/pwbrown/go-monkey/parser"
+	"github.com/pwbrown/go-monkey/token"
 )
 
 const PROMPT = ">> "
 
+// Prompt shown while an unfinished input is being continued
+const CONTINUATION_PROMPT = ".. "
+
+const HELP = `Meta-commands:
+  :tokens <code>   print the tokens of code
+  :ast <code>      print the parsed statements of code
+  :env             print the bindings of the current environment
+  :macros          print the defined macros
+  :load <file>     evaluate a file in the current environment
+  :reset           discard all bindings and macros
+  :quit            exit the REPL
+  :help            print this message
+`
+
+// A REPL session with its own bindings
+type session struct {
+	out      io.Writer
+	env      *object.Environment
+	macroEnv *object.Environment
+}
+
 func Start(in io.Reader, out io.Writer) {
 	scanner := bufio.NewScanner(in)
-	env := object.NewEnvironment()
-	macroEnv := object.NewEnvironment()
+	s := &session{out: out}
+	s.reset()
+
+	var input strings.Builder
 
 	for {
-		fmt.Print(PROMPT)
+		if input.Len() == 0 {
+			io.WriteString(out, PROMPT)
+		} else {
+			io.WriteString(out, CONTINUATION_PROMPT)
+		}
+
 		scanned := scanner.Scan()
 		if !scanned {
 			return
 		}
 
 		line := scanner.Text()
-		l := lexer.New(line)
-		p := parser.New(l)
 
+		if input.Len() == 0 && strings.HasPrefix(strings.TrimSpace(line), ":") {
+			if quit := s.runCommand(strings.TrimSpace(line)); quit {
+				return
+			}
+			continue
+		}
+
+		input.WriteString(line)
+		input.WriteString("\n")
+
+		// Keep reading until all braces, brackets and parens are closed
+		if !isComplete(input.String()) {
+			continue
+		}
+
+		s.eval(lexer.New(input.String()))
+		input.Reset()
+	}
+}
+
+// Run a meta-command and report whether the REPL should exit
+func (s *session) runCommand(line string) bool {
+	command, arg := line, ""
+	if idx := strings.IndexAny(line, " \t"); idx >= 0 {
+		command, arg = line[:idx], strings.TrimSpace(line[idx+1:])
+	}
+
+	switch command {
+	case ":tokens":
+		l := lexer.New(arg)
+		for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+			fmt.Fprintf(s.out, "%s\t%s\t%q\n", tok.Pos, tok.Type, tok.Literal)
+		}
+	case ":ast":
+		p := parser.New(lexer.New(arg))
 		program := p.ParseProgram()
 		if len(p.Errors()) != 0 {
-			printParserErrors(out, p.Errors())
-			continue
+			printErrors(s.out, "parser", p.Errors())
+			break
+		}
+		for _, stmt := range program.Statements {
+			fmt.Fprintf(s.out, "%T\t%s-%s\t%s\n", stmt, stmt.Pos(), stmt.End(), stmt.String())
 		}
+	case ":env":
+		printBindings(s.out, s.env)
+	case ":macros":
+		printBindings(s.out, s.macroEnv)
+	case ":load":
+		source, err := os.ReadFile(arg)
+		if err != nil {
+			fmt.Fprintln(s.out, err)
+			break
+		}
+		s.eval(lexer.NewFile(arg, string(source)))
+	case ":reset":
+		s.reset()
+	case ":quit", ":q":
+		return true
+	case ":help":
+		io.WriteString(s.out, HELP)
+	default:
+		fmt.Fprintf(s.out, "unknown command %s, type :help for a list of commands\n", command)
+	}
+
+	return false
+}
+
+// Parse, expand and evaluate input, then print the result
+func (s *session) eval(l *lexer.Lexer) {
+	p := parser.New(l)
 
-		evaluator.DefineMacros(program, macroEnv)
-		expanded := evaluator.ExpandMacros(program, macroEnv)
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		printErrors(s.out, "parser", p.Errors())
+		return
+	}
 
-		evaluated := evaluator.Eval(expanded, env)
-		if evaluated != nil {
-			io.WriteString(out, evaluated.Inspect())
-			io.WriteString(out, "\n")
+	macroErrors := evaluator.DefineMacros(program, s.macroEnv)
+	expanded, expandErrors := evaluator.ExpandMacros(program, s.macroEnv)
+	macroErrors = append(macroErrors, expandErrors...)
+	if len(macroErrors) != 0 {
+		messages := []string{}
+		for _, err := range macroErrors {
+			messages = append(messages, err.Error())
 		}
+		printErrors(s.out, "macro", messages)
+		return
+	}
+
+	evaluated := evaluator.Eval(expanded, s.env)
+	if evaluated != nil {
+		io.WriteString(s.out, evaluated.Inspect())
+		io.WriteString(s.out, "\n")
+	}
+	if err, ok := evaluated.(*object.Error); ok {
+		io.WriteString(s.out, err.StackTrace())
+	}
+}
+
+// Discard all bindings and macros
+func (s *session) reset() {
+	s.env = object.NewEnvironment()
+	s.macroEnv = object.NewEnvironment()
+}
+
+// Check if input has no unclosed braces, brackets, parens, comments or strings
+func isComplete(input string) bool {
+	depth := 0
+
+	l := lexer.New(input)
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		switch tok.Type {
+		case token.LPAREN, token.LBRACE, token.LBRACKET:
+			depth++
+		case token.RPAREN, token.RBRACE, token.RBRACKET:
+			depth--
+		}
+	}
+
+	// An unterminated comment or string runs up to the end of the input
+	// and may be closed on the next line
+	for _, err := range l.Errors() {
+		if err.End.Offset == len(input) {
+			return false
+		}
+	}
+
+	return depth <= 0
+}
+
+// Print the bindings of an environment, one per line
+func printBindings(out io.Writer, env *object.Environment) {
+	for _, name := range env.Names() {
+		value, _ := env.Get(name)
+		fmt.Fprintf(out, "%s = %s\n", name, value.Inspect())
 	}
 }
 
@@ -59,10 +209,10 @@ const MONKEY_FACE = `            __,__
            '-----'
 `
 
-func printParserErrors(out io.Writer, errors []string) {
+func printErrors(out io.Writer, kind string, errors []string) {
 	io.WriteString(out, MONKEY_FACE)
 	io.WriteString(out, "Woops! We ran into some monkey business here!\n")
-	io.WriteString(out, " parser errors:\n")
+	io.WriteString(out, " "+kind+" errors:\n")
 	for _, msg := range errors {
 		io.WriteString(out, "\t"+msg+"\n")
 	}
@@ -0,0 +1,125 @@
+package repl
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMultiLineInput(t *testing.T) {
+	input := `let add = fn(a, b) {
+  a + b
+};
+add(
+  1,
+  [2][0]
+)
+/* a comment
+   over two lines */ add(2, 2)
+`
+	expected := PROMPT + CONTINUATION_PROMPT + CONTINUATION_PROMPT +
+		PROMPT + CONTINUATION_PROMPT + CONTINUATION_PROMPT + CONTINUATION_PROMPT +
+		"3\n" + PROMPT + CONTINUATION_PROMPT + "4\n" + PROMPT
+
+	var out bytes.Buffer
+	Start(strings.NewReader(input), &out)
+
+	if out.String() != expected {
+		t.Errorf("wrong output.\nwant=%q\ngot =%q", expected, out.String())
+	}
+}
+
+func TestMultiLineString(t *testing.T) {
+	input := "\"one\ntwo\"\n\"\\q\"\n"
+	expected := PROMPT + CONTINUATION_PROMPT + "one\ntwo\n" + PROMPT
+
+	var out bytes.Buffer
+	Start(strings.NewReader(input), &out)
+
+	if !strings.HasPrefix(out.String(), expected) {
+		t.Errorf("wrong output.\nwant prefix=%q\ngot =%q", expected, out.String())
+	}
+
+	// An invalid escape cannot be fixed by more input and is reported at once
+	if !strings.Contains(out.String(), "1:2: unknown escape sequence") {
+		t.Errorf("expected escape error. got=%q", out.String())
+	}
+}
+
+// Positions are relative to the input each line was entered with
+func TestStackTrace(t *testing.T) {
+	input := "let inner = fn(x) { x + \"a\" };\nlet outer = fn(x) { inner(x) };\nouter(1)\n"
+	expected := PROMPT + PROMPT + PROMPT +
+		"ERROR: 1:21: type mismatch: INTEGER + STRING\n" +
+		"  in inner, called at 1:21\n" +
+		"  in outer, called at 1:1\n" + PROMPT
+
+	var out bytes.Buffer
+	Start(strings.NewReader(input), &out)
+
+	if out.String() != expected {
+		t.Errorf("wrong output.\nwant=%q\ngot =%q", expected, out.String())
+	}
+}
+
+func TestMacroErrors(t *testing.T) {
+	input := "let m = macro(x) { 1 };\nm(1)\n"
+
+	var out bytes.Buffer
+	Start(strings.NewReader(input), &out)
+
+	expected := " macro errors:\n\t1:1: macro m must return a quoted node, got INTEGER\n"
+	if !strings.Contains(out.String(), expected) {
+		t.Errorf("wrong output.\nwant=%q\ngot =%q", expected, out.String())
+	}
+}
+
+func TestMetaCommands(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "lib.mk")
+	source := "let double = fn(x) { x * 2 };\nlet unless = macro(c, a) { quote(if (!(unquote(c))) { unquote(a) }) };"
+	if err := os.WriteFile(filename, []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{":tokens let x = 1;", []string{
+			"1:1\tLET\t\"let\"", "1:5\tIDENT\t\"x\"", "1:7\t=\t\"=\"", "1:9\tINT\t\"1\"", "1:10\t;\t\";\"",
+		}},
+		{":ast let x = 1 + 2; x", []string{
+			"*ast.LetStatement\t1:1-1:14\tlet x = (1 + 2);",
+			"*ast.ExpressionStatement\t1:16-1:17\tx",
+		}},
+		{":ast let x", []string{"expected next token to be =, got EOF instead"}},
+		{"let a = 1;\nlet b = [a];\n:env", []string{"a = 1\nb = [1]\n"}},
+		{":load " + filename + "\ndouble(21)\n:macros", []string{"42", "unless = macro(c, a)"}},
+		{"let a = 1;\n:reset\n:env\na", []string{">> >> >> ERROR: 1:1: identifier not found: a"}},
+		{":bogus", []string{"unknown command :bogus"}},
+		{":help", []string{HELP}},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		Start(strings.NewReader(tt.input), &out)
+
+		for _, expected := range tt.expected {
+			if !strings.Contains(out.String(), expected) {
+				t.Errorf("output for %q does not contain %q. got=%q",
+					tt.input, expected, out.String())
+			}
+		}
+	}
+}
+
+func TestQuit(t *testing.T) {
+	var out bytes.Buffer
+	Start(strings.NewReader(":quit\n1 + 1\n"), &out)
+
+	if out.String() != PROMPT {
+		t.Errorf("REPL did not stop at :quit. got=%q", out.String())
+	}
+}
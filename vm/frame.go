@@ -0,0 +1,23 @@
+package vm
+
+import (
+	"github.com/pwbrown/go-monkey/code"
+	"github.com/pwbrown/go-monkey/object"
+)
+
+// A Frame is the activation record of a single closure call
+type Frame struct {
+	cl          *object.Closure
+	ip          int // instruction pointer within the closure's instructions
+	basePointer int // stack pointer before the call, locals live above it
+}
+
+// Create a new frame for a closure
+func NewFrame(cl *object.Closure, basePointer int) *Frame {
+	return &Frame{cl: cl, ip: -1, basePointer: basePointer}
+}
+
+// Return the instructions being executed by the frame
+func (f *Frame) Instructions() code.Instructions {
+	return f.cl.Fn.Instructions
+}
@@ -0,0 +1,928 @@
+package vm
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/pwbrown/go-monkey/code"
+	"github.com/pwbrown/go-monkey/compiler"
+	"github.com/pwbrown/go-monkey/object"
+)
+
+const (
+	StackSize   = 2048
+	GlobalsSize = 65536
+	MaxFrames   = 1024
+)
+
+var (
+	True  = &object.Boolean{Value: true}
+	False = &object.Boolean{Value: false}
+	Null  = &object.Null{}
+)
+
+type VM struct {
+	constants   []object.Object
+	globalNames []string
+
+	stack []object.Object
+	sp    int // Always points to the next free slot. Top of stack is stack[sp-1]
+
+	globals []object.Object
+
+	frames      []*Frame
+	framesIndex int
+
+	handlers []handler // installed by the try blocks being executed, innermost last
+}
+
+// A handler resumes execution at a catch block after a runtime error
+type handler struct {
+	framesIndex int // frames above it are discarded
+	sp          int // stack pointer when the try block was entered
+	catchPos    int // position of the catch block in the frame's instructions
+}
+
+// A runtime error raised by the program (as opposed to a fault in the VM)
+type runtimeError struct {
+	err *object.Error
+}
+
+func (e *runtimeError) Error() string { return e.err.Message }
+
+// Create a new virtual machine that runs the compiled bytecode
+func New(bytecode *compiler.Bytecode) *VM {
+	mainFn := &object.CompiledFunction{Instructions: bytecode.Instructions}
+	mainClosure := &object.Closure{Fn: mainFn}
+	mainFrame := NewFrame(mainClosure, 0)
+
+	frames := make([]*Frame, MaxFrames)
+	frames[0] = mainFrame
+
+	return &VM{
+		constants:   bytecode.Constants,
+		globalNames: bytecode.GlobalNames,
+
+		stack: make([]object.Object, StackSize),
+		sp:    0,
+
+		globals: make([]object.Object, GlobalsSize),
+
+		frames:      frames,
+		framesIndex: 1,
+	}
+}
+
+// Create a virtual machine that shares globals with a previous run (e.g.
+// between lines of the REPL)
+func NewWithGlobalsStore(bytecode *compiler.Bytecode, s []object.Object) *VM {
+	vm := New(bytecode)
+	vm.globals = s
+	return vm
+}
+
+// Return the element most recently popped off the stack, which is the
+// result of the last expression statement (or the runtime error)
+func (vm *VM) LastPoppedStackElem() object.Object {
+	return vm.stack[vm.sp]
+}
+
+// Run the bytecode. Like evaluator.Eval, a runtime error stops the program
+// and becomes its result. The returned error reports faults of the VM itself
+func (vm *VM) Run() error {
+	err := vm.run()
+	if rtErr, ok := err.(*runtimeError); ok {
+		vm.sp = 0
+		vm.stack[vm.sp] = rtErr.err
+		return nil
+	}
+	return err
+}
+
+// Execute the program, resuming at the innermost catch block after a
+// runtime error that can be caught
+func (vm *VM) run() error {
+	for {
+		err := vm.execute()
+
+		rtErr, ok := err.(*runtimeError)
+		if !ok || len(vm.handlers) == 0 || !rtErr.err.Catchable() {
+			return err
+		}
+
+		h := vm.handlers[len(vm.handlers)-1]
+		vm.handlers = vm.handlers[:len(vm.handlers)-1]
+
+		vm.framesIndex = h.framesIndex
+		vm.sp = h.sp
+		vm.currentFrame().ip = h.catchPos - 1
+
+		if err := vm.push(rtErr.err.ToHash()); err != nil {
+			return err
+		}
+	}
+}
+
+// Fetch, decode and execute instructions until the main frame is done
+func (vm *VM) execute() error {
+	var ip int
+	var ins code.Instructions
+	var op code.Opcode
+
+	for vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1 {
+		vm.currentFrame().ip++
+
+		ip = vm.currentFrame().ip
+		ins = vm.currentFrame().Instructions()
+		op = code.Opcode(ins[ip])
+
+		switch op {
+		case code.OpConstant:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			if err := vm.push(vm.constants[constIndex]); err != nil {
+				return err
+			}
+		case code.OpPop:
+			vm.pop()
+		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv, code.OpMod,
+			code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpLessThan,
+			code.OpGreaterThanOrEqual, code.OpLessThanOrEqual:
+			if err := vm.executeBinaryOperation(op); err != nil {
+				return err
+			}
+		case code.OpBang:
+			if err := vm.executeBangOperator(); err != nil {
+				return err
+			}
+		case code.OpMinus:
+			if err := vm.executeMinusOperator(); err != nil {
+				return err
+			}
+		case code.OpTrue:
+			if err := vm.push(True); err != nil {
+				return err
+			}
+		case code.OpFalse:
+			if err := vm.push(False); err != nil {
+				return err
+			}
+		case code.OpNull:
+			if err := vm.push(Null); err != nil {
+				return err
+			}
+		case code.OpJump:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip = pos - 1
+		case code.OpJumpNotTruthy:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			condition := vm.pop()
+			if !isTruthy(condition) {
+				vm.currentFrame().ip = pos - 1
+			}
+		case code.OpTry:
+			catchPos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			vm.handlers = append(vm.handlers, handler{
+				framesIndex: vm.framesIndex,
+				sp:          vm.sp,
+				catchPos:    catchPos,
+			})
+		case code.OpEndTry:
+			vm.handlers = vm.handlers[:len(vm.handlers)-1]
+		case code.OpStackDepth:
+			depth := vm.sp - vm.currentFrame().basePointer
+			if err := vm.push(&object.Integer{Value: int64(depth)}); err != nil {
+				return err
+			}
+		case code.OpUnwind:
+			depth := vm.pop().(*object.Integer)
+			vm.sp = vm.currentFrame().basePointer + int(depth.Value)
+		case code.OpIter:
+			names := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			collection := vm.pop()
+			iter, ok := object.NewIterator(collection, names == 2)
+			if !ok {
+				return vm.newError("cannot iterate over %s", collection.Type())
+			}
+			if err := vm.push(iter); err != nil {
+				return err
+			}
+		case code.OpIterNext:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			iter := vm.pop().(*object.Iterator)
+			key, value, ok := iter.Next()
+			if !ok {
+				vm.currentFrame().ip = pos - 1
+				break
+			}
+
+			if err := vm.push(value); err != nil {
+				return err
+			}
+			if iter.KeyValue() {
+				if err := vm.push(key); err != nil {
+					return err
+				}
+			}
+		case code.OpSetGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			vm.globals[globalIndex] = vm.pop()
+		case code.OpGetGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			value := vm.globals[globalIndex]
+			if value == nil {
+				return vm.newError("identifier not found: %s", vm.globalName(int(globalIndex)))
+			}
+
+			if err := vm.push(value); err != nil {
+				return err
+			}
+		case code.OpSetLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			frame := vm.currentFrame()
+			vm.stack[frame.basePointer+int(localIndex)] = vm.pop()
+		case code.OpGetLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			frame := vm.currentFrame()
+			if err := vm.push(vm.stack[frame.basePointer+int(localIndex)]); err != nil {
+				return err
+			}
+		case code.OpGetBuiltin:
+			builtinIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			definition := object.Builtins[builtinIndex]
+			if err := vm.push(definition.Builtin); err != nil {
+				return err
+			}
+		case code.OpGetFree:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			currentClosure := vm.currentFrame().cl
+			if err := vm.push(currentClosure.Free[freeIndex]); err != nil {
+				return err
+			}
+		case code.OpCurrentClosure:
+			currentClosure := vm.currentFrame().cl
+			if err := vm.push(currentClosure); err != nil {
+				return err
+			}
+		case code.OpGetLocalCell:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			if err := vm.push(vm.localCell(int(localIndex)).Value); err != nil {
+				return err
+			}
+		case code.OpSetLocalCell:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			vm.localCell(int(localIndex)).Value = vm.pop()
+		case code.OpLocalCell:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			if err := vm.push(vm.localCell(int(localIndex))); err != nil {
+				return err
+			}
+		case code.OpGetFreeCell:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			cell := vm.currentFrame().cl.Free[freeIndex].(*object.Cell)
+			if err := vm.push(cell.Value); err != nil {
+				return err
+			}
+		case code.OpSetFreeCell:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			cell := vm.currentFrame().cl.Free[freeIndex].(*object.Cell)
+			cell.Value = vm.pop()
+		case code.OpArray:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			array := vm.buildArray(vm.sp-numElements, vm.sp)
+			vm.sp = vm.sp - numElements
+
+			if err := vm.push(array); err != nil {
+				return err
+			}
+		case code.OpHash:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			hash, err := vm.buildHash(vm.sp-numElements, vm.sp)
+			if err != nil {
+				return err
+			}
+			vm.sp = vm.sp - numElements
+
+			if err := vm.push(hash); err != nil {
+				return err
+			}
+		case code.OpIndex:
+			index := vm.pop()
+			left := vm.pop()
+
+			if err := vm.executeIndexExpression(left, index); err != nil {
+				return err
+			}
+		case code.OpSetIndex:
+			op := code.Opcode(code.ReadUint8(ins[ip+1:]))
+			vm.currentFrame().ip += 1
+
+			value := vm.pop()
+			index := vm.pop()
+			left := vm.pop()
+
+			if err := vm.executeSetIndex(op, left, index, value); err != nil {
+				return err
+			}
+		case code.OpCall:
+			numArgs := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			if err := vm.executeCall(int(numArgs)); err != nil {
+				return err
+			}
+		case code.OpReturnValue:
+			returnValue := vm.pop()
+
+			// A return statement at the top level ends the program
+			if vm.framesIndex == 1 {
+				return nil
+			}
+
+			frame := vm.popFrame()
+			vm.sp = frame.basePointer - 1
+
+			if err := vm.push(returnValue); err != nil {
+				return err
+			}
+		case code.OpReturn:
+			frame := vm.popFrame()
+			vm.sp = frame.basePointer - 1
+
+			if err := vm.push(Null); err != nil {
+				return err
+			}
+		case code.OpClosure:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			numFree := code.ReadUint8(ins[ip+3:])
+			vm.currentFrame().ip += 3
+
+			if err := vm.pushClosure(int(constIndex), int(numFree)); err != nil {
+				return err
+			}
+		default:
+			def, err := code.Lookup(byte(op))
+			if err != nil {
+				return err
+			}
+			return fmt.Errorf("unhandled opcode %s", def.Name)
+		}
+	}
+
+	return nil
+}
+
+// Return the cell of a local of the current frame, moving the local into a
+// new cell the first time. Parameters are passed as plain values
+func (vm *VM) localCell(index int) *object.Cell {
+	slot := &vm.stack[vm.currentFrame().basePointer+index]
+	if cell, ok := (*slot).(*object.Cell); ok {
+		return cell
+	}
+
+	value := *slot
+	if value == nil {
+		value = Null
+	}
+	cell := &object.Cell{Value: value}
+	*slot = cell
+	return cell
+}
+
+// Return the frame being executed
+func (vm *VM) currentFrame() *Frame {
+	return vm.frames[vm.framesIndex-1]
+}
+
+// Push a new frame for a call
+func (vm *VM) pushFrame(f *Frame) error {
+	if vm.framesIndex >= MaxFrames {
+		return fmt.Errorf("stack overflow: exceeded %d frames", MaxFrames)
+	}
+
+	vm.frames[vm.framesIndex] = f
+	vm.framesIndex++
+	return nil
+}
+
+// Pop the current frame when a call returns
+func (vm *VM) popFrame() *Frame {
+	vm.framesIndex--
+
+	// Returning from a try block leaves it
+	for len(vm.handlers) > 0 && vm.handlers[len(vm.handlers)-1].framesIndex > vm.framesIndex {
+		vm.handlers = vm.handlers[:len(vm.handlers)-1]
+	}
+
+	return vm.frames[vm.framesIndex]
+}
+
+// Push an object onto the stack
+func (vm *VM) push(o object.Object) error {
+	if vm.sp >= StackSize {
+		return fmt.Errorf("stack overflow: exceeded %d slots", StackSize)
+	}
+
+	vm.stack[vm.sp] = o
+	vm.sp++
+
+	return nil
+}
+
+// Pop an object off the stack
+func (vm *VM) pop() object.Object {
+	o := vm.stack[vm.sp-1]
+	vm.sp--
+	return o
+}
+
+// Call the closure or builtin below the arguments on the stack
+func (vm *VM) executeCall(numArgs int) error {
+	callee := vm.stack[vm.sp-1-numArgs]
+	switch callee := callee.(type) {
+	case *object.Closure:
+		return vm.callClosure(callee, numArgs)
+	case *object.Builtin:
+		return vm.callBuiltin(callee, numArgs)
+	default:
+		return vm.newError("not a function: %s", callee.Type())
+	}
+}
+
+// Call a closure by pushing a new frame with room for its locals
+func (vm *VM) callClosure(cl *object.Closure, numArgs int) error {
+	if numArgs != cl.Fn.NumParameters {
+		return vm.newError("wrong number of arguments: want=%d, got=%d",
+			cl.Fn.NumParameters, numArgs)
+	}
+
+	frame := NewFrame(cl, vm.sp-numArgs)
+	if err := vm.pushFrame(frame); err != nil {
+		return err
+	}
+
+	vm.sp = frame.basePointer + cl.Fn.NumLocals
+	if vm.sp >= StackSize {
+		return fmt.Errorf("stack overflow: exceeded %d slots", StackSize)
+	}
+
+	// Clear the locals left by earlier calls, so their cells are not reused
+	for i := frame.basePointer + numArgs; i < vm.sp; i++ {
+		vm.stack[i] = nil
+	}
+
+	return nil
+}
+
+// Call a builtin function and replace it and its arguments with the result
+func (vm *VM) callBuiltin(builtin *object.Builtin, numArgs int) error {
+	args := vm.stack[vm.sp-numArgs : vm.sp]
+
+	result := builtin.Fn(args...)
+	vm.sp = vm.sp - numArgs - 1
+
+	if err, ok := result.(*object.Error); ok {
+		return &runtimeError{err: err}
+	}
+
+	if result != nil {
+		return vm.push(result)
+	}
+	return vm.push(Null)
+}
+
+// Create a closure of a compiled function, capturing free variables from the stack
+func (vm *VM) pushClosure(constIndex int, numFree int) error {
+	constant := vm.constants[constIndex]
+	function, ok := constant.(*object.CompiledFunction)
+	if !ok {
+		return fmt.Errorf("not a function: %+v", constant)
+	}
+
+	free := make([]object.Object, numFree)
+	for i := 0; i < numFree; i++ {
+		free[i] = vm.stack[vm.sp-numFree+i]
+	}
+	vm.sp = vm.sp - numFree
+
+	closure := &object.Closure{Fn: function, Free: free}
+	return vm.push(closure)
+}
+
+// Execute a binary operation on the top two elements of the stack
+func (vm *VM) executeBinaryOperation(op code.Opcode) error {
+	right := vm.pop()
+	left := vm.pop()
+
+	leftType := left.Type()
+	rightType := right.Type()
+
+	switch {
+	case leftType == object.INTEGER_OBJ && rightType == object.INTEGER_OBJ:
+		return vm.executeBinaryIntegerOperation(op, left, right)
+	case isNumber(left) && isNumber(right):
+		return vm.executeBinaryFloatOperation(op, left, right)
+	case leftType != rightType:
+		return vm.newError("type mismatch: %s %s %s", leftType, operatorString(op), rightType)
+	case leftType == object.STRING_OBJ:
+		return vm.executeBinaryStringOperation(op, left, right)
+	case op == code.OpEqual:
+		return vm.push(nativeBoolToBooleanObject(left == right))
+	case op == code.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObject(left != right))
+	default:
+		return vm.newError("unknown operator: %s %s %s", leftType, operatorString(op), rightType)
+	}
+}
+
+// Execute a binary operation on two integers
+func (vm *VM) executeBinaryIntegerOperation(op code.Opcode, left, right object.Object) error {
+	leftValue := left.(*object.Integer).Value
+	rightValue := right.(*object.Integer).Value
+
+	switch op {
+	case code.OpAdd:
+		return vm.push(&object.Integer{Value: leftValue + rightValue})
+	case code.OpSub:
+		return vm.push(&object.Integer{Value: leftValue - rightValue})
+	case code.OpMul:
+		return vm.push(&object.Integer{Value: leftValue * rightValue})
+	case code.OpDiv:
+		if rightValue == 0 {
+			return vm.newError("division by zero")
+		}
+		return vm.push(&object.Integer{Value: leftValue / rightValue})
+	case code.OpMod:
+		if rightValue == 0 {
+			return vm.newError("division by zero")
+		}
+		return vm.push(&object.Integer{Value: leftValue % rightValue})
+	case code.OpEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue == rightValue))
+	case code.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue != rightValue))
+	case code.OpGreaterThan:
+		return vm.push(nativeBoolToBooleanObject(leftValue > rightValue))
+	case code.OpLessThan:
+		return vm.push(nativeBoolToBooleanObject(leftValue < rightValue))
+	case code.OpGreaterThanOrEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue >= rightValue))
+	case code.OpLessThanOrEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue <= rightValue))
+	default:
+		return vm.newError("unknown operator: %s %s %s",
+			left.Type(), operatorString(op), right.Type())
+	}
+}
+
+// Execute a binary operation on two numbers, promoting an integer to a float
+func (vm *VM) executeBinaryFloatOperation(op code.Opcode, left, right object.Object) error {
+	leftValue := toFloat(left)
+	rightValue := toFloat(right)
+
+	switch op {
+	case code.OpAdd:
+		return vm.push(&object.Float{Value: leftValue + rightValue})
+	case code.OpSub:
+		return vm.push(&object.Float{Value: leftValue - rightValue})
+	case code.OpMul:
+		return vm.push(&object.Float{Value: leftValue * rightValue})
+	case code.OpDiv:
+		return vm.push(&object.Float{Value: leftValue / rightValue})
+	case code.OpMod:
+		return vm.push(&object.Float{Value: math.Mod(leftValue, rightValue)})
+	case code.OpEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue == rightValue))
+	case code.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue != rightValue))
+	case code.OpGreaterThan:
+		return vm.push(nativeBoolToBooleanObject(leftValue > rightValue))
+	case code.OpLessThan:
+		return vm.push(nativeBoolToBooleanObject(leftValue < rightValue))
+	case code.OpGreaterThanOrEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue >= rightValue))
+	case code.OpLessThanOrEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue <= rightValue))
+	default:
+		return vm.newError("unknown operator: %s %s %s",
+			left.Type(), operatorString(op), right.Type())
+	}
+}
+
+// Execute a binary operation on two strings
+func (vm *VM) executeBinaryStringOperation(op code.Opcode, left, right object.Object) error {
+	if op != code.OpAdd {
+		return vm.newError("unknown operator: %s %s %s",
+			left.Type(), operatorString(op), right.Type())
+	}
+
+	leftValue := left.(*object.String).Value
+	rightValue := right.(*object.String).Value
+
+	return vm.push(&object.String{Value: leftValue + rightValue})
+}
+
+// Execute the ! prefix operator
+func (vm *VM) executeBangOperator() error {
+	operand := vm.pop()
+
+	switch operand {
+	case True:
+		return vm.push(False)
+	case False:
+		return vm.push(True)
+	case Null:
+		return vm.push(True)
+	default:
+		return vm.push(False)
+	}
+}
+
+// Execute the - prefix operator
+func (vm *VM) executeMinusOperator() error {
+	operand := vm.pop()
+
+	switch operand := operand.(type) {
+	case *object.Integer:
+		return vm.push(&object.Integer{Value: -operand.Value})
+	case *object.Float:
+		return vm.push(&object.Float{Value: -operand.Value})
+	default:
+		return vm.newError("unknown operator: -%s", operand.Type())
+	}
+}
+
+// Execute an index expression on an array or hash
+func (vm *VM) executeIndexExpression(left, index object.Object) error {
+	switch {
+	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
+		return vm.executeArrayIndex(left, index)
+	case left.Type() == object.STRING_OBJ && index.Type() == object.INTEGER_OBJ:
+		return vm.executeStringIndex(left, index)
+	case left.Type() == object.HASH_OBJ:
+		return vm.executeHashIndex(left, index)
+	default:
+		return vm.newError("index operator not supported: %s", left.Type())
+	}
+}
+
+// Index a string by character (rune), pushing a one character string
+func (vm *VM) executeStringIndex(str, index object.Object) error {
+	value := str.(*object.String).Value
+	i := index.(*object.Integer).Value
+
+	if i >= 0 {
+		for _, ch := range value {
+			if i == 0 {
+				return vm.push(&object.String{Value: string(ch)})
+			}
+			i--
+		}
+	}
+
+	return vm.push(Null)
+}
+
+// Index an array, out of range indexes result in null
+func (vm *VM) executeArrayIndex(array, index object.Object) error {
+	arrayObject := array.(*object.Array)
+	i := index.(*object.Integer).Value
+	max := int64(len(arrayObject.Elements) - 1)
+
+	if i < 0 || i > max {
+		return vm.push(Null)
+	}
+
+	return vm.push(arrayObject.Elements[i])
+}
+
+// Index a hash, missing keys result in null
+func (vm *VM) executeHashIndex(hash, index object.Object) error {
+	hashObject := hash.(*object.Hash)
+
+	key, ok := index.(object.Hashable)
+	if !ok {
+		return vm.newError("unusable as hash key: %s", index.Type())
+	}
+
+	pair, ok := hashObject.Pairs[key.HashKey()]
+	if !ok {
+		return vm.push(Null)
+	}
+
+	return vm.push(pair.Value)
+}
+
+// Assign to an element of an array or hash in place and push the assigned
+// value. A non-zero op combines the current element with the value first
+func (vm *VM) executeSetIndex(op code.Opcode, left, index, value object.Object) error {
+	switch left := left.(type) {
+	case *object.Array:
+		i, ok := index.(*object.Integer)
+		if !ok {
+			return vm.newError("array index must be INTEGER, got %s", index.Type())
+		}
+
+		if i.Value < 0 || i.Value >= int64(len(left.Elements)) {
+			return vm.newError("index out of range: %d with length %d", i.Value, len(left.Elements))
+		}
+
+		if op != 0 {
+			combined, err := vm.combineValues(op, left.Elements[i.Value], value)
+			if err != nil {
+				return err
+			}
+			value = combined
+		}
+
+		left.Elements[i.Value] = value
+	case *object.Hash:
+		key, ok := index.(object.Hashable)
+		if !ok {
+			return vm.newError("unusable as hash key: %s", index.Type())
+		}
+
+		hashKey := key.HashKey()
+
+		if op != 0 {
+			pair, ok := left.Pairs[hashKey]
+			if !ok {
+				return vm.newError("key not found: %s", index.Inspect())
+			}
+
+			combined, err := vm.combineValues(op, pair.Value, value)
+			if err != nil {
+				return err
+			}
+			value = combined
+		}
+
+		left.Pairs[hashKey] = object.HashPair{Key: index, Value: value}
+	default:
+		return vm.newError("index assignment not supported: %s", left.Type())
+	}
+
+	return vm.push(value)
+}
+
+// Apply a binary operation to two values, using the stack for its operands
+// and result
+func (vm *VM) combineValues(op code.Opcode, left, right object.Object) (object.Object, error) {
+	if err := vm.push(left); err != nil {
+		return nil, err
+	}
+	if err := vm.push(right); err != nil {
+		return nil, err
+	}
+	if err := vm.executeBinaryOperation(op); err != nil {
+		return nil, err
+	}
+	return vm.pop(), nil
+}
+
+// Build an array from a range of stack elements
+func (vm *VM) buildArray(startIndex, endIndex int) object.Object {
+	elements := make([]object.Object, endIndex-startIndex)
+
+	for i := startIndex; i < endIndex; i++ {
+		elements[i-startIndex] = vm.stack[i]
+	}
+
+	return &object.Array{Elements: elements}
+}
+
+// Build a hash from a range of alternating key and value stack elements
+func (vm *VM) buildHash(startIndex, endIndex int) (object.Object, error) {
+	hashedPairs := make(map[object.HashKey]object.HashPair)
+
+	for i := startIndex; i < endIndex; i += 2 {
+		key := vm.stack[i]
+		value := vm.stack[i+1]
+
+		pair := object.HashPair{Key: key, Value: value}
+
+		hashKey, ok := key.(object.Hashable)
+		if !ok {
+			return nil, vm.newError("unusable as hash key: %s", key.Type())
+		}
+
+		hashedPairs[hashKey.HashKey()] = pair
+	}
+
+	return &object.Hash{Pairs: hashedPairs}, nil
+}
+
+// Return the name of a global binding for error messages
+func (vm *VM) globalName(index int) string {
+	if index < len(vm.globalNames) {
+		return vm.globalNames[index]
+	}
+	return fmt.Sprintf("global %d", index)
+}
+
+// Raise a runtime error that stops the program
+func (vm *VM) newError(format string, a ...interface{}) error {
+	return &runtimeError{err: &object.Error{Message: fmt.Sprintf(format, a...)}}
+}
+
+// Return the source operator of a binary opcode for error messages
+func operatorString(op code.Opcode) string {
+	switch op {
+	case code.OpAdd:
+		return "+"
+	case code.OpSub:
+		return "-"
+	case code.OpMul:
+		return "*"
+	case code.OpDiv:
+		return "/"
+	case code.OpMod:
+		return "%"
+	case code.OpEqual:
+		return "=="
+	case code.OpNotEqual:
+		return "!="
+	case code.OpGreaterThan:
+		return ">"
+	case code.OpLessThan:
+		return "<"
+	case code.OpGreaterThanOrEqual:
+		return ">="
+	case code.OpLessThanOrEqual:
+		return "<="
+	default:
+		return fmt.Sprintf("op(%d)", op)
+	}
+}
+
+// Convert a native boolean to the shared boolean object
+func nativeBoolToBooleanObject(input bool) *object.Boolean {
+	if input {
+		return True
+	}
+	return False
+}
+
+// Converts an object into a boolean representation
+func isTruthy(obj object.Object) bool {
+	switch obj := obj.(type) {
+	case *object.Boolean:
+		return obj.Value
+	case *object.Null:
+		return false
+	default:
+		return true
+	}
+}
+
+// Check if an object is an integer or a float
+func isNumber(obj object.Object) bool {
+	return obj.Type() == object.INTEGER_OBJ || obj.Type() == object.FLOAT_OBJ
+}
+
+// Convert an integer or float object to a native float
+func toFloat(obj object.Object) float64 {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return float64(obj.Value)
+	case *object.Float:
+		return obj.Value
+	default:
+		return 0
+	}
+}
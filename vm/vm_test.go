@@ -0,0 +1,709 @@
+package vm
+
+import (
+	"testing"
+
+	"github.com/pwbrown/go-monkey/ast"
+	"github.com/pwbrown/go-monkey/compiler"
+	"github.com/pwbrown/go-monkey/lexer"
+	"github.com/pwbrown/go-monkey/object"
+	"github.com/pwbrown/go-monkey/parser"
+)
+
+type vmTestCase struct {
+	input    string
+	expected interface{}
+}
+
+// A string result, expected strings in test cases are error messages
+type str string
+
+func TestIntegerArithmetic(t *testing.T) {
+	tests := []vmTestCase{
+		{"5", 5},
+		{"10", 10},
+		{"-5", -5},
+		{"-10", -10},
+		{"5 + 5 + 5 + 5 - 10", 10},
+		{"2 * 2 * 2 * 2 * 2", 32},
+		{"-50 + 100 + -50", 0},
+		{"5 * 2 + 10", 20},
+		{"5 + 2 * 10", 25},
+		{"20 + 2 * -10", 0},
+		{"50 / 2 * 2 + 10", 60},
+		{"2 * (5 + 10)", 30},
+		{"3 * 3 * 3 + 10", 37},
+		{"3 * (3 * 3) + 10", 37},
+		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+		{"7 % 3", 1},
+		{"-7 % 3", -1},
+		{"2 + 9 % 4 * 3", 5},
+		{"5.5 % 2", 1.5},
+		{"1 / 0", "division by zero"},
+		{"1 % 0", "division by zero"},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestFloatArithmetic(t *testing.T) {
+	tests := []vmTestCase{
+		{"3.14", 3.14},
+		{"1e-9", 1e-9},
+		{"-1.5", -1.5},
+		{"1.5 + 1.5", 3.0},
+		{"1 + 0.5", 1.5},
+		{"0.5 + 1", 1.5},
+		{"7 / 2.0", 3.5},
+		{"10 - 2.5 * 2", 5.0},
+		{"-(1 + 0.25)", -1.25},
+		{"1.5 < 2", true},
+		{"2 > 1.5", true},
+		{"1 <= 1", true},
+		{"2 <= 1", false},
+		{"1 >= 1", true},
+		{"1 >= 2", false},
+		{"1.5 >= 1.5", true},
+		{"1 <= 0.5", false},
+		{"1 == 1.0", true},
+		{"0.1 + 0.2 != 0.3", true},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestLogicalOperators(t *testing.T) {
+	tests := []vmTestCase{
+		{"true && true", true},
+		{"true && false", false},
+		{"false && true", false},
+		{"false || true", true},
+		{"false || false", false},
+		{"1 && 2", true},
+		{"if (false) { 1 } || 0", true},
+		{"1 < 2 && 2 <= 2", true},
+		{"1 > 2 || 3 >= 4", false},
+		// The right operand must not run when the left one decides the result
+		{"let f = fn() { 1 + true }; false && f()", false},
+		{"let f = fn() { 1 + true }; true || f()", true},
+		{"let f = fn() { 1 + true }; true && f()", "type mismatch: INTEGER + BOOLEAN"},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestBooleanExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{"true", true},
+		{"false", false},
+		{"1 < 2", true},
+		{"1 > 2", false},
+		{"1 < 1", false},
+		{"1 > 1", false},
+		{"1 == 1", true},
+		{"1 != 1", false},
+		{"1 == 2", false},
+		{"1 != 2", true},
+		{"true == true", true},
+		{"false == false", true},
+		{"true == false", false},
+		{"true != false", true},
+		{"false != true", true},
+		{"!true", false},
+		{"!false", true},
+		{"!5", false},
+		{"!!true", true},
+		{"!!false", false},
+		{"!!5", true},
+		{"!(if (false) { 5; })", true},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestConditionals(t *testing.T) {
+	tests := []vmTestCase{
+		{"if (true) { 10 }", 10},
+		{"if (false) { 10 }", nil},
+		{"if (1) { 10 }", 10},
+		{"if (1 < 2) { 10 }", 10},
+		{"if (1 > 2) { 10 }", nil},
+		{"if (1 > 2) { 10 } else { 20 }", 20},
+		{"if (1 < 2) { 10 } else { 20 }", 10},
+		{"if (true) { let x = 5; }", nil},
+		{"if (true) {}", nil},
+		{"if ((if (false) { 10 })) { 10 } else { 20 }", 20},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestReturnStatements(t *testing.T) {
+	tests := []vmTestCase{
+		{"return 10;", 10},
+		{"return 10; 9;", 10},
+		{"return 2 * 5; 9;", 10},
+		{"9; return 2 * 5; 9;", 10},
+		{"if (10 > 1) { return 10; }", 10},
+		{
+			`
+				if (10 > 1) {
+					if (10 > 1) {
+						return 10;
+					}
+
+					return 1;
+				}
+			`,
+			10,
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestErrorHandling(t *testing.T) {
+	tests := []vmTestCase{
+		{"5 + true;", "type mismatch: INTEGER + BOOLEAN"},
+		{"5 + true; 5;", "type mismatch: INTEGER + BOOLEAN"},
+		{"1.5 + true;", "type mismatch: FLOAT + BOOLEAN"},
+		{"-true", "unknown operator: -BOOLEAN"},
+		{"true + false;", "unknown operator: BOOLEAN + BOOLEAN"},
+		{"true + false + true + false;", "unknown operator: BOOLEAN + BOOLEAN"},
+		{"5; true + false; 5", "unknown operator: BOOLEAN + BOOLEAN"},
+		{`"Hello" - "World"`, "unknown operator: STRING - STRING"},
+		{"if (10 > 1) { true + false; }", "unknown operator: BOOLEAN + BOOLEAN"},
+		{
+			`
+				if (10 > 1) {
+					if (10 > 1) {
+						return true + false;
+					}
+
+					return 1;
+				}
+			`,
+			"unknown operator: BOOLEAN + BOOLEAN",
+		},
+		{"foobar", "identifier not found: foobar"},
+		{`{"name": "Monkey"}[fn(x) { x }];`, "unusable as hash key: CLOSURE"},
+		{`999[1]`, "index operator not supported: INTEGER"},
+		{`5(1)`, "not a function: INTEGER"},
+		{`fn(a) { a }()`, "wrong number of arguments: want=1, got=0"},
+		{`let f = fn() { 1 + len(1) }; f(); 5`, "argument to `len` not supported, got INTEGER"},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestLoops(t *testing.T) {
+	tests := []vmTestCase{
+		{"let i = 0; let sum = 0; while (i < 5) { let sum = sum + i; let i = i + 1; }; sum", 10},
+		{"let i = 0; while (true) { if (i == 3) { break; } let i = i + 1; } i", 3},
+		{"let i = 0; let odd = 0; while (i < 6) { let i = i + 1; if (i % 2 == 0) { continue; } let odd = odd + i; } odd", 9},
+		{"let i = 0; while (i < 100000) { let i = i + 1; } i", 100000},
+		{"let s = 0; for (x in [1, 2, 3]) { let s = s + x; } s", 6},
+		{"let s = 0; for (i, x in [10, 20]) { let s = s + i * x; } s", 20},
+		{"let n = 0; for (c in \"héllo\") { let n = n + 1; } n", 5},
+		{"let s = 0; for (k, v in {\"b\": 2, \"a\": 1}) { let s = s * 10 + v; } s", 12},
+		{"let s = 0; for (p in {\"a\": 1, \"b\": 2}) { let s = s + p[1]; } s", 3},
+		{"let s = 0; for (x in [1, 2, 3, 4]) { if (x == 3) { break; } let s = s + x; } s", 3},
+		{"let s = 0; for (x in [1, 2, 3, 4]) { if (x % 2 == 1) { continue; } let s = s + x; } s", 6},
+		{"let n = 0; for (x in [1, 2]) { for (y in [1, 2, 3]) { if (y == 2) { break; } let n = n + 1; } } n", 2},
+		{"let f = fn() { for (x in [1, 2, 3]) { if (x == 2) { return x * 10; } } }; f()", 20},
+		{"let f = fn(n) { let i = 0; while (i < n) { let i = i + 1; } i }; f(4)", 4},
+		// break and continue in an if used as a value drop the pending operands
+		{"let i = 0; while (i < 3000) { i += 1; let x = [1, 2, if (true) { continue } else { 3 }] }; i", 3000},
+		{"let i = 0; while (i < 3000) { i += 1; puts(i + if (true) { continue } else { 0 }) }; i", 3000},
+		{"let a = []; while (len(a) < 3000) { a = push(a, 1) }; let n = 0; for (x in a) { n += x * if (true) { continue } else { 1 } }; n", 0},
+		{"let n = 0; for (x in [1, 2, 3]) { n += 1 + if (x == 2) { continue } else { 10 } }; n", 22},
+		{"let n = 0; for (x in [1, 2]) { while (true) { n += [x, if (true) { break }][0] } n += x }; n", 3},
+		{"let f = fn() { let i = 0; while (true) { i += 1; let x = [i, if (i > 3000) { break } else { 0 }] } i }; f()", 3001},
+		{"let f = fn(n) { n }; let s = 0; for (x in [1, 2, 3]) { s += f(if (x == 1) { continue } else { x }) }; s", 5},
+		{"for (x in 5) { x }", "cannot iterate over INTEGER"},
+		{"while (true) { 1 + true; }", "type mismatch: INTEGER + BOOLEAN"},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestAssignment(t *testing.T) {
+	tests := []vmTestCase{
+		{"let x = 1; x = 2; x", 2},
+		{"let x = 1; x += 2; x", 3},
+		{"let x = 5; x -= 2; x", 3},
+		{"let x = 5; x *= 2; x", 10},
+		{"let x = 9; x /= 2; x", 4},
+		{"let x = 1; let y = (x = 5); x + y", 10},
+		{"let a = 1; let b = 2; a = b = 7; a + b", 14},
+		{"let c = 0; let inc = fn() { c += 1 }; inc(); inc(); c", 2},
+		{"let x = 1; let f = fn() { let x = 5; x = 6; x }; f() + x", 7},
+		{"let f = fn() { let n = 1; n += 2; n }; f()", 3},
+		{"let i = 0; while (i < 5) { i += 1; } i", 5},
+		{"let x = 1.5; x *= 2; x", 3.0},
+		{"y = 1", "identifier not found: y"},
+		{"y += 1", "identifier not found: y"},
+		{"let f = fn() { y = 1 }; let y = 0; f(); y", 1},
+		{"let make = fn() { let c = 0; fn() { c += 1; c } }; let next = make(); next(); next()", 2},
+		{"let make = fn() { let c = 0; [fn() { c += 1 }, fn() { c }] }; let p = make(); p[0](); p[0](); p[1]()", 2},
+		{"let make = fn() { let c = 0; fn() { c += 1 } }; let a = make(); let b = make(); a(); a(); b()", 1},
+		{"let f = fn(n) { let get = fn() { n }; n = 5; get() }; f(1)", 5},
+		{"let f = fn() { let c = 0; let g = fn() { fn() { c = c + 10 } }; g()(); c }; f()", 10},
+		{"let f = fn() { let c = 0; for (x in [1, 2, 3]) { let add = fn() { c += x }; add() } c }; f()", 6},
+		{"let x = 1; x += true", "type mismatch: INTEGER + BOOLEAN"},
+		{"let x = 1; x /= 0", "division by zero"},
+		{`let s = "a"; s += "b"; s`, str("ab")},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestIndexAssignment(t *testing.T) {
+	tests := []vmTestCase{
+		{"let a = [1, 2, 3]; a[0] = 5; a", []int{5, 2, 3}},
+		{"let a = [1, 2, 3]; a[1] += 5; a", []int{1, 7, 3}},
+		{"let a = [1, 2, 3]; a[2] = 9", 9},
+		{"let a = [1, 2]; let b = a; b[0] = 3; a", []int{3, 2}},
+		{"let a = [0, 0, 0]; let i = 0; while (i < 3) { a[i] = i * i; i += 1; } a", []int{0, 1, 4}},
+		{"let m = [[1, 2], [3, 4]]; m[1][0] *= 10; m[1]", []int{30, 4}},
+		{`let h = {}; h["a"] = 1; h["a"]`, 1},
+		{`let h = {"a": 1}; h["a"] += 2; h["a"]`, 3},
+		{"let h = {}; h[true] = 1; h[2] = 2; h[true] + h[2]", 3},
+		{"let f = fn(a) { a[0] = 1 }; let a = [0]; f(a); a", []int{1}},
+		{"let f = fn() { let a = [1]; a[0] -= 3; a }; f()", []int{-2}},
+		{"let a = [1, 2]; a[2] = 3", "index out of range: 2 with length 2"},
+		{"let a = [1, 2]; a[-1] = 3", "index out of range: -1 with length 2"},
+		{"let a = []; a[0] += 1", "index out of range: 0 with length 0"},
+		{`let a = [1]; a["x"] = 1`, "array index must be INTEGER, got STRING"},
+		{"let h = {}; h[fn(x) { x }] = 1", "unusable as hash key: CLOSURE"},
+		{"let h = {}; h[[]] = 1", "unusable as hash key: ARRAY"},
+		{`let h = {}; h["n"] += 1`, "key not found: n"},
+		{`let h = {"n": 1}; h["n"] += true`, "type mismatch: INTEGER + BOOLEAN"},
+		{`let s = "abc"; s[0] = "x"`, "index assignment not supported: STRING"},
+		{"b[0] = 1", "identifier not found: b"},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestTryCatch(t *testing.T) {
+	tests := []vmTestCase{
+		{"try { 1 } catch (e) { 2 }", 1},
+		{"try { 1 + true } catch (e) { 2 }", 2},
+		{`try { throw("boom") } catch (e) { e["message"] }`, str("boom")},
+		{`try { throw(42) } catch (e) { e["value"] + 1 }`, 43},
+		{`try { -true } catch (e) { e["message"] }`, str("unknown operator: -BOOLEAN")},
+		{"1 + try { throw(1) } catch (e) { 2 }", 3},
+		{"let f = fn() { throw(1); 2 }; try { f() } catch (e) { e[\"value\"] * 10 }", 10},
+		{"let f = fn(n) { if (n == 0) { throw(n) } f(n - 1) }; try { f(5) } catch (e) { 7 }", 7},
+		{"let f = fn() { try { return 1; } catch (e) { 2 }; 3 }; f(); try { throw(1) } catch (e) { 4 }", 4},
+		{"let f = fn() { try { return 1; } catch (e) { 2 } }; f(); 1 + true", "type mismatch: INTEGER + BOOLEAN"},
+		{"try { try { throw(1) } catch (e) { throw(e[\"value\"] + 1) } } catch (e) { e[\"value\"] }", 2},
+		{"fn() { let x = 1; try { throw(x) } catch (e) { e[\"value\"] + x } }()", 2},
+		{"let i = 0; while (true) { try { i += 1; if (i > 2) { break } } catch (e) { } } i", 3},
+		{"let i = 0; while (i < 3) { try { i += 1; continue; } catch (e) { } } 1 + true", "type mismatch: INTEGER + BOOLEAN"},
+		{"try { } catch (e) { 1 }", nil},
+		{"try { throw(1) } catch (e) { }", nil},
+		{`throw("boom")`, "boom"},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestGlobalLetStatements(t *testing.T) {
+	tests := []vmTestCase{
+		{"let a = 5; a;", 5},
+		{"let a = 5 * 5; a;", 25},
+		{"let a = 5; let b = a; b;", 5},
+		{"let a = 5; let b = a; let c = a + b + 5; c;", 15},
+		{"let f = fn() { g() }; let g = fn() { 3 }; f();", 3},
+		{"if (false) { foobar }; 1", 1},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestStringExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{`"Hello World!"`, str("Hello World!")},
+		{`"Hello" + " " + "World!"`, str("Hello World!")},
+		{`"say \"hi\"\n"`, str("say \"hi\"\n")},
+		{`"\u{1F600}"`, str("\U0001F600")},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestArrayLiterals(t *testing.T) {
+	tests := []vmTestCase{
+		{"[]", []int{}},
+		{"[1, 2 * 2, 3 + 3]", []int{1, 4, 6}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestHashLiterals(t *testing.T) {
+	input := `
+		let two = "two";
+		{
+			"one": 10 - 9,
+			two: 1 + 1,
+			"thr" + "ee": 6 / 2,
+			4: 4,
+			true: 5,
+			false: 6
+		}
+	`
+
+	result := testRun(t, input)
+	hash, ok := result.(*object.Hash)
+	if !ok {
+		t.Fatalf("object is not Hash. got=%T (%+v)", result, result)
+	}
+
+	expected := map[object.HashKey]int64{
+		(&object.String{Value: "one"}).HashKey():   1,
+		(&object.String{Value: "two"}).HashKey():   2,
+		(&object.String{Value: "three"}).HashKey(): 3,
+		(&object.Integer{Value: 4}).HashKey():      4,
+		True.HashKey():                             5,
+		False.HashKey():                            6,
+	}
+
+	if len(hash.Pairs) != len(expected) {
+		t.Fatalf("Hash has wrong num of pairs. got=%d", len(hash.Pairs))
+	}
+
+	for expectedKey, expectedValue := range expected {
+		pair, ok := hash.Pairs[expectedKey]
+		if !ok {
+			t.Errorf("no pair for given key in Pairs")
+		}
+
+		testExpectedObject(t, expectedValue, pair.Value)
+	}
+}
+
+func TestIndexExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{"[1, 2, 3][0]", 1},
+		{"[1, 2, 3][1]", 2},
+		{"[1, 2, 3][2]", 3},
+		{"let i = 0; [1][i];", 1},
+		{"[1, 2, 3][1 + 1];", 3},
+		{"let myArray = [1, 2, 3]; myArray[2];", 3},
+		{"let myArray = [1, 2, 3]; myArray[0] + myArray[1] + myArray[2];", 6},
+		{"let myArray = [1, 2, 3]; let i = myArray[0]; myArray[i]", 2},
+		{"[1, 2, 3][3]", nil},
+		{"[1, 2, 3][-1]", nil},
+		{`{"foo": 5}["foo"]`, 5},
+		{`{"foo": 5}["bar"]`, nil},
+		{`let key = "foo"; {"foo": 5}[key]`, 5},
+		{`{}["foo"]`, nil},
+		{`{5: 5}[5]`, 5},
+		{`{true: 5}[true]`, 5},
+		{`{false: 5}[false]`, 5},
+		{`"héllo"[1]`, str("é")},
+		{`"abc"[3]`, nil},
+		{`"abc"[-1]`, nil},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestFunctionApplication(t *testing.T) {
+	tests := []vmTestCase{
+		{"let identity = fn(x) { x; }; identity(5);", 5},
+		{"let identity = fn(x) { return x; }; identity(5);", 5},
+		{"let double = fn(x) { x * 2; }; double(5);", 10},
+		{"let add = fn(x, y) { x + y; }; add(5, 5);", 10},
+		{"let add = fn(x, y) { x + y; }; add(5 + 5, add(5, 5));", 20},
+		{"fn(x) { x; }(5)", 5},
+		{"let noReturn = fn() { }; noReturn();", nil},
+		{"let early = fn() { return 1; 2 }; early();", 1},
+		{"let nested = fn(x) { if (x > 1) { return x; } 0 }; nested(5) + nested(1);", 5},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestEnclosingEnvironments(t *testing.T) {
+	input := `
+		let first = 10;
+		let second = 10;
+		let third = 10;
+
+		let ourFunction = fn(first) {
+			let second = 20;
+
+			first + second + third;
+		};
+
+		ourFunction(20) + first + second;
+	`
+
+	runVmTests(t, []vmTestCase{{input, 70}})
+}
+
+func TestClosures(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			`
+				let newAdder = fn(x) {
+					fn(y) { x + y };
+				};
+
+				let addTwo = newAdder(2);
+				addTwo(2);
+			`,
+			4,
+		},
+		{
+			`
+				let newAdderOuter = fn(a, b) {
+					let c = a + b;
+					fn(d) {
+						let e = d + c;
+						fn(f) { e + f; };
+					};
+				};
+				let newAdderInner = newAdderOuter(1, 2)
+				let adder = newAdderInner(3);
+				adder(8);
+			`,
+			14,
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestRecursiveFunctions(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			`
+				let fibonacci = fn(x) {
+					if (x == 0) { return 0; }
+					if (x == 1) { return 1; }
+					fibonacci(x - 1) + fibonacci(x - 2);
+				};
+				fibonacci(15);
+			`,
+			610,
+		},
+		{
+			`
+				let wrapper = fn() {
+					let countDown = fn(x) {
+						if (x == 0) { return 0; }
+						countDown(x - 1);
+					};
+					countDown(1);
+				};
+				wrapper();
+			`,
+			0,
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestBuiltinFunctions(t *testing.T) {
+	tests := []vmTestCase{
+		{`len("")`, 0},
+		{`len("four")`, 4},
+		{`len("hello world")`, 11},
+		{`len("héllo")`, 5},
+		{`len(1)`, "argument to `len` not supported, got INTEGER"},
+		{`len("one", "two")`, "wrong number of arguments. got=2, want=1"},
+		{`len([1, 2, 3])`, 3},
+		{`len([])`, 0},
+		{`puts("hello", "world!")`, nil},
+		{`first([1, 2, 3])`, 1},
+		{`first([])`, nil},
+		{`first(1)`, "argument to `first` must be ARRAY, got INTEGER"},
+		{`last([1, 2, 3])`, 3},
+		{`last([])`, nil},
+		{`last(1)`, "argument to `last` must be ARRAY, got INTEGER"},
+		{`rest([1, 2, 3])`, []int{2, 3}},
+		{`rest([])`, nil},
+		{`push([], 1)`, []int{1}},
+		{`push(1, 1)`, "argument to `push` must be ARRAY, got INTEGER"},
+		{`let len = fn(x) { 42 }; len([])`, 42},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestStackOverflow(t *testing.T) {
+	program := parse("let f = fn() { f() }; f();")
+
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	vm := New(comp.Bytecode())
+	if err := vm.Run(); err == nil {
+		t.Fatalf("expected stack overflow error, got none")
+	}
+}
+
+// Compile and run all test cases, checking the last popped element
+func runVmTests(t *testing.T, tests []vmTestCase) {
+	t.Helper()
+
+	for _, tt := range tests {
+		testExpectedObject(t, tt.expected, testRun(t, tt.input))
+	}
+}
+
+// Compile and run an input string and return the result
+func testRun(t *testing.T, input string) object.Object {
+	t.Helper()
+
+	program := parse(input)
+
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	vm := New(comp.Bytecode())
+	if err := vm.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	return vm.LastPoppedStackElem()
+}
+
+// Parse an input string into a program
+func parse(input string) *ast.Program {
+	l := lexer.New(input)
+	p := parser.New(l)
+	return p.ParseProgram()
+}
+
+// Test an object against an expected value
+func testExpectedObject(t *testing.T, expected interface{}, actual object.Object) {
+	t.Helper()
+
+	switch expected := expected.(type) {
+	case int:
+		testIntegerObject(t, int64(expected), actual)
+	case int64:
+		testIntegerObject(t, expected, actual)
+	case float64:
+		testFloatObject(t, expected, actual)
+	case bool:
+		testBooleanObject(t, expected, actual)
+	case str:
+		testStringObject(t, string(expected), actual)
+	case string:
+		testErrorObject(t, expected, actual)
+	case []int:
+		array, ok := actual.(*object.Array)
+		if !ok {
+			t.Errorf("object not Array: %T (%+v)", actual, actual)
+			return
+		}
+
+		if len(array.Elements) != len(expected) {
+			t.Errorf("wrong num of elements. want=%d, got=%d",
+				len(expected), len(array.Elements))
+			return
+		}
+
+		for i, expectedElem := range expected {
+			testIntegerObject(t, int64(expectedElem), array.Elements[i])
+		}
+	case nil:
+		if actual != Null {
+			t.Errorf("object is not Null: %T (%+v)", actual, actual)
+		}
+	default:
+		t.Fatalf("unsupported literal testing: %T", expected)
+	}
+}
+
+// Test an integer object
+func testIntegerObject(t *testing.T, expected int64, actual object.Object) {
+	t.Helper()
+
+	result, ok := actual.(*object.Integer)
+	if !ok {
+		t.Errorf("object is not Integer. got=%T (%+v)", actual, actual)
+		return
+	}
+
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%d, want=%d",
+			result.Value, expected)
+	}
+}
+
+// Test a float object
+func testFloatObject(t *testing.T, expected float64, actual object.Object) {
+	t.Helper()
+
+	result, ok := actual.(*object.Float)
+	if !ok {
+		t.Errorf("object is not Float. got=%T (%+v)", actual, actual)
+		return
+	}
+
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%g, want=%g",
+			result.Value, expected)
+	}
+}
+
+// Test a boolean object
+func testBooleanObject(t *testing.T, expected bool, actual object.Object) {
+	t.Helper()
+
+	result, ok := actual.(*object.Boolean)
+	if !ok {
+		t.Errorf("object is not Boolean. got=%T (%+v)", actual, actual)
+		return
+	}
+
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%t, want=%t",
+			result.Value, expected)
+	}
+}
+
+// Test a string object
+func testStringObject(t *testing.T, expected string, actual object.Object) {
+	t.Helper()
+
+	result, ok := actual.(*object.String)
+	if !ok {
+		t.Errorf("object is not String. got=%T (%+v)", actual, actual)
+		return
+	}
+
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%q, want=%q",
+			result.Value, expected)
+	}
+}
+
+// Test an error object
+func testErrorObject(t *testing.T, expected string, actual object.Object) {
+	t.Helper()
+
+	errObj, ok := actual.(*object.Error)
+	if !ok {
+		t.Errorf("object is not Error. got=%T (%+v)", actual, actual)
+		return
+	}
+
+	if errObj.Message != expected {
+		t.Errorf("wrong error message. expected=%q, got=%q",
+			expected, errObj.Message)
+	}
+}